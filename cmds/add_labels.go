@@ -19,20 +19,18 @@ package cmds
 
 import (
 	"context"
-	"fmt"
-	"log"
 
 	"github.com/google/go-github/v84/github"
 	"github.com/spf13/cobra"
 	"gomodules.xyz/flags"
-	"gomodules.xyz/pointer"
 )
 
 func NewCmdAddLabels() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:               "add-labels",
-		Short:             "Add labels",
+		Short:             "Add the automerge label to all repos",
 		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			flags.PrintFlags(c.Flags())
 		},
@@ -43,68 +41,23 @@ func NewCmdAddLabels() *cobra.Command {
 	cmd.Flags().IntVar(&shards, "shards", shards, "Total number of shards")
 	cmd.Flags().IntVar(&shardIndex, "shard-index", shardIndex, "Shard Index to be processed")
 	cmd.Flags().BoolVar(&fork, "fork", fork, "If true, return forked repos")
+	addRepoSelectorFlag(cmd)
 	return cmd
 }
 
-func addLabels() {
-	ctx := context.Background()
-	client := newGitHubClient(ctx)
-
-	// Get the current user
-	user, _, err := client.Users.Get(ctx, "")
-	if err != nil {
-		log.Fatal(err)
-	}
-	log.Println("user: ", user.GetLogin())
-
-	{
-		opt := &github.ListOptions{PerPage: 50}
-		orgs, err := ListOrgs(ctx, client, opt)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		orgs = ShardOrgs(orgs, shardIndex, shards)
-		log.Printf("Found %d orgs", len(orgs))
-
-		for _, org := range orgs {
-			fmt.Println(">>> " + org.GetLogin())
-		}
-	}
-
-	{
-		opt := &github.RepositoryListByAuthenticatedUserOptions{
-			Affiliation: "owner,organization_member",
-			ListOptions: github.ListOptions{PerPage: 50},
-		}
-		repos, err := ListRepos(ctx, client, opt, fork)
-		if err != nil {
-			log.Fatal(err)
-		}
-		log.Printf("Found %d repositories", len(repos))
-		for _, repo := range repos {
-			if repo.GetOwner().GetType() == OwnerTypeUser {
-				continue
-			}
-			if repo.GetPrivate() {
-				continue
-			}
-			if repo.GetPermissions().GetAdmin() {
-				err = AddLabelToRepo(ctx, client, repo)
-				if err != nil {
-					log.Fatalln(err)
-				}
-			}
-		}
-	}
-	/*
+// automergeLabels is the label manifest of add-labels.
+var automergeLabels = &LabelManifest{
+	Labels: []ManifestLabel{
 		{
-			err := ProtectBranch(ctx, client, "yaxc", "test", "master")
-			if err != nil {
-				log.Fatal(err)
-			}
-		}
-	*/
+			Name:        "automerge",
+			Color:       "fef2c0",
+			Description: "Kodiak will auto merge PRs that have this label",
+		},
+	},
+}
+
+func addLabels() {
+	runLabelSync(automergeLabels, false, defaultRepoTerms(fork, "owner-type=organization", "visibility=public"))
 }
 
 func ListLabels(ctx context.Context, client *github.Client, repo *github.Repository) ([]*github.Label, error) {
@@ -116,7 +69,7 @@ func ListLabels(ctx context.Context, client *github.Client, repo *github.Reposit
 	for {
 		labels, resp, err := client.Issues.ListLabels(ctx, repo.Owner.GetLogin(), repo.GetName(), opt)
 		if err != nil {
-			break
+			return nil, err
 		}
 		result = append(result, labels...)
 		if resp.NextPage == 0 {
@@ -136,36 +89,7 @@ func LabelExists(labels []*github.Label, name string) (*github.Label, bool) {
 	return nil, false
 }
 
+// AddLabelToRepo ensures that repo has the automerge label.
 func AddLabelToRepo(ctx context.Context, client *github.Client, repo *github.Repository) error {
-	fmt.Println("[___]>", repo.Owner.GetLogin()+"/"+repo.GetName())
-	labels, err := ListLabels(ctx, client, repo)
-	if err != nil {
-		return err
-	}
-
-	/*
-		automerge: Kodiak will auto merge PRs that have this label : #fef2c0
-	*/
-	if label, ok := LabelExists(labels, "automerge"); ok {
-		if label.GetColor() != "fef2c0" {
-			_, _, err := client.Issues.EditLabel(ctx, repo.Owner.GetLogin(), repo.GetName(), "automerge", &github.Label{
-				Name:        pointer.StringP("automerge"),
-				Color:       pointer.StringP("fef2c0"),
-				Description: pointer.StringP("Kodiak will auto merge this PR"),
-			})
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		_, _, err := client.Issues.CreateLabel(ctx, repo.Owner.GetLogin(), repo.GetName(), &github.Label{
-			Name:        pointer.StringP("automerge"),
-			Color:       pointer.StringP("fef2c0"),
-			Description: pointer.StringP("Kodiak will auto merge PRs that have this label"),
-		})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return SyncRepoLabels(ctx, client, repo, automergeLabels, false)
 }
@@ -0,0 +1,55 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddLabelToRepo(t *testing.T) {
+	srv, client := useFakeGitHub(t)
+	missing := srv.AddRepo("kubedb", "mysql").AddLabel("bug", "d73a4a", "")
+	stale := srv.AddRepo("kubedb", "redis").AddLabel("automerge", "ffffff", "")
+
+	ctx := context.Background()
+	for _, fake := range []string{"mysql", "redis"} {
+		assert.NoError(t, AddLabelToRepo(ctx, client, srv.Repo("kubedb", fake).Repository()))
+	}
+
+	for _, labels := range [][]string{labelColors(missing.Labels()), labelColors(stale.Labels())} {
+		assert.Contains(t, labels, "automerge=fef2c0")
+	}
+	assert.Len(t, missing.Labels(), 2)
+	assert.Len(t, stale.Labels(), 1)
+
+	// nothing changes once the label is up to date
+	before := len(mutatingRequests(srv))
+	assert.NoError(t, AddLabelToRepo(ctx, client, stale.Repository()))
+	assert.Len(t, mutatingRequests(srv), before)
+}
+
+func labelColors(labels []*github.Label) []string {
+	out := make([]string, 0, len(labels))
+	for _, l := range labels {
+		out = append(out, l.GetName()+"="+l.GetColor())
+	}
+	return out
+}
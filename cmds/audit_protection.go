@@ -0,0 +1,362 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/spf13/cobra"
+	"gomodules.xyz/flags"
+	"gomodules.xyz/sets"
+)
+
+// exitCodeDrift is returned by audit-protection when drift is found, so that
+// it can be told apart from other failures (exit code 1).
+const exitCodeDrift = 2
+
+const (
+	driftUnprotected   = "unprotected"
+	driftMissingChecks = "missing-checks"
+	driftEnforceAdmins = "enforce-admins"
+	driftMissingKodiak = "missing-kodiak"
+	driftOther         = "other"
+)
+
+// ProtectionDrift is a single difference between the protection of a branch
+// and what ProtectBranch would set.
+type ProtectionDrift struct {
+	Repo    string `json:"repo"`
+	Branch  string `json:"branch"`
+	Kind    string `json:"kind"`
+	Details string `json:"details"`
+}
+
+func NewCmdAuditProtection() *cobra.Command {
+	var (
+		orgs        []string
+		output      string
+		includeFork bool
+		skipRepos   []string
+	)
+	cmd := &cobra.Command{
+		Use:               "audit-protection",
+		Short:             "Report branches whose protection drifted from the protection policy",
+		Long:              fmt.Sprintf("Report branches whose protection drifted from the protection policy. Exits with code %d if drift is found.\n\nThe desired protection is computed like protect does, including --discover-checks and --merge. Repos with rulesets managed by gh-tools, or all repos with --backend rulesets, are compared with the rulesets protect --backend rulesets would create.", exitCodeDrift),
+		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
+		PersistentPreRun: func(c *cobra.Command, args []string) {
+			flags.PrintFlags(c.Flags())
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			runAuditProtection(sets.NewString(orgs...), output, includeFork, skipRepos)
+		},
+	}
+	cmd.Flags().StringSliceVar(&orgs, "orgs", nil, "If set, only audit repos in these orgs")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table, json or markdown")
+	cmd.Flags().BoolVar(&includeFork, "fork", false, "If true, include forked repos")
+	cmd.Flags().StringSliceVar(&skipRepos, "skip", nil, "Skip owner/repository")
+	cmd.Flags().IntVar(&shards, "shards", shards, "Total number of shards")
+	cmd.Flags().IntVar(&shardIndex, "shard-index", shardIndex, "Shard Index to be processed")
+	cmd.Flags().StringVar(&protectionPolicyFile, "policy", protectionPolicyFile, "Path to branch protection policy file (YAML or JSON). Uses the built-in policy if empty.")
+	addProtectBackendFlags(cmd)
+	addBranchPatternFlag(cmd)
+	addDiscoverChecksFlags(cmd)
+	addMergeProtectionFlag(cmd)
+	addRepoSelectorFlag(cmd)
+	return cmd
+}
+
+func runAuditProtection(orgs sets.String, output string, includeFork bool, skipRepos []string) {
+	switch output {
+	case "table", "json", "markdown":
+	default:
+		log.Fatalf("unknown output format %q", output)
+	}
+
+	if err := validateProtectOptions(); err != nil {
+		log.Fatalln(err)
+	}
+
+	ctx := context.Background()
+	client := newGitHubClient(ctx)
+
+	drifts, err := auditProtection(ctx, client, orgs, includeFork, skipRepos)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := printDrifts(os.Stdout, output, drifts); err != nil {
+		log.Fatalln(err)
+	}
+	if len(drifts) > 0 {
+		log.Printf("found %d protection drift(s)", len(drifts))
+		os.Exit(exitCodeDrift)
+	}
+}
+
+func auditProtection(ctx context.Context, client *github.Client, orgs sets.String, includeFork bool, skipRepos []string) ([]ProtectionDrift, error) {
+	sel, err := newRepoSelector(defaultRepoTerms(includeFork, "owner-type=organization"))
+	if err != nil {
+		return nil, err
+	}
+
+	allOrgs, err := ListOrgs(ctx, client, &github.ListOptions{PerPage: 50})
+	if err != nil {
+		return nil, err
+	}
+	allOrgs = ShardOrgs(allOrgs, shardIndex, shards)
+	auditOrgs := sets.NewString()
+	for _, org := range allOrgs {
+		if orgs.Len() == 0 || orgs.Has(org.GetLogin()) {
+			auditOrgs.Insert(org.GetLogin())
+		}
+	}
+	log.Printf("Auditing %d orgs", auditOrgs.Len())
+
+	opt := &github.RepositoryListByAuthenticatedUserOptions{
+		Affiliation: "owner,organization_member",
+		ListOptions: github.ListOptions{PerPage: 50},
+	}
+	repos, err := ListRepos(ctx, client, opt, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	skipSet := sets.NewString(skipRepos...)
+	var drifts []ProtectionDrift
+	for _, repo := range repos {
+		if !auditOrgs.Has(repo.GetOwner().GetLogin()) {
+			continue
+		}
+		if !repo.GetPermissions().GetAdmin() || skipSet.Has(repo.GetFullName()) {
+			continue
+		}
+		supported, reason, err := repoSupportsProtection(ctx, client, repo)
+		if err != nil {
+			return nil, err
+		}
+		if !supported {
+			log.Printf("Skipping %s (%s)", repo.GetFullName(), reason)
+			continue
+		}
+
+		d, err := auditRepoProtection(ctx, client, repo)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", repo.GetFullName(), err)
+		}
+		drifts = append(drifts, d...)
+	}
+	return drifts, nil
+}
+
+// auditRepoProtection returns the drift of the branches of repo. Repos with
+// rulesets managed by gh-tools are audited like the rulesets backend protects
+// them, even when --backend is classic.
+func auditRepoProtection(ctx context.Context, client *github.Client, repo *github.Repository) ([]ProtectionDrift, error) {
+	owner := repo.GetOwner().GetLogin()
+	rulesets, err := listRepoRulesets(ctx, client, owner, repo.GetName())
+	if err != nil {
+		return nil, err
+	}
+	var managed []*github.RepositoryRuleset
+	for _, rs := range rulesets {
+		if isManagedRuleset(rs.Name) {
+			managed = append(managed, rs)
+		}
+	}
+	if len(managed) > 0 || protectBackend == protectBackendRulesets {
+		return auditRepoRulesets(ctx, client, repo, managed)
+	}
+
+	selector, err := currentBranchSelector()
+	if err != nil {
+		return nil, err
+	}
+	branches, err := ListBranches(ctx, client, repo)
+	if err != nil {
+		return nil, err
+	}
+	var drifts []ProtectionDrift
+	for _, branch := range branches {
+		if !selector.Matches(repo, branch.GetName()) {
+			continue
+		}
+		current, err := getBranchProtection(ctx, client, owner, repo.GetName(), branch.GetName())
+		if err != nil {
+			return nil, err
+		}
+		desired, err := desiredProtectionRequest(ctx, client, owner, repo.GetName(), branch.GetName(), current)
+		if err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, classifyDrift(repo.GetFullName(), branch.GetName(), diffProtection(current, desired))...)
+	}
+	return drifts, nil
+}
+
+// auditRepoRulesets compares the managed rulesets of repo with the rulesets
+// that protect --backend rulesets would create. The branch of a drift is the
+// ref pattern list of the ruleset.
+func auditRepoRulesets(ctx context.Context, client *github.Client, repo *github.Repository, managed []*github.RepositoryRuleset) ([]ProtectionDrift, error) {
+	desired, err := desiredRepoRulesets(ctx, client, repo)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*github.RepositoryRuleset{}
+	for _, rs := range managed {
+		byName[rs.Name] = rs
+	}
+
+	var drifts []ProtectionDrift
+	for _, rs := range desired {
+		branches := rulesetBranches(rs)
+		cur, ok := byName[rs.Name]
+		if !ok {
+			drifts = append(drifts, ProtectionDrift{Repo: repo.GetFullName(), Branch: branches, Kind: driftUnprotected, Details: fmt.Sprintf("ruleset %q does not exist", rs.Name)})
+			continue
+		}
+		full, _, err := client.Repositories.GetRuleset(ctx, repo.GetOwner().GetLogin(), repo.GetName(), cur.GetID(), false)
+		if err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, classifyRulesetDrift(repo.GetFullName(), branches, rulesetRequest(full), rs)...)
+	}
+	return drifts, nil
+}
+
+func rulesetBranches(rs github.RepositoryRuleset) string {
+	refs := refNameIncludes(rs)
+	out := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		out = append(out, strings.TrimPrefix(ref, "refs/heads/"))
+	}
+	return strings.Join(out, ",")
+}
+
+// classifyRulesetDrift is classifyDrift for rulesets. Differences that have no
+// kind of their own are reported once as driftOther.
+func classifyRulesetDrift(repo, branch string, current, desired github.RepositoryRuleset) []ProtectionDrift {
+	if rulesetsEqual(current, desired) {
+		return nil
+	}
+	if current.Enforcement != github.RulesetEnforcementActive {
+		return []ProtectionDrift{{Repo: repo, Branch: branch, Kind: driftUnprotected, Details: fmt.Sprintf("ruleset %q is %s", desired.Name, current.Enforcement)}}
+	}
+
+	var out []ProtectionDrift
+	add := func(kind, details string) {
+		out = append(out, ProtectionDrift{Repo: repo, Branch: branch, Kind: kind, Details: details})
+	}
+	if missing := sets.NewString(rulesetChecks(desired)...).Difference(sets.NewString(rulesetChecks(current)...)); missing.Len() > 0 {
+		add(driftMissingChecks, strings.Join(missing.List(), ", "))
+	}
+	if cur, want := !hasBypassActor(current, github.BypassActorTypeRepositoryRole), !hasBypassActor(desired, github.BypassActorTypeRepositoryRole); cur != want {
+		add(driftEnforceAdmins, fmt.Sprintf("enforce_admins is %t, expected %t", cur, want))
+	}
+	if hasBypassActor(desired, github.BypassActorTypeIntegration) && !hasBypassActor(current, github.BypassActorTypeIntegration) {
+		add(driftMissingKodiak, fmt.Sprintf("ruleset %q has no bypass for apps", desired.Name))
+	}
+	if len(out) == 0 {
+		add(driftOther, fmt.Sprintf("ruleset %q differs from the policy", desired.Name))
+	}
+	return out
+}
+
+func rulesetChecks(rs github.RepositoryRuleset) []string {
+	if rs.Rules == nil || rs.Rules.RequiredStatusChecks == nil {
+		return nil
+	}
+	var out []string
+	for _, c := range rs.Rules.RequiredStatusChecks.RequiredStatusChecks {
+		out = append(out, c.Context)
+	}
+	return out
+}
+
+func hasBypassActor(rs github.RepositoryRuleset, actorType github.BypassActorType) bool {
+	for _, a := range rs.BypassActors {
+		if a.ActorType != nil && *a.ActorType == actorType {
+			return true
+		}
+	}
+	return false
+}
+
+func classifyDrift(repo, branch string, changes []ProtectionChange) []ProtectionDrift {
+	var out []ProtectionDrift
+	for _, c := range changes {
+		d := ProtectionDrift{Repo: repo, Branch: branch}
+		switch c.Field {
+		case fieldProtected:
+			// nothing else is worth reporting for an unprotected branch
+			return []ProtectionDrift{{Repo: repo, Branch: branch, Kind: driftUnprotected, Details: "branch is not protected"}}
+		case fieldChecks:
+			if len(c.Added) == 0 {
+				continue
+			}
+			d.Kind = driftMissingChecks
+			d.Details = strings.Join(c.Added, ", ")
+		case fieldEnforceAdmins:
+			d.Kind = driftEnforceAdmins
+			d.Details = fmt.Sprintf("enforce_admins is %s, expected %s", c.Current, c.Desired)
+		case fieldRestrictionApps:
+			if len(c.Added) == 0 {
+				continue
+			}
+			d.Kind = driftMissingKodiak
+			d.Details = "missing push restriction for " + strings.Join(c.Added, ", ")
+		default:
+			d.Kind = driftOther
+			d.Details = fmt.Sprintf("%s is %s, expected %s", c.Field, c.Current, c.Desired)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+func printDrifts(w io.Writer, output string, drifts []ProtectionDrift) error {
+	switch output {
+	case "json":
+		if drifts == nil {
+			drifts = []ProtectionDrift{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(drifts)
+	case "markdown":
+		_, _ = fmt.Fprintln(w, "| Repository | Branch | Drift | Details |")
+		_, _ = fmt.Fprintln(w, "|------------|--------|-------|---------|")
+		for _, d := range drifts {
+			_, _ = fmt.Fprintf(w, "| %s | %s | %s | %s |\n", d.Repo, d.Branch, d.Kind, strings.ReplaceAll(d.Details, "|", `\|`))
+		}
+		return nil
+	default:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "REPOSITORY\tBRANCH\tDRIFT\tDETAILS")
+		for _, d := range drifts {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", d.Repo, d.Branch, d.Kind, d.Details)
+		}
+		return tw.Flush()
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+	"gomodules.xyz/sets"
+)
+
+func TestClassifyDrift(t *testing.T) {
+	changes := []ProtectionChange{
+		{Field: fieldChecks, Current: "[DCO, lint]", Desired: "[Build, DCO]", Added: []string{"Build"}, Removed: []string{"lint"}},
+		{Field: fieldReviewCount, Current: "2", Desired: "1"},
+		{Field: fieldEnforceAdmins, Current: "false", Desired: "true"},
+		{Field: fieldRestrictionApps, Current: "[]", Desired: "[kodiak-appscode]", Added: []string{"kodiak-appscode"}},
+		// extra checks and apps are not drift
+		{Field: fieldRestrictionApps, Current: "[dependabot]", Desired: "[]", Removed: []string{"dependabot"}},
+	}
+	assert.Equal(t, []ProtectionDrift{
+		{Repo: "kubedb/mysql", Branch: "master", Kind: driftMissingChecks, Details: "Build"},
+		{Repo: "kubedb/mysql", Branch: "master", Kind: driftOther, Details: fieldReviewCount + " is 2, expected 1"},
+		{Repo: "kubedb/mysql", Branch: "master", Kind: driftEnforceAdmins, Details: "enforce_admins is false, expected true"},
+		{Repo: "kubedb/mysql", Branch: "master", Kind: driftMissingKodiak, Details: "missing push restriction for kodiak-appscode"},
+	}, classifyDrift("kubedb/mysql", "master", changes))
+
+	unprotected := append([]ProtectionChange{{Field: fieldProtected, Current: "false", Desired: "true"}}, changes...)
+	assert.Equal(t, []ProtectionDrift{
+		{Repo: "kubedb/mysql", Branch: "master", Kind: driftUnprotected, Details: "branch is not protected"},
+	}, classifyDrift("kubedb/mysql", "master", unprotected))
+
+	assert.Nil(t, classifyDrift("kubedb/mysql", "master", nil))
+}
+
+func TestPrintDrifts(t *testing.T) {
+	drifts := []ProtectionDrift{
+		{Repo: "kubedb/mysql", Branch: "master", Kind: driftMissingChecks, Details: "Build | e2e"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, printDrifts(&buf, "table", drifts))
+	assert.Equal(t, `REPOSITORY    BRANCH  DRIFT           DETAILS
+kubedb/mysql  master  missing-checks  Build | e2e
+`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, printDrifts(&buf, "markdown", drifts))
+	assert.Equal(t, `| Repository | Branch | Drift | Details |
+|------------|--------|-------|---------|
+| kubedb/mysql | master | missing-checks | Build \| e2e |
+`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, printDrifts(&buf, "json", drifts))
+	assert.JSONEq(t, `[{"repo":"kubedb/mysql","branch":"master","kind":"missing-checks","details":"Build | e2e"}]`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, printDrifts(&buf, "json", nil))
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestAuditProtection(t *testing.T) {
+	captureLog(t)
+	defer func(b string) { protectBackend = b }(protectBackend)
+
+	srv, client := useFakeGitHub(t)
+	srv.AddOrg("kubedb")
+	srv.AddApp("kodiak-appscode", 42)
+	classic := srv.AddRepo("kubedb", "mysql").AddBranch("release-1.0")
+	rulesets := srv.AddRepo("kubedb", "redis").AddBranch("release-1.0")
+
+	ctx := context.Background()
+	assert.NoError(t, ProtectRepo(ctx, client, classic.Repository()))
+	protectBackend = protectBackendRulesets
+	assert.NoError(t, ProtectRepoWithRulesets(ctx, client, rulesets.Repository()))
+	protectBackend = protectBackendClassic
+
+	// protected repos have no drift, whichever backend protects them
+	drifts, err := auditProtection(ctx, client, sets.NewString(), false, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, drifts)
+
+	_, err = client.Repositories.RemoveBranchProtection(ctx, "kubedb", "mysql", "release-1.0")
+	assert.NoError(t, err)
+	for _, rs := range rulesets.Rulesets() {
+		if rs.Name == rulesetName+"/release-*" {
+			_, err = client.Repositories.DeleteRuleset(ctx, "kubedb", "redis", rs.GetID())
+			assert.NoError(t, err)
+		}
+	}
+
+	drifts, err = auditProtection(ctx, client, sets.NewString(), false, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []ProtectionDrift{
+		{Repo: "kubedb/mysql", Branch: "release-1.0", Kind: driftUnprotected, Details: "branch is not protected"},
+		{Repo: "kubedb/redis", Branch: "release-*", Kind: driftUnprotected, Details: `ruleset "gh-tools/release-*" does not exist`},
+	}, drifts)
+}
+
+func TestClassifyRulesetDrift(t *testing.T) {
+	desired := github.RepositoryRuleset{
+		Name:        rulesetName,
+		Enforcement: github.RulesetEnforcementActive,
+		BypassActors: []*github.BypassActor{
+			{ActorID: github.Ptr(int64(42)), ActorType: github.Ptr(github.BypassActorTypeIntegration)},
+		},
+		Rules: &github.RepositoryRulesetRules{
+			RequiredStatusChecks: &github.RequiredStatusChecksRuleParameters{
+				RequiredStatusChecks: []*github.RuleStatusCheck{{Context: "Build"}, {Context: "DCO"}},
+			},
+		},
+	}
+	assert.Nil(t, classifyRulesetDrift("kubedb/mysql", "master", desired, desired))
+
+	current := desired
+	current.Enforcement = github.RulesetEnforcementDisabled
+	assert.Equal(t, []ProtectionDrift{
+		{Repo: "kubedb/mysql", Branch: "master", Kind: driftUnprotected, Details: `ruleset "gh-tools" is disabled`},
+	}, classifyRulesetDrift("kubedb/mysql", "master", current, desired))
+
+	current = desired
+	current.BypassActors = []*github.BypassActor{
+		{ActorID: github.Ptr(int64(repositoryAdminRoleID)), ActorType: github.Ptr(github.BypassActorTypeRepositoryRole)},
+	}
+	current.Rules = &github.RepositoryRulesetRules{
+		RequiredStatusChecks: &github.RequiredStatusChecksRuleParameters{
+			RequiredStatusChecks: []*github.RuleStatusCheck{{Context: "DCO"}},
+		},
+	}
+	assert.Equal(t, []ProtectionDrift{
+		{Repo: "kubedb/mysql", Branch: "master", Kind: driftMissingChecks, Details: "Build"},
+		{Repo: "kubedb/mysql", Branch: "master", Kind: driftEnforceAdmins, Details: "enforce_admins is false, expected true"},
+		{Repo: "kubedb/mysql", Branch: "master", Kind: driftMissingKodiak, Details: `ruleset "gh-tools" has no bypass for apps`},
+	}, classifyRulesetDrift("kubedb/mysql", "master", current, desired))
+
+	current = desired
+	current.Rules = &github.RepositoryRulesetRules{
+		RequiredStatusChecks: desired.Rules.RequiredStatusChecks,
+		Deletion:             &github.EmptyRuleParameters{},
+	}
+	assert.Equal(t, []ProtectionDrift{
+		{Repo: "kubedb/mysql", Branch: "master", Kind: driftOther, Details: `ruleset "gh-tools" differs from the policy`},
+	}, classifyRulesetDrift("kubedb/mysql", "master", current, desired))
+}
@@ -0,0 +1,182 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// defaultBranchSelector matches the default branch of a repository.
+	defaultBranchSelector = "@default"
+)
+
+var (
+	branchPatterns []string
+	branchSelector *BranchSelector
+
+	// defaultBranchPatterns are used when neither --branch-pattern nor the
+	// policy file select branches.
+	defaultBranchPatterns = []string{defaultBranchSelector, "master", "release-*", "kubernetes-*", "ac-*"}
+)
+
+func addBranchPatternFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&branchPatterns, "branch-pattern", branchPatterns,
+		fmt.Sprintf("Branches to protect (repeatable). Glob pattern, %q prefixed regular expression or %s for the default branch. Overrides branchPatterns in the policy file.", regexPatternPrefix, defaultBranchSelector))
+}
+
+// BranchSelector decides which branches of a repository are protected.
+type BranchSelector struct {
+	patterns []branchPattern
+}
+
+type branchPattern struct {
+	raw       string
+	isDefault bool
+	regex     *regexp.Regexp
+	glob      string
+}
+
+func parseBranchSelector(patterns []string) (*BranchSelector, error) {
+	s := &BranchSelector{}
+	for _, raw := range patterns {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		bp := branchPattern{raw: raw}
+		switch {
+		case raw == defaultBranchSelector:
+			bp.isDefault = true
+		case strings.HasPrefix(raw, regexPatternPrefix):
+			re, err := regexp.Compile(strings.TrimPrefix(raw, regexPatternPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("invalid branch pattern %q: %w", raw, err)
+			}
+			bp.regex = re
+		default:
+			if _, err := path.Match(raw, ""); err != nil {
+				return nil, fmt.Errorf("invalid branch pattern %q: %w", raw, err)
+			}
+			bp.glob = raw
+		}
+		s.patterns = append(s.patterns, bp)
+	}
+	if len(s.patterns) == 0 {
+		return nil, fmt.Errorf("no branch patterns selected")
+	}
+	return s, nil
+}
+
+// currentBranchSelector returns the selector from --branch-pattern, else from
+// branchPatterns in the protection policy, else defaultBranchPatterns.
+func currentBranchSelector() (*BranchSelector, error) {
+	if branchSelector != nil {
+		return branchSelector, nil
+	}
+
+	patterns := defaultBranchPatterns
+	if len(branchPatterns) > 0 {
+		patterns = branchPatterns
+	} else {
+		policy, err := currentProtectionPolicy()
+		if err != nil {
+			return nil, err
+		}
+		if len(policy.BranchPatterns) > 0 {
+			patterns = policy.BranchPatterns
+		}
+	}
+	s, err := parseBranchSelector(patterns)
+	if err != nil {
+		return nil, err
+	}
+	branchSelector = s
+	return s, nil
+}
+
+// Matches reports whether branch of repo is selected.
+func (s *BranchSelector) Matches(repo *github.Repository, branch string) bool {
+	for _, p := range s.patterns {
+		if p.matches(repo, branch) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p branchPattern) matches(repo *github.Repository, branch string) bool {
+	switch {
+	case p.isDefault:
+		return repo.GetDefaultBranch() != "" && branch == repo.GetDefaultBranch()
+	case p.regex != nil:
+		return p.regex.MatchString(branch)
+	default:
+		ok, _ := path.Match(p.glob, branch)
+		return ok
+	}
+}
+
+// refPattern is a ruleset ref name include along with the branches it
+// matches, which are used to resolve its protection from the policy.
+type refPattern struct {
+	label    string
+	ref      string
+	branches []string
+}
+
+// RefPatterns translates the selector into ruleset ref name includes.
+// Rulesets do not support regular expressions, so those are expanded to the
+// matching branches in branches. Glob patterns are kept, along with the
+// branches in branches that they match.
+func (s *BranchSelector) RefPatterns(repo *github.Repository, branches []*github.Branch) []refPattern {
+	var out []refPattern
+	seen := map[string]bool{}
+	add := func(rp refPattern) {
+		if !seen[rp.ref] {
+			seen[rp.ref] = true
+			out = append(out, rp)
+		}
+	}
+	for _, p := range s.patterns {
+		switch {
+		case p.isDefault:
+			add(refPattern{label: "default", ref: "~DEFAULT_BRANCH", branches: []string{repo.GetDefaultBranch()}})
+		case p.regex != nil:
+			for _, b := range branches {
+				if p.regex.MatchString(b.GetName()) {
+					add(refPattern{label: b.GetName(), ref: "refs/heads/" + b.GetName(), branches: []string{b.GetName()}})
+				}
+			}
+		default:
+			rp := refPattern{label: p.glob, ref: "refs/heads/" + p.glob}
+			for _, b := range branches {
+				if p.matches(repo, b.GetName()) {
+					rp.branches = append(rp.branches, b.GetName())
+				}
+			}
+			add(rp)
+		}
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBranchSelectorMatches(t *testing.T) {
+	s, err := parseBranchSelector([]string{"@default", "release-*", `re:^v\d+\.\d+$`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &github.Repository{DefaultBranch: github.Ptr("main")}
+
+	assert.True(t, s.Matches(repo, "main"))
+	assert.True(t, s.Matches(repo, "release-1.0"))
+	assert.True(t, s.Matches(repo, "v1.2"))
+	assert.False(t, s.Matches(repo, "master"))
+	assert.False(t, s.Matches(repo, "v1.2.3"))
+}
+
+func TestBranchSelectorRefPatterns(t *testing.T) {
+	s, err := parseBranchSelector([]string{"@default", "release-*", "re:^v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &github.Repository{DefaultBranch: github.Ptr("main")}
+	branches := []*github.Branch{{Name: github.Ptr("main")}, {Name: github.Ptr("v1.0")}, {Name: github.Ptr("v2.0")}}
+
+	var refs []string
+	for _, rp := range s.RefPatterns(repo, branches) {
+		refs = append(refs, rp.ref)
+	}
+	assert.Equal(t, []string{"~DEFAULT_BRANCH", "refs/heads/release-*", "refs/heads/v1.0"}, refs)
+}
+
+func TestParseBranchSelectorInvalid(t *testing.T) {
+	_, err := parseBranchSelector([]string{"re:("})
+	assert.Error(t, err)
+
+	_, err = parseBranchSelector([]string{" "})
+	assert.Error(t, err)
+}
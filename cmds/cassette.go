@@ -0,0 +1,272 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// scrubbedHeaders are replaced with redactedValue in cassettes.
+var scrubbedHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+const redactedValue = "REDACTED"
+
+var (
+	recordCassette string
+	replayCassette string
+
+	// the recorder and the player are shared by all clients of a run, so that
+	// preflight and command requests end up in one cassette
+	cassetteMu       sync.Mutex
+	cassetteRecorder *cassetteRecorderTransport
+	cassettePlayer   *cassettePlayerTransport
+)
+
+// Interaction is a request to the GitHub API and its response, as stored in
+// a cassette file. A cassette holds one JSON encoded interaction per line.
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+type CassetteRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	CassetteBody
+}
+
+type CassetteResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	CassetteBody
+}
+
+// CassetteBody holds text bodies as is and binary bodies, like release
+// assets, base64 encoded.
+type CassetteBody struct {
+	Body       string `json:"body,omitempty"`
+	BinaryBody []byte `json:"binaryBody,omitempty"`
+}
+
+func newCassetteBody(data []byte) CassetteBody {
+	if utf8.Valid(data) {
+		return CassetteBody{Body: string(data)}
+	}
+	return CassetteBody{BinaryBody: data}
+}
+
+func (b CassetteBody) bytes() []byte {
+	if b.BinaryBody != nil {
+		return b.BinaryBody
+	}
+	return []byte(b.Body)
+}
+
+func scrubHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range scrubbedHeaders {
+		if h.Get(name) != "" {
+			h.Set(name, redactedValue)
+		}
+	}
+	return h
+}
+
+// interactionKey matches a request with a recorded one. The host and the
+// GitHub Enterprise Server prefix are ignored, so that a cassette can be
+// replayed without --host.
+func interactionKey(method, rawURL string) string {
+	u := rawURL
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+		if j := strings.Index(u, "/"); j >= 0 {
+			u = u[j:]
+		} else {
+			u = "/"
+		}
+	}
+	u = strings.TrimPrefix(u, "/api/v3")
+	return method + " " + u
+}
+
+// cassetteRecorderTransport appends every request and response to a
+// cassette file. The file is written as requests are made, so that it is
+// complete even if the command exits with log.Fatal.
+type cassetteRecorderTransport struct {
+	base http.RoundTripper
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// recordingTransport wraps base with the cassette recorder of --record.
+func recordingTransport(base http.RoundTripper) (http.RoundTripper, error) {
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+	if cassetteRecorder == nil {
+		f, err := os.OpenFile(recordCassette, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		cassetteRecorder = &cassetteRecorderTransport{base: base, f: f}
+	}
+	return cassetteRecorder, nil
+}
+
+func (t *cassetteRecorderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		data, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = data
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(data))
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	if err := t.write(Interaction{
+		Request: CassetteRequest{
+			Method:       req.Method,
+			URL:          req.URL.String(),
+			Header:       scrubHeader(req.Header),
+			CassetteBody: newCassetteBody(reqBody),
+		},
+		Response: CassetteResponse{
+			StatusCode:   resp.StatusCode,
+			Header:       scrubHeader(resp.Header),
+			CassetteBody: newCassetteBody(respBody),
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record %s %s: %w", req.Method, req.URL, err)
+	}
+	return resp, nil
+}
+
+func (t *cassetteRecorderTransport) write(in Interaction) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err = t.f.Write(append(data, '\n'))
+	return err
+}
+
+// cassettePlayerTransport serves the responses of a cassette instead of
+// calling GitHub. Requests are matched by method and URL; recorded
+// interactions with the same key are served in the order they were
+// recorded.
+type cassettePlayerTransport struct {
+	mu    sync.Mutex
+	queue map[string][]Interaction
+}
+
+// replayingTransport returns the cassette player of --replay.
+func replayingTransport() (http.RoundTripper, error) {
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+	if cassettePlayer == nil {
+		p, err := loadCassette(replayCassette)
+		if err != nil {
+			return nil, err
+		}
+		cassettePlayer = p
+	}
+	return cassettePlayer, nil
+}
+
+func loadCassette(filename string) (*cassettePlayerTransport, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	p := &cassettePlayerTransport{queue: map[string][]Interaction{}}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<30)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var in Interaction
+		if err := json.Unmarshal(sc.Bytes(), &in); err != nil {
+			return nil, fmt.Errorf("invalid cassette %s line %d: %w", filename, line, err)
+		}
+		key := interactionKey(in.Request.Method, in.Request.URL)
+		p.queue[key] = append(p.queue[key], in)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *cassettePlayerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+
+	key := interactionKey(req.Method, req.URL.String())
+	p.mu.Lock()
+	queue := p.queue[key]
+	if len(queue) == 0 {
+		p.mu.Unlock()
+		return nil, errors.New("cassette has no recorded response for " + key)
+	}
+	in := queue[0]
+	p.queue[key] = queue[1:]
+	p.mu.Unlock()
+
+	body := in.Response.bytes()
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+		StatusCode:    in.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        in.Response.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,165 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/appscodelabs/gh-tools/internal/fakegithub"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	defer func(rec, rep string) {
+		recordCassette, replayCassette = rec, rep
+		cassetteRecorder, cassettePlayer = nil, nil
+	}(recordCassette, replayCassette)
+
+	srv := fakegithub.NewServer()
+	defer srv.Close()
+	srv.AddRepo("kubedb", "mysql").AddRelease("v1.0.0", nil)
+	releaseID := srv.Repo("kubedb", "mysql").Releases()[0].GetID()
+	asset := []byte{0xff, 0x00, 0xfe}
+
+	// calls returns the outcome of the same API calls against any client
+	calls := func(client *github.Client) []string {
+		ctx := context.Background()
+		var out []string
+		repo, _, err := client.Repositories.Get(ctx, "kubedb", "mysql")
+		out = append(out, repo.GetFullName(), errString(err))
+		for range 2 {
+			_, resp, err := client.Issues.CreateLabel(ctx, "kubedb", "mysql", &github.Label{Name: github.Ptr("automerge")})
+			out = append(out, resp.Status, errString(err))
+		}
+		f := filepath.Join(t.TempDir(), "asset.bin")
+		if err := os.WriteFile(f, asset, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = file.Close() }()
+		a, _, err := client.Repositories.UploadReleaseAsset(ctx, "kubedb", "mysql", releaseID, &github.UploadOptions{Name: "asset.bin"}, file)
+		out = append(out, a.GetName(), errString(err))
+		return out
+	}
+
+	recordCassette = filepath.Join(t.TempDir(), "cassette.jsonl")
+	rec, err := recordingTransport(http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := github.NewClient(&http.Client{Transport: &oauth2.Transport{
+		Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "secret-token"}),
+		Base:   rec,
+	}})
+	client.BaseURL, client.UploadURL = srv.Client().BaseURL, srv.Client().UploadURL
+	recorded := calls(client)
+	assert.Equal(t, "kubedb/mysql", recorded[0])
+	assert.Equal(t, "422 Unprocessable Entity: Validation Failed", recorded[5])
+
+	data, err := os.ReadFile(recordCassette)
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(data, []byte("secret-token")), "Authorization is scrubbed")
+	assert.True(t, bytes.Contains(data, []byte(redactedValue)))
+
+	// replay against a different host, without GitHub or a token
+	srv.Close()
+	replayCassette = recordCassette
+	player, err := replayingTransport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayClient, err := github.NewClient(&http.Client{Transport: player}).WithEnterpriseURLs("https://ghe.example.com", "https://ghe.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayClient.UploadURL, _ = url.Parse("https://ghe.example.com/uploads/")
+	assert.Equal(t, recorded, calls(replayClient))
+
+	_, _, err = replayClient.Repositories.Get(context.Background(), "kubedb", "mysql")
+	assert.ErrorContains(t, err, "no recorded response for GET /repos/kubedb/mysql")
+}
+
+func TestReplayDoesNotWaitForRecordedRetries(t *testing.T) {
+	captureLog(t)
+	defer func(rep string) {
+		replayCassette = rep
+		cassettePlayer = nil
+	}(replayCassette)
+
+	replayCassette = filepath.Join(t.TempDir(), "cassette.jsonl")
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, in := range []Interaction{
+		{
+			Request: CassetteRequest{Method: http.MethodGet, URL: "https://api.github.com/repos/kubedb/mysql"},
+			Response: CassetteResponse{
+				StatusCode:   http.StatusTooManyRequests,
+				Header:       http.Header{"Retry-After": {"3600"}},
+				CassetteBody: CassetteBody{Body: `{"message":"You have exceeded a secondary rate limit"}`},
+			},
+		},
+		{
+			Request: CassetteRequest{Method: http.MethodGet, URL: "https://api.github.com/repos/kubedb/mysql"},
+			Response: CassetteResponse{
+				StatusCode:   http.StatusOK,
+				CassetteBody: CassetteBody{Body: `{"full_name":"kubedb/mysql"}`},
+			},
+		},
+	} {
+		assert.NoError(t, enc.Encode(in))
+	}
+	if err := os.WriteFile(replayCassette, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	player, err := replayingTransport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := github.NewClient(&http.Client{Transport: outerTransport(player)})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repo, _, err := client.Repositories.Get(ctx, "kubedb", "mysql")
+	assert.NoError(t, err)
+	assert.Equal(t, "kubedb/mysql", repo.GetFullName())
+}
+
+// errString describes err without the request URL, which differs between
+// recording and replay.
+func errString(err error) string {
+	if e, ok := err.(*github.ErrorResponse); ok {
+		return e.Response.Status + ": " + e.Message
+	}
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
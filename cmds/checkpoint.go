@@ -0,0 +1,138 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+	"gomodules.xyz/sets"
+)
+
+// checkpointFile is the --checkpoint file, where fleet commands record every
+// repo they finished, so that a rerun can resume where the last run stopped.
+var checkpointFile string
+
+// CheckpointEntry records the outcome of a repo processed by runFleet.
+type CheckpointEntry struct {
+	Time time.Time `json:"time"`
+	RepoResult
+}
+
+// checkpoint is an open --checkpoint file. A nil checkpoint records nothing.
+type checkpoint struct {
+	f    *os.File
+	done sets.String
+}
+
+// openCheckpoint reads the repos completed by earlier runs from filename and
+// opens it for appending. It returns nil if filename is empty.
+func openCheckpoint(filename string) (*checkpoint, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	done, err := parseCheckpoint(filename, data)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		// start after the incomplete last line
+		if _, err := f.Write([]byte("\n")); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	return &checkpoint{f: f, done: done}, nil
+}
+
+// parseCheckpoint returns the repos whose last recorded outcome is a success.
+// Skipped repos are retried like failed ones, since the reason they were
+// skipped, for example a missing permission, may be gone by the next run.
+func parseCheckpoint(filename string, data []byte) (sets.String, error) {
+	done := sets.NewString()
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var e CheckpointEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			if i == len(lines)-1 {
+				// the last line was cut short when the previous run was killed
+				log.Printf("Ignoring incomplete last line of checkpoint %s", filename)
+				break
+			}
+			return nil, fmt.Errorf("invalid checkpoint %s line %d: %w", filename, i+1, err)
+		}
+		if e.Outcome == outcomeOK {
+			done.Insert(e.Repo)
+		} else {
+			done.Delete(e.Repo)
+		}
+	}
+	return done, nil
+}
+
+// pending returns the repos not completed by an earlier run.
+func (c *checkpoint) pending(repos []*github.Repository) []*github.Repository {
+	if c == nil || c.done.Len() == 0 {
+		return repos
+	}
+	out := make([]*github.Repository, 0, len(repos))
+	for _, repo := range repos {
+		if !c.done.Has(repo.GetFullName()) {
+			out = append(out, repo)
+		}
+	}
+	log.Printf("Skipping %d repositories completed according to checkpoint %s", len(repos)-len(out), c.f.Name())
+	return out
+}
+
+// record appends the result of a repo to the checkpoint.
+func (c *checkpoint) record(r RepoResult) error {
+	if c == nil {
+		return nil
+	}
+	data, err := json.Marshal(CheckpointEntry{Time: time.Now().UTC(), RepoResult: r})
+	if err != nil {
+		return err
+	}
+	if _, err := c.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (c *checkpoint) close() {
+	if c != nil {
+		_ = c.f.Close()
+	}
+}
@@ -18,4 +18,9 @@ package cmds
 
 const (
 	OwnerTypeUser = "User"
+	OwnerTypeOrg  = "Organization"
 )
+
+// regexPatternPrefix marks a branch pattern or a repo selector pattern as a
+// regular expression.
+const regexPatternPrefix = "re:"
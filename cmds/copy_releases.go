@@ -39,6 +39,7 @@ func NewCmdCopyRelease() *cobra.Command {
 		Use:               "copy-release",
 		Short:             "Copy releases from one GitHub repo to another repo",
 		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			flags.PrintFlags(c.Flags())
 		},
@@ -119,20 +120,22 @@ func copyRelease(src, dest string) {
 
 			fmt.Println(asset.GetBrowserDownloadURL())
 
-			dir := filepath.Join("/tmp", "github.com", srcOwner, srcRepo, srcRelease.GetTagName())
+			dir := filepath.Join("/tmp", gitHost(), srcOwner, srcRepo, srcRelease.GetTagName())
 			if err = os.MkdirAll(dir, 0o755); err != nil {
 				log.Fatalln(err)
 			}
 			buf.Reset()
 
-			resp, err := http.Get(asset.GetBrowserDownloadURL())
+			// download through the API, so that assets of private repos and
+			// GitHub Enterprise Server can be read
+			rc, _, err := client.Repositories.DownloadReleaseAsset(ctx, srcOwner, srcRepo, asset.GetID(), http.DefaultClient)
 			if err != nil {
 				log.Fatalln(err)
 			}
-			if _, err = io.Copy(&buf, resp.Body); err != nil {
+			if _, err = io.Copy(&buf, rc); err != nil {
 				log.Fatalln(err)
 			}
-			_ = resp.Body.Close()
+			_ = rc.Close()
 
 			if err = os.WriteFile(filepath.Join(dir, asset.GetName()), buf.Bytes(), 0o644); err != nil {
 				log.Fatalln(err)
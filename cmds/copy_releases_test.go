@@ -0,0 +1,50 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyRelease(t *testing.T) {
+	srv, _ := useFakeGitHub(t)
+	src := srv.AddRepo("fake-copy-release", "src")
+	src.AddRelease("v0.1.0", map[string][]byte{"a.txt": []byte("a1"), "b.txt": []byte("b1")})
+	src.AddRelease("v0.2.0", map[string][]byte{"a.txt": []byte("a2")})
+	dest := srv.AddRepo("fake-copy-release", "dest")
+	dest.AddRelease("v0.1.0", map[string][]byte{"a.txt": []byte("kept")})
+
+	copyRelease("fake-copy-release/src", "fake-copy-release/dest")
+
+	var tags []string
+	for _, rel := range dest.Releases() {
+		tags = append(tags, rel.GetTagName())
+	}
+	assert.ElementsMatch(t, []string{"v0.1.0", "v0.2.0"}, tags)
+
+	for _, tc := range []struct{ tag, name, data string }{
+		{"v0.1.0", "a.txt", "kept"},
+		{"v0.1.0", "b.txt", "b1"},
+		{"v0.2.0", "a.txt", "a2"},
+	} {
+		data, ok := dest.AssetData(tc.tag, tc.name)
+		assert.True(t, ok, "%s/%s", tc.tag, tc.name)
+		assert.Equal(t, tc.data, string(data), "%s/%s", tc.tag, tc.name)
+	}
+}
@@ -40,6 +40,7 @@ func NewCmdDeletePackage() *cobra.Command {
 		Use:               "delete-package",
 		Short:             "Delete packages from ghcr.io",
 		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("read:packages", "delete:packages"),
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			flags.PrintFlags(c.Flags())
 		},
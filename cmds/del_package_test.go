@@ -0,0 +1,62 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteAllOrgPackages(t *testing.T) {
+	srv, client := useFakeGitHub(t)
+	srv.AddPackage("kubedb", "container", "mysql", "public")
+	srv.AddPackage("kubedb", "container", "redis", "private")
+	srv.AddPackage("kubedb", "npm", "ui", "public")
+
+	deleteAllOrgPackages(context.Background(), client, "kubedb")
+
+	var names []string
+	for _, pkg := range srv.Packages("kubedb") {
+		names = append(names, pkg.GetName())
+	}
+	assert.Equal(t, []string{"ui"}, names, "only container packages are deleted")
+}
+
+func TestDeletePackageVersion(t *testing.T) {
+	srv, client := useFakeGitHub(t)
+	version := func(tags ...string) *github.PackageVersion {
+		md, err := json.Marshal(github.PackageMetadata{Container: &github.PackageContainerMetadata{Tags: tags}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &github.PackageVersion{Metadata: md}
+	}
+	srv.AddPackage("kubedb", "container", "mysql", "public", version("8.0", "8.0.35"), version("8.4"))
+
+	deletePackageVersion(context.Background(), client, "kubedb", "mysql", "8.0.35")
+
+	versions := srv.PackageVersions("kubedb", "container", "mysql")
+	if assert.Len(t, versions, 1) {
+		var md github.PackageMetadata
+		assert.NoError(t, json.Unmarshal(versions[0].Metadata, &md))
+		assert.Equal(t, []string{"8.4"}, md.Container.Tags)
+	}
+}
@@ -33,6 +33,7 @@ func NewCmdDeleteRelease() *cobra.Command {
 		Use:               "delete-release",
 		Short:             "Delete releases from one GitHub repo",
 		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			flags.PrintFlags(c.Flags())
 		},
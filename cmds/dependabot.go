@@ -37,6 +37,7 @@ func NewCmdDependabot() *cobra.Command {
 		Use:               "dependabot",
 		Short:             "Enable/disable Dependabot alerts",
 		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			flags.PrintFlags(c.Flags())
 		},
@@ -49,19 +50,23 @@ func NewCmdDependabot() *cobra.Command {
 	cmd.Flags().BoolVar(&fork, "fork", fork, "If true, return forked repos")
 	cmd.Flags().BoolVar(&enableDependabot, "enable", enableDependabot, "If true, activates Dependabot alerts")
 	cmd.Flags().BoolVar(&enableSecurityFixes, "autofix", enableSecurityFixes, "If true, enables automatic security fixes")
+	addRepoSelectorFlag(cmd)
 	return cmd
 }
 
 func addDependabot() {
+	sel, err := newRepoSelector(defaultRepoTerms(fork, "owner-type=organization"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	ctx := context.Background()
 	client := newGitHubClient(ctx)
 
 	// Get the current user
-	user, _, err := client.Users.Get(ctx, "")
-	if err != nil {
+	if err := logCurrentUser(ctx, client); err != nil {
 		log.Fatal(err)
 	}
-	log.Println("user: ", user.GetLogin())
 
 	{
 		opt := &github.ListOptions{PerPage: 50}
@@ -83,30 +88,29 @@ func addDependabot() {
 			Affiliation: "owner,organization_member",
 			ListOptions: github.ListOptions{PerPage: 50},
 		}
-		repos, err := ListRepos(ctx, client, opt, fork)
+		repos, err := ListRepos(ctx, client, opt, sel)
 		if err != nil {
 			log.Fatal(err)
 		}
 		log.Printf("Found %d repositories", len(repos))
-		for _, repo := range repos {
-			if repo.GetOwner().GetType() == OwnerTypeUser {
-				continue
-			}
+		warnRateBudget(ctx, client, len(repos), 4)
+		err = runFleet(ctx, repos, func(ctx context.Context, repo *github.Repository) error {
 			//if repo.GetPrivate() {
-			//	continue
+			//	return nil
 			//}
 			if repo.GetPermissions().GetAdmin() {
-				err = processDependabot(ctx, client, repo)
-				if err != nil {
-					log.Fatalln(err)
-				}
+				return processDependabot(ctx, client, repo)
 			}
+			return skipRepo("no admin permission")
+		})
+		if err != nil {
+			log.Fatalln(err)
 		}
 	}
 }
 
 func processDependabot(ctx context.Context, client *github.Client, repo *github.Repository) error {
-	fmt.Println("[___]>", repo.Owner.GetLogin()+"/"+repo.GetName())
+	printf(ctx, "[___]> %s\n", repo.Owner.GetLogin()+"/"+repo.GetName())
 
 	if enableDependabot {
 		if _, err := client.Repositories.EnableVulnerabilityAlerts(ctx, repo.Owner.GetLogin(), repo.GetName()); err != nil {
@@ -0,0 +1,305 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/spf13/cobra"
+	"gomodules.xyz/flags"
+)
+
+type checkOutcome int
+
+const (
+	checkPending checkOutcome = iota
+	checkPassed
+	checkFailed
+	checkIgnored
+)
+
+var (
+	discoverChecks  bool
+	discoverCommits = 10
+
+	// discoveredChecks caches the discovered checks by owner/repo, so that
+	// all branches of a repo are protected with the same checks.
+	discoveredChecks   = map[string][]string{}
+	discoveredChecksMu sync.Mutex
+)
+
+func addDiscoverChecksFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&discoverChecks, "discover-checks", discoverChecks, "If true, require the checks that consistently passed on recent commits of the default branch instead of the checks in the policy")
+	cmd.Flags().IntVar(&discoverCommits, "discover-commits", discoverCommits, "Number of recent commits of the default branch used by --discover-checks")
+}
+
+func NewCmdDiscoverChecks() *cobra.Command {
+	var (
+		owner   string
+		repo    string
+		commits = discoverCommits
+	)
+	cmd := &cobra.Command{
+		Use:               "discover-checks",
+		Short:             "Print the checks that consistently passed on recent commits of the default branch",
+		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
+		PersistentPreRun: func(c *cobra.Command, args []string) {
+			flags.PrintFlags(c.Flags())
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			runDiscoverChecks(owner, repo, commits)
+		},
+	}
+	cmd.Flags().StringVar(&owner, "owner", owner, "GitHub user or org name")
+	cmd.Flags().StringVar(&repo, "repo", repo, "GitHub repository name")
+	cmd.Flags().IntVar(&commits, "commits", commits, "Number of recent commits of the default branch to inspect")
+	_ = cmd.MarkFlagRequired("owner")
+	_ = cmd.MarkFlagRequired("repo")
+	return cmd
+}
+
+func runDiscoverChecks(owner, repo string, commits int) {
+	ctx := context.Background()
+	client := newGitHubClient(ctx)
+
+	checks, err := DiscoverChecks(ctx, client, owner, repo, commits)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(checks) == 0 {
+		log.Printf("no consistently passing checks found in the last %d commits of %s/%s", commits, owner, repo)
+		return
+	}
+	for _, c := range checks {
+		fmt.Println(c)
+	}
+}
+
+// DiscoverChecks returns the check run and commit status contexts that
+// passed on every one of the latest n commits of the default branch that has
+// results. A context that failed, is pending or is missing on any of them is
+// not required. A repo without commits has no checks.
+func DiscoverChecks(ctx context.Context, client *github.Client, owner, repo string, n int) ([]string, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("number of commits must be positive, found %d", n)
+	}
+	commits, _, err := client.Repositories.ListCommits(ctx, owner, repo, &github.CommitsListOptions{
+		ListOptions: github.ListOptions{PerPage: n},
+	})
+	if e, ok := err.(*github.ErrorResponse); ok && e.Response.StatusCode == http.StatusConflict {
+		// the repository is empty
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	results := make([]map[string]checkOutcome, 0, len(commits))
+	for _, commit := range commits {
+		outcomes, err := commitCheckOutcomes(ctx, client, owner, repo, commit.GetSHA())
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, outcomes)
+	}
+	return selectPassingChecks(ctx, results), nil
+}
+
+// precedence orders the outcomes of a context reported more than once for a
+// commit: failed wins over passed, passed over pending and pending over
+// ignored.
+func (o checkOutcome) precedence() int {
+	switch o {
+	case checkFailed:
+		return 3
+	case checkPassed:
+		return 2
+	case checkPending:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// recordCheckOutcome sets the outcome of name in out, unless an outcome of
+// higher precedence was recorded before.
+func recordCheckOutcome(out map[string]checkOutcome, name string, o checkOutcome) {
+	if cur, ok := out[name]; !ok || o.precedence() > cur.precedence() {
+		out[name] = o
+	}
+}
+
+// commitCheckOutcomes collects the outcome of every check run and commit
+// status reported for ref. If a context is reported more than once, the
+// outcome with the highest precedence wins, so a failure is never hidden by
+// a pass or a skipped run.
+func commitCheckOutcomes(ctx context.Context, client *github.Client, owner, repo, ref string) (map[string]checkOutcome, error) {
+	out := map[string]checkOutcome{}
+
+	runOpt := &github.ListCheckRunsOptions{
+		Filter:      github.Ptr("latest"),
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		result, resp, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, ref, runOpt)
+		if err != nil {
+			return nil, err
+		}
+		for _, run := range result.CheckRuns {
+			recordCheckOutcome(out, run.GetName(), checkRunOutcome(run))
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		runOpt.Page = resp.NextPage
+	}
+
+	statusOpt := &github.ListOptions{PerPage: 100}
+	for {
+		status, resp, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, ref, statusOpt)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range status.Statuses {
+			recordCheckOutcome(out, s.GetContext(), commitStatusOutcome(s.GetState()))
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		statusOpt.Page = resp.NextPage
+	}
+	return out, nil
+}
+
+func checkRunOutcome(run *github.CheckRun) checkOutcome {
+	if run.GetStatus() != "completed" {
+		return checkPending
+	}
+	switch run.GetConclusion() {
+	case "success":
+		return checkPassed
+	case "neutral", "skipped":
+		return checkIgnored
+	default:
+		return checkFailed
+	}
+}
+
+func commitStatusOutcome(state string) checkOutcome {
+	switch state {
+	case "success":
+		return checkPassed
+	case "pending":
+		return checkPending
+	default:
+		return checkFailed
+	}
+}
+
+// selectPassingChecks picks the contexts to require from the outcomes of
+// recent commits, ordered from newest to oldest. Commits without any results
+// are skipped, the others must all report the context as passed.
+func selectPassingChecks(ctx context.Context, results []map[string]checkOutcome) []string {
+	var reported []map[string]checkOutcome
+	for _, r := range results {
+		if len(r) > 0 {
+			reported = append(reported, r)
+		}
+	}
+	if len(reported) == 0 {
+		return nil
+	}
+
+	var checks []string
+	for name := range reported[0] {
+		passed, failed := 0, 0
+		for _, r := range reported {
+			switch r[name] {
+			case checkPassed:
+				passed++
+			case checkFailed:
+				failed++
+			}
+		}
+		if passed == len(reported) {
+			checks = append(checks, name)
+		} else if failed > 0 {
+			logf(ctx, "not requiring check %q: failed on %d of the last %d commits", name, failed, len(reported))
+		} else {
+			logf(ctx, "not requiring check %q: passed on %d of the last %d commits", name, passed, len(reported))
+		}
+	}
+	sort.Strings(checks)
+	return checks
+}
+
+// repoDiscoveredChecks runs DiscoverChecks once per repo and caches the result.
+func repoDiscoveredChecks(ctx context.Context, client *github.Client, owner, repo string) ([]string, error) {
+	key := owner + "/" + repo
+	discoveredChecksMu.Lock()
+	checks, ok := discoveredChecks[key]
+	discoveredChecksMu.Unlock()
+	if ok {
+		return checks, nil
+	}
+	checks, err := DiscoverChecks(ctx, client, owner, repo, discoverCommits)
+	if err != nil {
+		return nil, err
+	}
+	if len(checks) == 0 {
+		logf(ctx, "no consistently passing checks found for %s, using checks from the policy", key)
+	} else {
+		logf(ctx, "discovered checks for %s: %v", key, checks)
+	}
+	discoveredChecksMu.Lock()
+	discoveredChecks[key] = checks
+	discoveredChecksMu.Unlock()
+	return checks, nil
+}
+
+// branchProtectionRequest returns the protection request for a branch from
+// the policy. With --discover-checks, the required checks are replaced by the
+// checks discovered for the repo.
+func branchProtectionRequest(ctx context.Context, client *github.Client, owner, repo, branch string) (*github.ProtectionRequest, error) {
+	policy, err := currentProtectionPolicy()
+	if err != nil {
+		return nil, err
+	}
+	p := policy.ProtectionRequest(owner, repo, branch)
+	if !discoverChecks {
+		return p, nil
+	}
+
+	checks, err := repoDiscoveredChecks(ctx, client, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	if len(checks) > 0 && p.RequiredStatusChecks != nil {
+		required := make([]*github.RequiredStatusCheck, 0, len(checks))
+		for _, c := range checks {
+			required = append(required, &github.RequiredStatusCheck{Context: c})
+		}
+		p.RequiredStatusChecks.Checks = &required
+	}
+	return p, nil
+}
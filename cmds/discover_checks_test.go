@@ -0,0 +1,97 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectPassingChecks(t *testing.T) {
+	results := []map[string]checkOutcome{
+		{}, // newest commit has no results yet
+		{"Build": checkPassed, "DCO": checkPassed, "Kubernetes (v1.35.0)": checkPending, "Lint": checkFailed},
+		{"Build": checkPassed, "DCO": checkPassed, "Kubernetes (v1.35.0)": checkPassed, "Lint": checkPassed, "Kubernetes (v1.28.0)": checkPassed},
+		{"Build": checkPassed, "Docs": checkIgnored},
+	}
+	// DCO is missing, Kubernetes (v1.35.0) pending and Lint failed on one of the commits with results
+	assert.Equal(t, []string{"Build"}, selectPassingChecks(context.TODO(), results))
+
+	results = []map[string]checkOutcome{
+		{"Build": checkPassed, "DCO": checkPassed},
+		{"Build": checkPassed, "DCO": checkPassed},
+	}
+	assert.Equal(t, []string{"Build", "DCO"}, selectPassingChecks(context.TODO(), results))
+
+	assert.Empty(t, selectPassingChecks(context.TODO(), nil))
+	assert.Empty(t, selectPassingChecks(context.TODO(), []map[string]checkOutcome{{}, {}}))
+}
+
+func TestDiscoverChecksEmptyRepo(t *testing.T) {
+	defer func(b bool) { discoverChecks = b }(discoverChecks)
+	discoverChecks = true
+
+	srv, client := useFakeGitHub(t)
+	srv.AddOrg("kubedb")
+	repo := srv.AddRepo("kubedb", "empty").Empty().Repository()
+
+	ctx := context.Background()
+	checks, err := DiscoverChecks(ctx, client, "kubedb", "empty", discoverCommits)
+	assert.NoError(t, err)
+	assert.Empty(t, checks)
+	assert.NoError(t, ProtectRepo(ctx, client, repo))
+}
+
+func TestCheckRunOutcome(t *testing.T) {
+	run := func(status, conclusion string) *github.CheckRun {
+		return &github.CheckRun{Status: github.Ptr(status), Conclusion: github.Ptr(conclusion)}
+	}
+	assert.Equal(t, checkPassed, checkRunOutcome(run("completed", "success")))
+	assert.Equal(t, checkFailed, checkRunOutcome(run("completed", "timed_out")))
+	assert.Equal(t, checkIgnored, checkRunOutcome(run("completed", "skipped")))
+	assert.Equal(t, checkPending, checkRunOutcome(run("in_progress", "")))
+}
+
+func TestRecordCheckOutcome(t *testing.T) {
+	tests := []struct {
+		outcomes []checkOutcome
+		want     checkOutcome
+	}{
+		{[]checkOutcome{checkIgnored, checkFailed}, checkFailed},
+		{[]checkOutcome{checkFailed, checkIgnored}, checkFailed},
+		{[]checkOutcome{checkPassed, checkIgnored}, checkPassed},
+		{[]checkOutcome{checkIgnored, checkPassed}, checkPassed},
+		{[]checkOutcome{checkPassed, checkFailed}, checkFailed},
+		{[]checkOutcome{checkFailed, checkPassed}, checkFailed},
+		{[]checkOutcome{checkPending, checkPassed}, checkPassed},
+		{[]checkOutcome{checkPassed, checkPending}, checkPassed},
+		{[]checkOutcome{checkIgnored, checkPending}, checkPending},
+		{[]checkOutcome{checkPending, checkIgnored}, checkPending},
+		{[]checkOutcome{checkIgnored, checkPassed, checkIgnored, checkFailed, checkPending}, checkFailed},
+		{[]checkOutcome{checkIgnored}, checkIgnored},
+	}
+	for _, tt := range tests {
+		out := map[string]checkOutcome{}
+		for _, o := range tt.outcomes {
+			recordCheckOutcome(out, "e2e", o)
+		}
+		assert.Equal(t, tt.want, out["e2e"], "%v", tt.outcomes)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/spf13/cobra"
+	"gomodules.xyz/flags"
+)
+
+func NewCmdDoctor() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "doctor",
+		Short:             "Check the credentials and the scopes each command needs",
+		DisableAutoGenTag: true,
+		PersistentPreRun: func(c *cobra.Command, args []string) {
+			flags.PrintFlags(c.Flags())
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			runDoctor(cmd.Root())
+		},
+	}
+	return cmd
+}
+
+func runDoctor(root *cobra.Command) {
+	ctx := context.Background()
+	client := newGitHubClient(ctx)
+
+	if err := logCurrentUser(ctx, client); err != nil {
+		log.Fatalln(err)
+	}
+	creds, err := loadCredentialScopes(ctx, client)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := printDoctorReport(os.Stdout, creds, scopedCommands(root)); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// scopedCommands returns the commands under root that declare the scopes
+// they need, sorted by path.
+func scopedCommands(root *cobra.Command) []*cobra.Command {
+	var out []*cobra.Command
+	var walk func(c *cobra.Command)
+	walk = func(c *cobra.Command) {
+		if len(commandScopes(c)) > 0 {
+			out = append(out, c)
+		}
+		for _, sub := range c.Commands() {
+			walk(sub)
+		}
+	}
+	walk(root)
+	sort.Slice(out, func(i, j int) bool { return out[i].CommandPath() < out[j].CommandPath() })
+	return out
+}
+
+func printDoctorReport(w io.Writer, creds *credentialScopes, commands []*cobra.Command) error {
+	host := gitHost()
+	profile := profileName
+	if profile == "" {
+		profile = "(none)"
+	}
+	_, _ = fmt.Fprintf(w, "Host:         %s\n", host)
+	_, _ = fmt.Fprintf(w, "Profile:      %s\n", profile)
+	_, _ = fmt.Fprintf(w, "Credentials:  %s\n", creds.kind)
+	switch creds.kind {
+	case credentialsClassic:
+		_, _ = fmt.Fprintf(w, "Scopes:       %s\n", strings.Join(creds.scopes.List(), ", "))
+	case credentialsApp:
+		for _, inst := range creds.installations {
+			_, _ = fmt.Fprintf(w, "Installation: %s (%d)\n", inst.GetAccount().GetLogin(), inst.GetID())
+		}
+	}
+	if creds.rateLimits != nil {
+		for _, rl := range []struct {
+			resource string
+			rate     *github.Rate
+		}{
+			{rateResourceCore, creds.rateLimits.GetCore()},
+			{rateResourceGraphQL, creds.rateLimits.GetGraphQL()},
+		} {
+			if rl.rate != nil {
+				_, _ = fmt.Fprintf(w, "Rate limit:   %s %d/%d\n", rl.resource, rl.rate.Remaining, rl.rate.Limit)
+			}
+		}
+	}
+	_, _ = fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "COMMAND\tNEEDS\tSTATUS")
+	for _, c := range commands {
+		required := commandScopes(c)
+		status := "ok"
+		if !creds.checkable() {
+			status = "unknown"
+		} else if missing := creds.missing(required); len(missing) > 0 {
+			status = "missing " + strings.Join(missing, ", ")
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", c.CommandPath(), strings.Join(required, ", "), status)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,120 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// globalDryRun is set by --dry-run. Unlike --dryrun of the protect commands,
+// it works for every command, since mutating requests are intercepted by the
+// HTTP transport.
+var globalDryRun bool
+
+// dryRunTransport logs mutating requests instead of sending them and answers
+// them with a synthetic success. Other requests are sent as usual, so that
+// commands still see the real state of GitHub.
+type dryRunTransport struct {
+	base http.RoundTripper
+}
+
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isMutatingMethod(req.Method) {
+		return t.base.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		data, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = data
+	}
+	logf(req.Context(), "[DRY-RUN] %s %s%s", req.Method, req.URL, describeBody(req.Header.Get("Content-Type"), body))
+	return dryRunResponse(req, body), nil
+}
+
+func describeBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if !json.Valid(body) {
+		if contentType == "" {
+			contentType = "unknown content type"
+		}
+		return fmt.Sprintf(" <%d bytes of %s>", len(body), contentType)
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, body); err != nil {
+		return " " + string(body)
+	}
+	return " " + buf.String()
+}
+
+// dryRunResponse returns the response used instead of sending req. POST
+// creates a resource, so the JSON body is echoed back with an id, which is
+// enough for commands that go on to use the created resource. PUT and PATCH
+// return an empty object, since their responses do not have the shape of the
+// request. DELETE returns no content.
+func dryRunResponse(req *http.Request, body []byte) *http.Response {
+	status := http.StatusOK
+	out := []byte("{}")
+	switch req.Method {
+	case http.MethodDelete:
+		status = http.StatusNoContent
+		out = nil
+	case http.MethodPost:
+		status = http.StatusCreated
+		out = []byte(`{"id":0}`)
+		var obj map[string]any
+		if json.Unmarshal(body, &obj) == nil && obj != nil {
+			if _, ok := obj["id"]; !ok {
+				obj["id"] = 0
+			}
+			if data, err := json.Marshal(obj); err == nil {
+				out = data
+			}
+		} else if strings.HasPrefix(strings.TrimSpace(string(body)), "[") {
+			out = []byte("[]")
+		}
+	}
+
+	h := http.Header{}
+	if out != nil {
+		h.Set("Content-Type", "application/json; charset=utf-8")
+		h.Set("Content-Length", strconv.Itoa(len(out)))
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(out)),
+		ContentLength: int64(len(out)),
+		Request:       req,
+	}
+}
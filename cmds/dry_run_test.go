@@ -0,0 +1,64 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunTransport(t *testing.T) {
+	srv, _ := useFakeGitHub(t)
+	fake := srv.AddRepo("kubedb", "mysql")
+	src := srv.AddRepo("kubedb", "src")
+	src.AddRelease("v1.0.0", map[string][]byte{"a.txt": []byte("a")})
+
+	client := github.NewClient(&http.Client{Transport: &dryRunTransport{base: http.DefaultTransport}})
+	client.BaseURL, client.UploadURL = srv.Client().BaseURL, srv.Client().UploadURL
+	newGitHubClient = func(context.Context) *github.Client { return client }
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	ctx := context.Background()
+	assert.NoError(t, AddLabelToRepo(ctx, client, fake.Repository()))
+	_, _, err := client.Repositories.UpdateBranchProtection(ctx, "kubedb", "mysql", "master", &github.ProtectionRequest{EnforceAdmins: true})
+	assert.NoError(t, err)
+	_, err = client.Repositories.RemoveBranchProtection(ctx, "kubedb", "mysql", "master")
+	assert.NoError(t, err)
+	// the release created by copy-release has an id, so that assets can be
+	// "uploaded" to it
+	copyRelease("kubedb/src", "kubedb/mysql")
+
+	assert.Empty(t, mutatingRequests(srv), "nothing is sent to GitHub")
+	assert.Empty(t, fake.Labels())
+	assert.Empty(t, fake.Releases())
+
+	out := buf.String()
+	assert.Contains(t, out, `[DRY-RUN] POST `+srv.URL+`/repos/kubedb/mysql/labels {"name":"automerge","color":"fef2c0"`)
+	assert.Contains(t, out, `[DRY-RUN] PUT `+srv.URL+`/repos/kubedb/mysql/branches/master/protection {"required_status_checks":null`)
+	assert.Contains(t, out, `[DRY-RUN] DELETE `+srv.URL+`/repos/kubedb/mysql/branches/master/protection`)
+	assert.Contains(t, out, `/releases/0/assets?name=a.txt <1 bytes of text/plain; charset=utf-8>`)
+}
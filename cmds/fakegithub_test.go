@@ -0,0 +1,60 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/appscodelabs/gh-tools/internal/fakegithub"
+
+	"github.com/google/go-github/v84/github"
+)
+
+// useFakeGitHub points newGitHubClient at a fake GitHub API for the duration
+// of the test and resets the caches that depend on the API.
+func useFakeGitHub(t *testing.T) (*fakegithub.Server, *github.Client) {
+	t.Helper()
+	srv := fakegithub.NewServer()
+	t.Cleanup(srv.Close)
+
+	oldClient := newGitHubClient
+	newGitHubClient = func(context.Context) *github.Client { return srv.Client() }
+	appIDsMu.Lock()
+	oldAppIDs := appIDs
+	appIDs = map[string]int64{}
+	appIDsMu.Unlock()
+	t.Cleanup(func() {
+		newGitHubClient = oldClient
+		appIDsMu.Lock()
+		appIDs = oldAppIDs
+		appIDsMu.Unlock()
+	})
+	return srv, srv.Client()
+}
+
+// mutatingRequests returns the requests served by srv that change state.
+func mutatingRequests(srv *fakegithub.Server) []string {
+	var out []string
+	for _, req := range srv.Requests() {
+		if !strings.HasPrefix(req, "GET ") {
+			out = append(out, req)
+		}
+	}
+	return out
+}
@@ -0,0 +1,221 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/go-github/v84/github"
+)
+
+// concurrency is the number of repos processed in parallel by fleet commands.
+var concurrency = 1
+
+type repoOutputKey struct{}
+
+// repoOutput buffers the output of a repo processed by runFleet, so that it
+// is not interleaved with the output of other repos.
+type repoOutput struct {
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+	logger *log.Logger
+}
+
+func newRepoOutput() *repoOutput {
+	o := &repoOutput{}
+	o.logger = log.New(&o.stderr, log.Prefix(), log.Flags())
+	return o
+}
+
+func (o *repoOutput) flush() {
+	_, _ = log.Writer().Write(o.stderr.Bytes())
+	_, _ = os.Stdout.Write(o.stdout.Bytes())
+}
+
+// printf writes to stdout, or to the output buffer of the repo being
+// processed by runFleet.
+func printf(ctx context.Context, format string, args ...any) {
+	if o, ok := ctx.Value(repoOutputKey{}).(*repoOutput); ok {
+		_, _ = fmt.Fprintf(&o.stdout, format, args...)
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+// logf logs like log.Printf, or to the output buffer of the repo being
+// processed by runFleet.
+func logf(ctx context.Context, format string, args ...any) {
+	if o, ok := ctx.Value(repoOutputKey{}).(*repoOutput); ok {
+		o.logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// runFleet calls fn for every repo, processing up to --concurrency repos at a
+// time. Output written with printf and logf is printed per repo, in the order
+// of repos. fn returns skipRepo for repos it leaves alone. A failed repo does
+// not stop the run; at the end a summary of the results is printed and an
+// error is returned if more repos failed than --max-failures allows.
+//
+// With --checkpoint, repos that succeeded in an earlier run are skipped and
+// the outcome of every repo is recorded. On SIGINT no more repos are started, so
+// that the checkpoint matches what was done; a second SIGINT exits at once.
+func runFleet(ctx context.Context, repos []*github.Repository, fn func(ctx context.Context, repo *github.Repository) error) error {
+	cp, err := openCheckpoint(checkpointFile)
+	if err != nil {
+		return err
+	}
+	defer cp.close()
+	repos = cp.pending(repos)
+
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	stopFleet := func() { stopOnce.Do(func() { close(stop) }) }
+
+	var interrupted atomic.Bool
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer signal.Stop(interrupts)
+		select {
+		case <-interrupts:
+			interrupted.Store(true)
+			log.Println("Interrupted, stopping after the repositories in progress")
+			stopFleet()
+		case <-done:
+		}
+	}()
+
+	var results fleetResults
+	// finish records the result of a repo, after its output was printed
+	finish := func(repo *github.Repository, err error) error {
+		r := newRepoResult(repo, err)
+		switch r.Outcome {
+		case outcomeSkipped:
+			log.Printf("Skipping %s (%s)", r.Repo, r.Reason)
+		case outcomeFailed:
+			log.Printf("Failed %s: %v", r.Repo, err)
+		}
+		results.add(r)
+		return cp.record(r)
+	}
+
+	workers := min(concurrency, len(repos))
+	if workers <= 1 {
+		for _, repo := range repos {
+			if interrupted.Load() {
+				break
+			}
+			if err = finish(repo, fn(ctx, repo)); err != nil {
+				break
+			}
+		}
+	} else {
+		err = runFleetParallel(ctx, repos, workers, stop, fn, func(repo *github.Repository, fnErr error) error {
+			if err := finish(repo, fnErr); err != nil {
+				stopFleet()
+				return err
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := results.printSummary(os.Stdout); err != nil {
+		return err
+	}
+	if resultsJSON != "" {
+		if err := results.writeJSON(resultsJSON); err != nil {
+			return err
+		}
+	}
+	if err := results.err(); err != nil {
+		return err
+	}
+	if n := len(results.results); interrupted.Load() && n < len(repos) {
+		if cp != nil {
+			return fmt.Errorf("interrupted after %d of %d repositories, rerun with the same --checkpoint to continue", n, len(repos))
+		}
+		return fmt.Errorf("interrupted after %d of %d repositories", n, len(repos))
+	}
+	return nil
+}
+
+// runFleetParallel calls fn for repos in workers goroutines until stop is
+// closed, and finish for every processed repo in the order of repos. It
+// returns the first error of finish.
+func runFleetParallel(ctx context.Context, repos []*github.Repository, workers int, stop <-chan struct{},
+	fn func(ctx context.Context, repo *github.Repository) error, finish func(repo *github.Repository, err error) error,
+) error {
+	type result struct {
+		out *repoOutput
+		err error
+	}
+	results := make([]chan result, len(repos))
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+
+	jobs := make(chan int)
+	for range workers {
+		go func() {
+			for i := range jobs {
+				out := newRepoOutput()
+				err := fn(context.WithValue(ctx, repoOutputKey{}, out), repos[i])
+				results[i] <- result{out: out, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range repos {
+			select {
+			case jobs <- i:
+			case <-stop:
+				for j := i; j < len(repos); j++ {
+					close(results[j])
+				}
+				return
+			}
+		}
+	}()
+
+	var firstErr error
+	for i := range repos {
+		r, ok := <-results[i]
+		if !ok {
+			continue // not started
+		}
+		r.out.flush()
+		if err := finish(repos[i], r.err); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,236 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRepos(n int) []*github.Repository {
+	repos := make([]*github.Repository, n)
+	for i := range repos {
+		repos[i] = &github.Repository{FullName: github.Ptr(fmt.Sprintf("org/repo-%d", i))}
+	}
+	return repos
+}
+
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	w, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(w)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+func TestRunFleetKeepsOutputOrdered(t *testing.T) {
+	buf := captureLog(t)
+	defer func(c int) { concurrency = c }(concurrency)
+	concurrency = 4
+
+	repos := testRepos(10)
+	index := map[string]int{}
+	for i, repo := range repos {
+		index[repo.GetFullName()] = i
+	}
+	err := runFleet(context.Background(), repos, func(ctx context.Context, repo *github.Repository) error {
+		logf(ctx, "start %s", repo.GetFullName())
+		// finish later repos first
+		time.Sleep(time.Duration(len(repos)-index[repo.GetFullName()]) * time.Millisecond)
+		logf(ctx, "end %s", repo.GetFullName())
+		return nil
+	})
+	assert.NoError(t, err)
+
+	var want strings.Builder
+	for _, repo := range repos {
+		_, _ = fmt.Fprintf(&want, "start %s\nend %s\n", repo.GetFullName(), repo.GetFullName())
+	}
+	assert.Equal(t, want.String(), buf.String())
+}
+
+func TestRunFleetCollectsResults(t *testing.T) {
+	captureLog(t)
+	defer func(c, m int, f string) { concurrency, maxFailures, resultsJSON = c, m, f }(concurrency, maxFailures, resultsJSON)
+
+	req, err := http.NewRequest(http.MethodPut, "https://api.github.com/repos/org/repo-2/branches/master/protection", nil)
+	assert.NoError(t, err)
+	errFailed := &github.ErrorResponse{
+		Response: &http.Response{StatusCode: http.StatusUnprocessableEntity, Request: req},
+		Message:  "Validation Failed",
+		Errors:   []github.Error{{Resource: "Branch", Field: "contexts", Code: "invalid"}},
+	}
+	fn := func(ctx context.Context, repo *github.Repository) error {
+		switch repo.GetFullName() {
+		case "org/repo-2":
+			return fmt.Errorf("protect: %w", errFailed)
+		case "org/repo-5":
+			return skipRepo("archived")
+		case "org/repo-7":
+			return errors.New("boom")
+		}
+		return nil
+	}
+
+	for _, c := range []int{1, 3} {
+		concurrency = c
+		maxFailures = 1
+		resultsJSON = filepath.Join(t.TempDir(), "results.json")
+
+		err := runFleet(context.Background(), testRepos(10), fn)
+		assert.EqualError(t, err, "2 of 10 repositories failed, more than --max-failures=1")
+
+		data, err := os.ReadFile(resultsJSON)
+		assert.NoError(t, err)
+		var results []RepoResult
+		assert.NoError(t, json.Unmarshal(data, &results))
+		if assert.Len(t, results, 10, "failures do not stop the run") {
+			assert.Equal(t, RepoResult{Repo: "org/repo-0", Outcome: outcomeOK}, results[0])
+			assert.Equal(t, RepoResult{Repo: "org/repo-2", Outcome: outcomeFailed, StatusCode: 422, Error: "protect: PUT https://api.github.com/repos/org/repo-2/branches/master/protection: 422 Validation Failed [{Resource:Branch Field:contexts Code:invalid Message:}]"}, results[2])
+			assert.Equal(t, RepoResult{Repo: "org/repo-5", Outcome: outcomeSkipped, Reason: "archived"}, results[5])
+			assert.Equal(t, RepoResult{Repo: "org/repo-7", Outcome: outcomeFailed, Error: "boom"}, results[7])
+		}
+
+		maxFailures = 2
+		assert.NoError(t, runFleet(context.Background(), testRepos(10), fn))
+	}
+}
+
+func TestPrintSummary(t *testing.T) {
+	var results fleetResults
+	results.add(RepoResult{Repo: "org/a", Outcome: outcomeOK})
+	results.add(RepoResult{Repo: "org/b", Outcome: outcomeSkipped, Reason: "archived"})
+	results.add(RepoResult{Repo: "org/long-name", Outcome: outcomeFailed, StatusCode: 403, Error: "Forbidden"})
+
+	var buf bytes.Buffer
+	assert.NoError(t, results.printSummary(&buf))
+	assert.Equal(t, `REPO           RESULT   STATUS  DETAIL
+org/b          skipped          archived
+org/long-name  failed   403     Forbidden
+1 succeeded, 1 skipped, 1 failed
+`, buf.String())
+}
+
+func TestRunFleetCheckpoint(t *testing.T) {
+	captureLog(t)
+	defer func(c int, f string) { concurrency, checkpointFile = c, f }(concurrency, checkpointFile)
+	concurrency = 1
+	checkpointFile = filepath.Join(t.TempDir(), "checkpoint.jsonl")
+
+	var runs []string
+	errFailed := errors.New("failed")
+	run := func(failing string) error {
+		runs = nil
+		return runFleet(context.Background(), testRepos(5), func(ctx context.Context, repo *github.Repository) error {
+			runs = append(runs, repo.GetFullName())
+			if repo.GetFullName() == failing {
+				return errFailed
+			}
+			return nil
+		})
+	}
+
+	assert.Error(t, run("org/repo-2"))
+	assert.Equal(t, []string{"org/repo-0", "org/repo-1", "org/repo-2", "org/repo-3", "org/repo-4"}, runs)
+
+	// completed repos are skipped, the failed one is retried
+	assert.NoError(t, run(""))
+	assert.Equal(t, []string{"org/repo-2"}, runs)
+
+	assert.NoError(t, run(""))
+	assert.Empty(t, runs)
+
+	data, err := os.ReadFile(checkpointFile)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, strings.Count(string(data), "\n"))
+	assert.Contains(t, string(data), `"repo":"org/repo-2","outcome":"failed","error":"failed"`)
+
+	// repos processed in parallel are recorded too
+	concurrency = 3
+	checkpointFile = filepath.Join(t.TempDir(), "parallel.jsonl")
+	var started atomic.Int32
+	count := func(ctx context.Context, repo *github.Repository) error {
+		started.Add(1)
+		return nil
+	}
+	assert.NoError(t, runFleet(context.Background(), testRepos(10), count))
+	assert.NoError(t, runFleet(context.Background(), testRepos(10), count))
+	assert.Equal(t, int32(10), started.Load())
+}
+
+func TestParseCheckpointIgnoresIncompleteLastLine(t *testing.T) {
+	captureLog(t)
+	data := []byte(`{"repo":"org/a","outcome":"ok"}` + "\n" +
+		`{"repo":"org/b","outcome":"ok"}` + "\n" +
+		`{"repo":"org/b","outcome":"failed"}` + "\n" +
+		`{"repo":"org/d","outcome":"skipped","reason":"no admin permission"}` + "\n" +
+		`{"repo":"org/e","outcome":"ok"}` + "\n" +
+		`{"repo":"org/e","outcome":"skipped","reason":"archived"}` + "\n" +
+		`{"repo":"org/c","outc`)
+	done, err := parseCheckpoint("checkpoint.jsonl", data)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org/a"}, done.List())
+
+	_, err = parseCheckpoint("checkpoint.jsonl", append([]byte(`{"repo":`+"\n"), data...))
+	assert.Error(t, err)
+}
+
+func TestRunFleetStopsOnInterrupt(t *testing.T) {
+	// the interrupt is logged while repo output is flushed, which is only
+	// safe for writers like os.Stderr
+	w := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(w)
+	defer func(c int) { concurrency = c }(concurrency)
+
+	for _, c := range []int{1, 3} {
+		concurrency = c
+		var started atomic.Int32
+		err := runFleet(context.Background(), testRepos(100), func(ctx context.Context, repo *github.Repository) error {
+			started.Add(1)
+			if repo.GetFullName() == "org/repo-2" {
+				assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGINT))
+			}
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "interrupted after")
+		}
+		assert.Less(t, started.Load(), int32(10))
+	}
+}
@@ -0,0 +1,497 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+)
+
+const (
+	// GitHub rejects app JWTs that are valid for more than 10 minutes.
+	appJWTLifetime = 9 * time.Minute
+	// installation tokens are valid for an hour and refreshed when they
+	// expire within installationTokenRefreshWindow.
+	installationTokenRefreshWindow = 5 * time.Minute
+)
+
+var (
+	githubAppID             int64
+	githubAppPrivateKeyFile string
+
+	// githubApp is set by newGitHubClient when authenticating as a GitHub App.
+	githubApp *appAuth
+)
+
+type installationIDKey struct{}
+
+// withInstallation makes requests made with ctx use the token of the given
+// installation, for endpoints like /installation/repositories that do not
+// name an owner.
+func withInstallation(ctx context.Context, id int64) context.Context {
+	return context.WithValue(ctx, installationIDKey{}, id)
+}
+
+// appCredentials returns the app id and private key from the --app-id and
+// --app-private-key flags, else from the app of a profile selected with
+// --profile, else from the GH_TOOLS_APP_ID and GH_TOOLS_APP_PRIVATE_KEY (PEM)
+// or GH_TOOLS_APP_PRIVATE_KEY_FILE env vars, else from the app of
+// currentProfile in the config file. It returns a zero app id if no app is
+// configured, or if the selected profile uses a token.
+func appCredentials() (int64, []byte, error) {
+	appID := githubAppID
+	if appID == 0 && profileOwnsCredentials() {
+		return profileAppCredentials()
+	}
+	if appID == 0 {
+		if v, ok := os.LookupEnv("GH_TOOLS_APP_ID"); ok && v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return 0, nil, fmt.Errorf("invalid GH_TOOLS_APP_ID %q: %w", v, err)
+			}
+			appID = id
+		}
+	}
+	if appID == 0 {
+		return profileAppCredentials()
+	}
+
+	keyFile := githubAppPrivateKeyFile
+	if keyFile == "" {
+		if pemData := os.Getenv("GH_TOOLS_APP_PRIVATE_KEY"); pemData != "" {
+			return appID, []byte(pemData), nil
+		}
+		keyFile = os.Getenv("GH_TOOLS_APP_PRIVATE_KEY_FILE")
+	}
+	if keyFile == "" {
+		return 0, nil, fmt.Errorf("private key of GitHub App %d is not set", appID)
+	}
+	pemData, err := os.ReadFile(keyFile)
+	if err != nil {
+		return 0, nil, err
+	}
+	return appID, pemData, nil
+}
+
+// profileAppCredentials returns the app id and private key of the selected
+// profile, or a zero app id if it has no app.
+func profileAppCredentials() (int64, []byte, error) {
+	if profile == nil || profile.App == nil {
+		return 0, nil, nil
+	}
+	pemData, err := os.ReadFile(expandHome(profile.App.PrivateKeyFile))
+	if err != nil {
+		return 0, nil, err
+	}
+	return profile.App.ID, pemData, nil
+}
+
+func parseRSAPrivateKey(pemData []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is a %T, expected an RSA key", key)
+	}
+	return rsaKey, nil
+}
+
+// appAuth authenticates as a GitHub App and mints installation tokens.
+type appAuth struct {
+	appID int64
+	key   *rsa.PrivateKey
+	// client makes app level calls authenticated with a JWT.
+	client *github.Client
+
+	installationsMu sync.Mutex
+	installations   []*github.Installation
+
+	// mu guards tokens and minting. It is not held while a token is minted.
+	mu      sync.Mutex
+	tokens  map[int64]*github.InstallationToken
+	minting map[int64]*tokenCall
+}
+
+// tokenCall is an installation token being minted. Concurrent requests for
+// the same installation wait for it instead of minting their own.
+type tokenCall struct {
+	done  chan struct{}
+	token *github.InstallationToken
+	err   error
+}
+
+func newAppAuth(appID int64, pemData []byte, base http.RoundTripper) (*appAuth, error) {
+	key, err := parseRSAPrivateKey(pemData)
+	if err != nil {
+		return nil, err
+	}
+	a := &appAuth{
+		appID:   appID,
+		key:     key,
+		tokens:  map[int64]*github.InstallationToken{},
+		minting: map[int64]*tokenCall{},
+	}
+	a.client, err = newHostClient(&http.Client{Transport: &appJWTTransport{app: a, base: base}})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// jwt returns a JWT signed with RS256, as described in
+// https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/generating-a-json-web-token-jwt-for-a-github-app
+func (a *appAuth) jwt(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		// allow for clock drift
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": a.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// listInstallations returns the installations of the app, sorted by id.
+func (a *appAuth) listInstallations(ctx context.Context) ([]*github.Installation, error) {
+	a.installationsMu.Lock()
+	defer a.installationsMu.Unlock()
+	if a.installations != nil {
+		return a.installations, nil
+	}
+
+	opt := &github.ListOptions{PerPage: 100}
+	result := []*github.Installation{}
+	for {
+		items, resp, err := a.client.Apps.ListInstallations(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, items...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetID() < result[j].GetID() })
+	a.installations = result
+	return result, nil
+}
+
+// installationFor returns the installation for owner.
+func (a *appAuth) installationFor(ctx context.Context, owner string) (*github.Installation, error) {
+	installations, err := a.listInstallations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, inst := range installations {
+		if strings.EqualFold(inst.GetAccount().GetLogin(), owner) {
+			return inst, nil
+		}
+	}
+	return nil, fmt.Errorf("GitHub App %d is not installed for %s", a.appID, owner)
+}
+
+func (a *appAuth) installationByID(ctx context.Context, id int64) (*github.Installation, error) {
+	installations, err := a.listInstallations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, inst := range installations {
+		if inst.GetID() == id {
+			return inst, nil
+		}
+	}
+	return nil, fmt.Errorf("GitHub App %d has no installation %d", a.appID, id)
+}
+
+// token returns a valid token for an installation, minting a new one when
+// the cached token is about to expire.
+func (a *appAuth) token(ctx context.Context, id int64) (string, error) {
+	a.mu.Lock()
+	if t, ok := a.tokens[id]; ok && time.Until(t.GetExpiresAt().Time) > installationTokenRefreshWindow {
+		a.mu.Unlock()
+		return t.GetToken(), nil
+	}
+	c, inFlight := a.minting[id]
+	if !inFlight {
+		c = &tokenCall{done: make(chan struct{})}
+		a.minting[id] = c
+	}
+	a.mu.Unlock()
+
+	if !inFlight {
+		c.token, _, c.err = a.client.Apps.CreateInstallationToken(ctx, id, nil)
+		if c.err != nil {
+			c.err = fmt.Errorf("failed to create token for installation %d: %w", id, c.err)
+		}
+		a.mu.Lock()
+		delete(a.minting, id)
+		if c.err == nil {
+			a.tokens[id] = c.token
+		}
+		a.mu.Unlock()
+		close(c.done)
+	}
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if c.err != nil {
+		return "", c.err
+	}
+	return c.token.GetToken(), nil
+}
+
+// appJWTTransport authenticates app level calls with a JWT.
+type appJWTTransport struct {
+	app  *appAuth
+	base http.RoundTripper
+}
+
+func (t *appJWTTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.app.jwt(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
+
+// installationTransport authenticates each request with the token of the
+// installation for the owner named in the request path, so that a single
+// client can be used across orgs. Requests for paths that name no owner, like
+// /rate_limit, must pick the installation with withInstallation.
+type installationTransport struct {
+	app  *appAuth
+	base http.RoundTripper
+}
+
+func (t *installationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	var (
+		inst *github.Installation
+		err  error
+	)
+	if id, ok := ctx.Value(installationIDKey{}).(int64); ok {
+		inst, err = t.app.installationByID(ctx, id)
+	} else if owner := ownerFromPath(req.URL.Path); owner != "" {
+		inst, err = t.app.installationFor(ctx, owner)
+	} else {
+		err = fmt.Errorf("%s %s names no owner, the GitHub App installation to use is unknown", req.Method, req.URL.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	token, err := t.app.token(ctx, inst.GetID())
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(ctx)
+	req.Header.Set("Authorization", "token "+token)
+	return t.base.RoundTrip(req)
+}
+
+// ownerFromPath returns the user or org named by a REST API path, or "" if
+// the path does not name one.
+func ownerFromPath(p string) string {
+	p = strings.TrimPrefix(p, "/api/v3")
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	switch parts[0] {
+	case "repos", "orgs", "users":
+		return parts[1]
+	default:
+		return ""
+	}
+}
+
+// installationRepoPermissions maps the permissions granted to an
+// installation to the repository permissions commands check.
+func installationRepoPermissions(inst *github.Installation) *github.RepositoryPermissions {
+	p := inst.GetPermissions()
+	return &github.RepositoryPermissions{
+		Admin: github.Ptr(p.GetAdministration() == "write"),
+		Push:  github.Ptr(p.GetContents() == "write"),
+		Pull:  github.Ptr(true),
+	}
+}
+
+// listAppOrgs returns the orgs where the app is installed.
+func listAppOrgs(ctx context.Context) ([]*github.Organization, error) {
+	installations, err := githubApp.listInstallations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []*github.Organization
+	for _, inst := range installations {
+		account := inst.GetAccount()
+		if account.GetType() != OwnerTypeOrg {
+			continue
+		}
+		result = append(result, &github.Organization{
+			Login: account.Login,
+			ID:    account.ID,
+			URL:   account.URL,
+		})
+	}
+	return result, nil
+}
+
+// listAppRepos returns the repos accessible to all installations of the app.
+func listAppRepos(ctx context.Context, client *github.Client) ([]*github.Repository, error) {
+	installations, err := githubApp.listInstallations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []*github.Repository
+	for _, inst := range installations {
+		ictx := withInstallation(ctx, inst.GetID())
+		opt := &github.ListOptions{PerPage: 100}
+		for {
+			repos, resp, err := client.Apps.ListRepos(ictx, opt)
+			if err != nil {
+				return nil, err
+			}
+			for _, repo := range repos.Repositories {
+				repo.Permissions = installationRepoPermissions(inst)
+				result = append(result, repo)
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opt.Page = resp.NextPage
+		}
+	}
+	return result, nil
+}
+
+// setAppRepoPermissions fills in the permissions of repos listed with an
+// installation token, which GitHub leaves out.
+func setAppRepoPermissions(ctx context.Context, repos []*github.Repository) error {
+	for _, repo := range repos {
+		if repo.Permissions != nil {
+			continue
+		}
+		inst, err := githubApp.installationFor(ctx, repo.GetOwner().GetLogin())
+		if err != nil {
+			return err
+		}
+		repo.Permissions = installationRepoPermissions(inst)
+	}
+	return nil
+}
+
+// appRateLimits returns the rate limits of the installation in the orgs of
+// the profile with the fewest remaining core API calls. Every installation of
+// a GitHub App has its own rate limits.
+func appRateLimits(ctx context.Context, client *github.Client) (*github.RateLimits, error) {
+	installations, err := githubApp.listInstallations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result *github.RateLimits
+	for _, inst := range installations {
+		if !inProfileOrgs(inst.GetAccount().GetLogin()) {
+			continue
+		}
+		limits, _, err := client.RateLimit.Get(withInstallation(ctx, inst.GetID()))
+		if err != nil {
+			return nil, err
+		}
+		if result == nil || coreRemaining(limits) < coreRemaining(result) {
+			result = limits
+		}
+	}
+	if result == nil {
+		return nil, fmt.Errorf("GitHub App %d is not installed in any org of the profile", githubApp.appID)
+	}
+	return result, nil
+}
+
+func coreRemaining(limits *github.RateLimits) int {
+	if limits.GetCore() == nil {
+		return math.MaxInt
+	}
+	return limits.GetCore().Remaining
+}
+
+// logCurrentUser logs the user, or the GitHub App, that commands run as.
+func logCurrentUser(ctx context.Context, client *github.Client) error {
+	if githubApp != nil {
+		app, _, err := githubApp.client.Apps.Get(ctx, "")
+		if err != nil {
+			return err
+		}
+		log.Println("app: ", app.GetSlug())
+		return nil
+	}
+
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return err
+	}
+	log.Println("user: ", user.GetLogin())
+	return nil
+}
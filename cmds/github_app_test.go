@@ -0,0 +1,221 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func testAppAuth(t *testing.T, base http.RoundTripper) *appAuth {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	a, err := newAppAuth(42, pemData, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAppJWT(t *testing.T) {
+	a := testAppAuth(t, http.DefaultTransport)
+	now := time.Now()
+	token, err := a.jwt(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 parts in JWT, found %d", len(parts))
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, rsa.VerifyPKCS1v15(&a.key.PublicKey, crypto.SHA256, digest[:], sig))
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]int64
+	if err := json.Unmarshal(data, &claims); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(42), claims["iss"])
+	assert.LessOrEqual(t, claims["exp"]-claims["iat"], int64(10*time.Minute/time.Second))
+}
+
+func TestInstallationTransport(t *testing.T) {
+	minted := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /app/installations", func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "))
+		_, _ = fmt.Fprint(w, `[
+			{"id": 1, "account": {"login": "Org-A", "type": "Organization"}},
+			{"id": 2, "account": {"login": "org-b", "type": "Organization"}}
+		]`)
+	})
+	mux.HandleFunc("POST /app/installations/{id}/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		minted++
+		expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		_, _ = fmt.Fprintf(w, `{"token": "token-%s", "expires_at": %q}`, r.PathValue("id"), expires)
+	})
+	mux.HandleFunc("GET /repos/{owner}/{repo}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"name": %q, "description": %q}`, r.PathValue("repo"), r.Header.Get("Authorization"))
+	})
+	mux.HandleFunc("GET /rate_limit", func(w http.ResponseWriter, r *http.Request) {
+		remaining := map[string]int{"token token-1": 4000, "token token-2": 100}[r.Header.Get("Authorization")]
+		_, _ = fmt.Fprintf(w, `{"resources": {"core": {"limit": 5000, "remaining": %d}}}`, remaining)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	a := testAppAuth(t, http.DefaultTransport)
+	baseURL, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.client.BaseURL = baseURL
+	client := github.NewClient(&http.Client{Transport: &installationTransport{app: a, base: http.DefaultTransport}})
+	client.BaseURL = baseURL
+
+	ctx := context.Background()
+	for _, tc := range []struct{ owner, auth string }{
+		{"org-a", "token token-1"},
+		{"org-b", "token token-2"},
+		{"org-a", "token token-1"},
+	} {
+		repo, _, err := client.Repositories.Get(ctx, tc.owner, "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tc.auth, repo.GetDescription())
+	}
+	assert.Equal(t, 2, minted, "tokens are reused until they expire")
+
+	_, _, err = client.Repositories.Get(ctx, "org-c", "x")
+	assert.ErrorContains(t, err, "not installed for org-c")
+
+	// paths without an owner need an explicit installation
+	_, _, err = client.RateLimit.Get(ctx)
+	assert.ErrorContains(t, err, "GET /rate_limit names no owner")
+	limits, _, err := client.RateLimit.Get(withInstallation(ctx, 2))
+	assert.NoError(t, err)
+	assert.Equal(t, 100, limits.GetCore().Remaining)
+
+	defer func(app *appAuth) { githubApp = app }(githubApp)
+	githubApp = a
+	limits, err = appRateLimits(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, limits.GetCore().Remaining, "the installation with the fewest calls left")
+
+	// rate limit budgets are kept per installation
+	for _, tc := range []struct {
+		ctx         context.Context
+		path        string
+		credentials string
+	}{
+		{ctx, "/repos/org-b/x", "installation 2"},
+		{ctx, "/orgs/Org-A/repos", "installation 1"},
+		{withInstallation(ctx, 2), "/installation/repositories", "installation 2"},
+		{ctx, "/rate_limit", ""},
+	} {
+		req, err := http.NewRequestWithContext(tc.ctx, http.MethodGet, srv.URL+tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tc.credentials, requestCredentials(req), tc.path)
+	}
+}
+
+func TestAppTokenMintedOnce(t *testing.T) {
+	var minted atomic.Int32
+	started, release := make(chan struct{}, 5), make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /app/installations/{id}/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		minted.Add(1)
+		if r.PathValue("id") == "1" {
+			started <- struct{}{}
+			<-release
+		}
+		expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		_, _ = fmt.Fprintf(w, `{"token": "token-%s", "expires_at": %q}`, r.PathValue("id"), expires)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	a := testAppAuth(t, http.DefaultTransport)
+	baseURL, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.client.BaseURL = baseURL
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	tokens := make([]string, 5)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tokens[i], _ = a.token(ctx, 1)
+		}()
+	}
+
+	// other installations are not blocked while a token is minted
+	<-started
+	token, err := a.token(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, []string{"token-1", "token-1", "token-1", "token-1", "token-1"}, tokens)
+	assert.Equal(t, int32(2), minted.Load())
+}
+
+func TestOwnerFromPath(t *testing.T) {
+	assert.Equal(t, "kubedb", ownerFromPath("/repos/kubedb/mysql/branches"))
+	assert.Equal(t, "kubedb", ownerFromPath("/api/v3/orgs/kubedb/repos"))
+	assert.Equal(t, "", ownerFromPath("/user/repos"))
+	assert.Equal(t, "", ownerFromPath("/rate_limit"))
+}
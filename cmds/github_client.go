@@ -25,6 +25,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/v84/github"
@@ -36,28 +37,136 @@ const (
 	defaultServerErrorDelay    = 5 * time.Second
 	maxSecondaryRetryDelay     = 15 * time.Minute
 	maxRateLimitRetryAttempts  = 8
+	minMutationInterval        = time.Second
 )
 
-func newGitHubClient(ctx context.Context) *github.Client {
-	token, found := os.LookupEnv("GH_TOOLS_TOKEN")
-	if !found {
-		log.Fatalln("GH_TOOLS_TOKEN env var is not set")
+// mutations serializes mutating requests when repos are processed
+// concurrently and spaces them at least minMutationInterval apart, as asked by
+// https://docs.github.com/en/rest/using-the-rest-api/best-practices-for-using-the-rest-api#avoid-concurrent-requests
+var mutations struct {
+	sync.Mutex
+	last time.Time
+}
+
+// newGitHubClient returns the client used by all commands. Tests replace it
+// with a client for a fake GitHub API.
+var newGitHubClient = sharedGitHubClient
+
+// githubClient is built once, so that the preflight checks and the command
+// share the client, its credentials and its rate limit tracking.
+var githubClient struct {
+	sync.Mutex
+	client *github.Client
+}
+
+func sharedGitHubClient(ctx context.Context) *github.Client {
+	githubClient.Lock()
+	defer githubClient.Unlock()
+	if githubClient.client == nil {
+		githubClient.client = defaultGitHubClient(ctx)
+	}
+	return githubClient.client
+}
+
+func defaultGitHubClient(ctx context.Context) *github.Client {
+	if replayCassette != "" {
+		resolveGitHubHost()
+		// replayed responses need no credentials
+		player, err := replayingTransport()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		client, err := newHostClient(&http.Client{Transport: outerTransport(player)})
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return client
+	}
+
+	_, err := currentProfile()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	resolveGitHubHost()
+
+	cache := newETagCacheTransport(http.DefaultTransport)
+	if recordCassette != "" {
+		// record every request; responses served from the cache could not
+		// be replayed without it
+		cache, err = recordingTransport(http.DefaultTransport)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	appID, pemData, err := appCredentials()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if appID != 0 {
+		app, err := newAppAuth(appID, pemData, http.DefaultTransport)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		githubApp = app
+		client, err := newHostClient(&http.Client{
+			Transport: outerTransport(&installationTransport{app: app, base: cache}),
+		})
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return client
+	}
+
+	token, err := githubToken()
+	if err != nil {
+		log.Fatalln(err)
 	}
+	tokenCredentials = tokenKind(token)
 
 	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	// the cache runs below oauth2, so that the token is part of the cache key
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: cache})
 	httpClient := oauth2.NewClient(ctx, ts)
 
 	baseTransport := httpClient.Transport
 	if baseTransport == nil {
 		baseTransport = http.DefaultTransport
 	}
-	httpClient.Transport = &rateLimitTransport{base: baseTransport}
+	httpClient.Transport = outerTransport(baseTransport)
 
-	return github.NewClient(httpClient)
+	client, err := newHostClient(httpClient)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return client
+}
+
+// outerTransport adds the rate limit handling, --journal and --dry-run to the
+// transport of a client. Requests intercepted by --dry-run are not journaled.
+func outerTransport(base http.RoundTripper) http.RoundTripper {
+	var rt http.RoundTripper = &rateLimitTransport{base: base, replay: replayCassette != ""}
+	rt = &journalTransport{base: rt}
+	if globalDryRun {
+		rt = &dryRunTransport{base: rt}
+	}
+	return rt
 }
 
 type rateLimitTransport struct {
 	base http.RoundTripper
+	// replay is set with --replay. Recorded rate limited responses are
+	// retried like live ones, to consume the recorded retries, but without
+	// waiting.
+	replay bool
+}
+
+// sleep waits for d unless responses are replayed.
+func (t *rateLimitTransport) sleep(ctx context.Context, d time.Duration) error {
+	if t.replay {
+		return nil
+	}
+	return sleepContext(ctx, d)
 }
 
 func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -72,7 +181,23 @@ func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error
 
 	canRetryBody := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
 
+	if concurrency > 1 && isMutatingMethod(req.Method) {
+		mutations.Lock()
+		defer func() {
+			mutations.last = time.Now()
+			mutations.Unlock()
+		}()
+		if err := t.sleep(req.Context(), time.Until(mutations.last.Add(minMutationInterval))); err != nil {
+			return nil, err
+		}
+	}
+
+	resource, credentials := requestResource(req), requestCredentials(req)
 	for attempt := 0; ; attempt++ {
+		if err := t.sleep(req.Context(), rateBudgets.reserve(credentials, resource, time.Now())); err != nil {
+			return nil, err
+		}
+
 		currReq := req
 		if attempt > 0 {
 			currReq = req.Clone(req.Context())
@@ -92,6 +217,7 @@ func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error
 		if resp == nil {
 			return resp, nil
 		}
+		rateBudgets.update(credentials, resp)
 
 		kind := classifyResponse(resp)
 		if kind == kindNone {
@@ -111,15 +237,34 @@ func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error
 		_, _ = io.Copy(io.Discard, resp.Body)
 		_ = resp.Body.Close()
 
-		timer := time.NewTimer(delay)
-		select {
-		case <-req.Context().Done():
-			if !timer.Stop() {
-				<-timer.C
-			}
-			return nil, req.Context().Err()
-		case <-timer.C:
+		if err := t.sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	select {
+	case <-ctx.Done():
+		if !timer.Stop() {
+			<-timer.C
 		}
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
 }
 
@@ -0,0 +1,91 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v84/github"
+)
+
+const defaultGitHubHost = "github.com"
+
+// githubHost is the GitHub Enterprise Server host to use instead of
+// github.com, set by --host or resolveGitHubHost.
+var githubHost string
+
+// resolveGitHubHost sets githubHost, unless --host is set, to the host of the
+// selected profile or the GH_TOOLS_HOST env var. See profileOwnsCredentials
+// for which one wins.
+func resolveGitHubHost() {
+	switch {
+	case githubHost != "":
+	case profileOwnsCredentials():
+		githubHost = profile.Host
+	case os.Getenv("GH_TOOLS_HOST") != "":
+		githubHost = os.Getenv("GH_TOOLS_HOST")
+	case profile != nil:
+		githubHost = profile.Host
+	}
+}
+
+// parseGitHubHost returns the web URL of a GitHub Enterprise Server host, or
+// nil for github.com. The scheme defaults to https.
+func parseGitHubHost(host string) (*url.URL, error) {
+	host = strings.TrimSpace(host)
+	if host == "" {
+		return nil, nil
+	}
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub host %q: %w", host, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid GitHub host %q", host)
+	}
+	if u.Hostname() == defaultGitHubHost || u.Hostname() == "api."+defaultGitHubHost {
+		return nil, nil
+	}
+	return &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}, nil
+}
+
+// newHostClient returns a client for --host, with the REST and upload URLs
+// of GitHub Enterprise Server if set.
+func newHostClient(httpClient *http.Client) (*github.Client, error) {
+	client := github.NewClient(httpClient)
+	u, err := parseGitHubHost(githubHost)
+	if err != nil || u == nil {
+		return client, err
+	}
+	return client.WithEnterpriseURLs(u.String(), u.String())
+}
+
+// gitHost returns the host name used in clone URLs.
+func gitHost() string {
+	u, err := parseGitHubHost(githubHost)
+	if err != nil || u == nil {
+		return defaultGitHubHost
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,64 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGitHubHost(t *testing.T) {
+	for _, host := range []string{"", "github.com", "https://github.com/", "api.github.com"} {
+		u, err := parseGitHubHost(host)
+		assert.NoError(t, err, host)
+		assert.Nil(t, u, host)
+	}
+
+	u, err := parseGitHubHost("ghe.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://ghe.example.com/", u.String())
+
+	u, err = parseGitHubHost("http://ghe.example.com:8080/some/path")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://ghe.example.com:8080/", u.String())
+}
+
+func TestGitHubHost(t *testing.T) {
+	defer func(h string) { githubHost = h }(githubHost)
+	repo := &github.Repository{
+		Name:  github.Ptr("mysql"),
+		Owner: &github.User{Login: github.Ptr("kubedb")},
+	}
+
+	githubHost = ""
+	assert.Equal(t, "git clone git@github.com:kubedb/mysql.git", repoListEntry(repo, true))
+	assert.Equal(t, "github.com/kubedb/mysql", repoListEntry(repo, false))
+
+	githubHost = "https://ghe.example.com"
+	assert.Equal(t, "git clone git@ghe.example.com:kubedb/mysql.git", repoListEntry(repo, true))
+	assert.Equal(t, "ghe.example.com/kubedb/mysql", repoListEntry(repo, false))
+
+	client, err := newHostClient(http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "https://ghe.example.com/api/v3/", client.BaseURL.String())
+	assert.Equal(t, "https://ghe.example.com/api/uploads/", client.UploadURL.String())
+}
@@ -0,0 +1,220 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// httpCacheMaxAge is how long a cache entry is used after it was stored.
+// Older entries are deleted when they are read, so that the cache does not
+// grow without bound.
+const httpCacheMaxAge = 7 * 24 * time.Hour
+
+var (
+	// httpCacheDir is the --cache-dir of the HTTP cache. The cache is only
+	// used if it is set.
+	httpCacheDir = os.Getenv("GH_TOOLS_CACHE_DIR")
+	noHTTPCache  bool
+)
+
+// cachedResponse is a response stored by etagCacheTransport.
+type cachedResponse struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+// etagCacheTransport stores GET responses that carry an ETag or
+// Last-Modified header on disk and revalidates them with conditional
+// requests. A 304 response does not count against the primary rate limit
+// and is replaced with the stored response.
+//
+// It must run below the oauth2 transport, since the Authorization header is
+// part of the cache key. Responses fetched with one token are never served
+// for another.
+type etagCacheTransport struct {
+	base http.RoundTripper
+	dir  string
+}
+
+func newETagCacheTransport(base http.RoundTripper) http.RoundTripper {
+	if noHTTPCache || httpCacheDir == "" {
+		return base
+	}
+	if err := os.MkdirAll(httpCacheDir, 0o700); err != nil {
+		log.Printf("disabling HTTP cache: %v", err)
+		return base
+	}
+	return &etagCacheTransport{base: base, dir: httpCacheDir}
+}
+
+func (t *etagCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	filename := t.filename(req)
+	cached, err := t.load(filename)
+	if err != nil {
+		log.Printf("ignoring HTTP cache entry %s: %v", filename, err)
+	}
+
+	if cached != nil && req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "" {
+		req = req.Clone(req.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		return cached.response(req, resp.Header), nil
+	case resp.StatusCode == http.StatusOK && isCacheable(resp):
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		entry := cachedResponse{
+			URL:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+			Body:       body,
+		}
+		if err := t.store(filename, entry); err != nil {
+			log.Printf("failed to write HTTP cache entry %s: %v", filename, err)
+		}
+		return resp, nil
+	default:
+		return resp, nil
+	}
+}
+
+func isCacheable(resp *http.Response) bool {
+	if resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "" {
+		return false
+	}
+	return strings.Contains(resp.Header.Get("Content-Type"), "json")
+}
+
+// filename returns the cache file for a request. The key covers the headers
+// that change the response body and a hash of the credentials.
+func (t *etagCacheTransport) filename(req *http.Request) string {
+	h := sha256.New()
+	for _, s := range []string{
+		req.URL.String(),
+		req.Header.Get("Accept"),
+		req.Header.Get("X-GitHub-Api-Version"),
+		req.Header.Get("Authorization"),
+	} {
+		_, _ = io.WriteString(h, s)
+		_, _ = h.Write([]byte{0})
+	}
+	key := hex.EncodeToString(h.Sum(nil))
+	return filepath.Join(t.dir, key[:2], key+".json")
+}
+
+func (t *etagCacheTransport) load(filename string) (*cachedResponse, error) {
+	fi, err := os.Stat(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if time.Since(fi.ModTime()) > httpCacheMaxAge {
+		return nil, os.Remove(filename)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var entry cachedResponse
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (t *etagCacheTransport) store(filename string, entry cachedResponse) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// response rebuilds the cached response for req. Headers of the 304
+// response, such as the rate limit headers, replace the cached ones.
+func (c *cachedResponse) response(req *http.Request, notModified http.Header) *http.Response {
+	header := c.Header.Clone()
+	for k, v := range notModified {
+		header[k] = v
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.StatusCode, http.StatusText(c.StatusCode)),
+		StatusCode:    c.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETagCacheTransport(t *testing.T) {
+	requests, notModified := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Link", `<https://api.github.com/x?page=2>; rel="next"`)
+		_, _ = io.WriteString(w, `[{"name":"master"}]`)
+	}))
+	defer srv.Close()
+
+	tr := &etagCacheTransport{base: http.DefaultTransport, dir: t.TempDir()}
+	get := func(token string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/repos/a/b/branches", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(body)
+	}
+
+	resp, body := get("a")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `[{"name":"master"}]`, body)
+	assert.Equal(t, 0, notModified)
+
+	resp, body = get("a")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `[{"name":"master"}]`, body)
+	assert.Equal(t, `<https://api.github.com/x?page=2>; rel="next"`, resp.Header.Get("Link"))
+	assert.Equal(t, "4999", resp.Header.Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "200 OK", resp.Status)
+	assert.Equal(t, 1, notModified)
+
+	// responses are not shared between tokens
+	_, _ = get("b")
+	assert.Equal(t, 1, notModified)
+	assert.Equal(t, 3, requests)
+
+	// expired entries are not revalidated
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/repos/a/b/branches", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer a")
+	old := time.Now().Add(-httpCacheMaxAge - time.Hour)
+	assert.NoError(t, os.Chtimes(tr.filename(req), old, old))
+	_, body = get("a")
+	assert.Equal(t, `[{"name":"master"}]`, body)
+	assert.Equal(t, 1, notModified)
+	assert.Equal(t, 4, requests)
+}
+
+func TestNewETagCacheTransportIsOptIn(t *testing.T) {
+	defer func(off bool, dir string) { noHTTPCache, httpCacheDir = off, dir }(noHTTPCache, httpCacheDir)
+
+	noHTTPCache, httpCacheDir = false, ""
+	assert.Same(t, http.DefaultTransport, newETagCacheTransport(http.DefaultTransport))
+	httpCacheDir = t.TempDir()
+	assert.IsType(t, &etagCacheTransport{}, newETagCacheTransport(http.DefaultTransport))
+	noHTTPCache = true
+	assert.Same(t, http.DefaultTransport, newETagCacheTransport(http.DefaultTransport))
+}
@@ -0,0 +1,296 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	journalDeleteRelease        = "delete-release"
+	journalDeletePackage        = "delete-package"
+	journalDeletePackageVersion = "delete-package-version"
+	journalRemoveProtection     = "remove-branch-protection"
+	journalRemoveAdminEnforce   = "remove-admin-enforcement"
+	journalDeleteRuleset        = "delete-ruleset"
+	journalDeleteOrgRuleset     = "delete-org-ruleset"
+	journalEditLabel            = "edit-label"
+	journalDeleteLabel          = "delete-label"
+	journalDeleteSubscription   = "delete-subscription"
+)
+
+// journalOperations are the requests that are journaled. The state before
+// each of them is read with a GET of the same URL.
+var journalOperations = []struct {
+	action  string
+	method  string
+	pattern string
+}{
+	{journalDeleteRelease, http.MethodDelete, "/repos/{owner}/{repo}/releases/{id}"},
+	{journalDeletePackage, http.MethodDelete, "/orgs/{org}/packages/{type}/{name}"},
+	{journalDeletePackageVersion, http.MethodDelete, "/orgs/{org}/packages/{type}/{name}/versions/{id}"},
+	{journalRemoveProtection, http.MethodDelete, "/repos/{owner}/{repo}/branches/{branch}/protection"},
+	{journalRemoveAdminEnforce, http.MethodDelete, "/repos/{owner}/{repo}/branches/{branch}/protection/enforce_admins"},
+	{journalDeleteRuleset, http.MethodDelete, "/repos/{owner}/{repo}/rulesets/{id}"},
+	{journalDeleteOrgRuleset, http.MethodDelete, "/orgs/{org}/rulesets/{id}"},
+	{journalEditLabel, http.MethodPatch, "/repos/{owner}/{repo}/labels/{name}"},
+	{journalDeleteLabel, http.MethodDelete, "/repos/{owner}/{repo}/labels/{name}"},
+	{journalDeleteSubscription, http.MethodDelete, "/repos/{owner}/{repo}/subscription"},
+}
+
+var (
+	journalFile string
+
+	journalMu     sync.Mutex
+	journalWriter *os.File
+	journalSeq    atomic.Int64
+)
+
+// JournalEntry records a destructive request and the state it changed, so
+// that it can be undone. The entry is written before the request is sent, and
+// a completion entry with the same ID and the outcome of the request after it.
+type JournalEntry struct {
+	ID     string            `json:"id"`
+	Time   time.Time         `json:"time"`
+	Action string            `json:"action"`
+	Method string            `json:"method"`
+	URL    string            `json:"url"`
+	Params map[string]string `json:"params"`
+	// Prior is the state before the request, as returned by the API. It is
+	// empty if the state could not be read.
+	Prior      json.RawMessage `json:"prior,omitempty"`
+	PriorError string          `json:"priorError,omitempty"`
+	// Body is the JSON body of the request, if any.
+	Body json.RawMessage `json:"body,omitempty"`
+	// Status is the HTTP status of the response, and Error the error of a
+	// request that got no response. Both are empty if the request did not
+	// complete.
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// completed reports whether the request of the entry succeeded.
+func (e JournalEntry) completed() bool {
+	return e.Status >= 200 && e.Status < 300
+}
+
+// journalCompletion is written after the request of the JournalEntry with the
+// same ID.
+type journalCompletion struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Status int       `json:"status,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// matchJournalOperation returns the journaled action of a request and the
+// parameters of its path.
+func matchJournalOperation(method string, u *url.URL) (string, map[string]string, bool) {
+	path := strings.TrimPrefix(u.EscapedPath(), "/api/v3")
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, op := range journalOperations {
+		if op.method != method {
+			continue
+		}
+		if params, ok := matchPath(strings.Split(strings.Trim(op.pattern, "/"), "/"), segments); ok {
+			return op.action, params, true
+		}
+	}
+	return "", nil, false
+}
+
+func matchPath(pattern, segments []string) (map[string]string, bool) {
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, p := range pattern {
+		if name, ok := strings.CutPrefix(p, "{"); ok {
+			v, err := url.PathUnescape(segments[i])
+			if err != nil {
+				return nil, false
+			}
+			params[strings.TrimSuffix(name, "}")] = v
+		} else if p != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// journalTransport appends an entry to the --journal file before every
+// destructive request. A request is not sent if its entry can not be
+// written. The --journal flag is read for every request, since undo turns it
+// off after the shared client was built.
+type journalTransport struct {
+	base http.RoundTripper
+}
+
+func (t *journalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if journalFile == "" {
+		return t.base.RoundTrip(req)
+	}
+	action, params, ok := matchJournalOperation(req.Method, req.URL)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	now := time.Now().UTC()
+	entry := JournalEntry{
+		ID:     fmt.Sprintf("%d-%d-%d", now.Unix(), os.Getpid(), journalSeq.Add(1)),
+		Time:   now,
+		Action: action,
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Params: params,
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		data, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		if json.Valid(data) {
+			entry.Body = data
+		}
+	}
+	prior, err := t.priorState(req)
+	if err != nil {
+		entry.PriorError = err.Error()
+	} else {
+		entry.Prior = prior
+	}
+
+	if err := appendJournal(entry); err != nil {
+		return nil, fmt.Errorf("failed to journal %s %s: %w", req.Method, req.URL, err)
+	}
+	resp, err := t.base.RoundTrip(req)
+
+	done := journalCompletion{ID: entry.ID, Time: time.Now().UTC()}
+	if err != nil {
+		done.Error = err.Error()
+	} else {
+		done.Status = resp.StatusCode
+	}
+	if jerr := appendJournal(done); jerr != nil {
+		log.Printf("failed to journal the outcome of %s %s: %v", req.Method, req.URL, jerr)
+	}
+	return resp, err
+}
+
+// priorState reads the resource that req is about to change.
+func (t *journalTransport) priorState(req *http.Request) (json.RawMessage, error) {
+	get, err := http.NewRequestWithContext(req.Context(), http.MethodGet, req.URL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range []string{"Accept", "User-Agent", "X-GitHub-Api-Version"} {
+		if v := req.Header.Get(h); v != "" {
+			get.Header.Set(h, v)
+		}
+	}
+	resp, err := t.base.RoundTrip(get)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", req.URL, resp.Status)
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("GET %s did not return JSON", req.URL)
+	}
+	return data, nil
+}
+
+func appendJournal(entry any) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if journalWriter == nil {
+		f, err := os.OpenFile(journalFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		journalWriter = f
+	}
+	if _, err := journalWriter.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	// the entry must be on disk before the change is made
+	return journalWriter.Sync()
+}
+
+// readJournal returns the entries of a journal file made at or after since,
+// with the outcome of their completion entries.
+func readJournal(filename string, since time.Time) ([]JournalEntry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var out []JournalEntry
+	byID := map[string]int{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 64<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid journal %s line %d: %w", filename, line, err)
+		}
+		if e.Action == "" {
+			// a completion entry
+			if i, ok := byID[e.ID]; ok {
+				out[i].Status, out[i].Error = e.Status, e.Error
+			}
+			continue
+		}
+		if !e.Time.Before(since) {
+			if e.ID != "" {
+				byID[e.ID] = len(out)
+			}
+			out = append(out, e)
+		}
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,262 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/spf13/cobra"
+	"gomodules.xyz/flags"
+	"gopkg.in/yaml.v3"
+)
+
+// LabelManifest lists the labels every repo should have. It is loaded from a
+// YAML or JSON file passed with --manifest.
+type LabelManifest struct {
+	Labels []ManifestLabel `json:"labels" yaml:"labels"`
+}
+
+// ManifestLabel is a label of a LabelManifest. Existing labels named like one
+// of the Aliases are renamed to Name, so that issues and pull requests keep
+// their label.
+type ManifestLabel struct {
+	Name        string   `json:"name" yaml:"name"`
+	Color       string   `json:"color" yaml:"color"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Aliases     []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+}
+
+var labelColorRegex = regexp.MustCompile(`^[0-9a-f]{6}$`)
+
+func NewCmdLabels() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "labels",
+		Short:             "Manage issue labels of repositories",
+		DisableAutoGenTag: true,
+		PersistentPreRun: func(c *cobra.Command, args []string) {
+			flags.PrintFlags(c.Flags())
+		},
+	}
+	cmd.AddCommand(newCmdLabelsSync())
+	return cmd
+}
+
+func newCmdLabelsSync() *cobra.Command {
+	var (
+		manifestFile string
+		prune        bool
+	)
+	cmd := &cobra.Command{
+		Use:               "sync",
+		Short:             "Create, update and rename labels of all public repos to match a label manifest",
+		Long:              "Create, update and rename labels of all public org repos to match a label manifest.\n\nLike add-labels, private repos are skipped unless they are selected, for example with --select visibility=public,private.",
+		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
+		Run: func(cmd *cobra.Command, args []string) {
+			m, err := loadLabelManifest(manifestFile)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			runLabelSync(m, prune, defaultRepoTerms(fork, "owner-type=organization", "visibility=public"))
+		},
+	}
+	cmd.Flags().StringVar(&manifestFile, "manifest", "", "YAML or JSON file listing the labels (required)")
+	cmd.Flags().BoolVar(&prune, "prune", false, "If true, delete labels that are neither in the manifest nor an alias of a label in it")
+	cmd.Flags().IntVar(&shards, "shards", shards, "Total number of shards")
+	cmd.Flags().IntVar(&shardIndex, "shard-index", shardIndex, "Shard Index to be processed")
+	cmd.Flags().BoolVar(&fork, "fork", fork, "If true, return forked repos")
+	addRepoSelectorFlag(cmd)
+	_ = cmd.MarkFlagRequired("manifest")
+	return cmd
+}
+
+func loadLabelManifest(filename string) (*LabelManifest, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var m LabelManifest
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to parse label manifest %s: %w", filename, err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("invalid label manifest %s: %w", filename, err)
+	}
+	return &m, nil
+}
+
+// validate normalizes the colors of the labels and checks that no name or
+// alias is used twice. Label names are case insensitive on GitHub.
+func (m *LabelManifest) validate() error {
+	owner := map[string]string{}
+	for i := range m.Labels {
+		l := &m.Labels[i]
+		if l.Name == "" {
+			return fmt.Errorf("labels[%d] has no name", i)
+		}
+		if prev, ok := owner[strings.ToLower(l.Name)]; ok {
+			return fmt.Errorf("label %q is already used by label %q", l.Name, prev)
+		}
+		owner[strings.ToLower(l.Name)] = l.Name
+
+		l.Color = strings.ToLower(strings.TrimPrefix(l.Color, "#"))
+		if !labelColorRegex.MatchString(l.Color) {
+			return fmt.Errorf("label %q has color %q, must be a 6 digit hex code", l.Name, l.Color)
+		}
+		for _, alias := range l.Aliases {
+			if prev, ok := owner[strings.ToLower(alias)]; ok {
+				return fmt.Errorf("alias %q of label %q is already used by label %q", alias, l.Name, prev)
+			}
+			owner[strings.ToLower(alias)] = l.Name
+		}
+	}
+	return nil
+}
+
+func runLabelSync(m *LabelManifest, prune bool, defaults []string) {
+	sel, err := newRepoSelector(defaults)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	ctx := context.Background()
+	client := newGitHubClient(ctx)
+
+	// Get the current user
+	if err := logCurrentUser(ctx, client); err != nil {
+		log.Fatal(err)
+	}
+
+	{
+		opt := &github.ListOptions{PerPage: 50}
+		orgs, err := ListOrgs(ctx, client, opt)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		orgs = ShardOrgs(orgs, shardIndex, shards)
+		log.Printf("Found %d orgs", len(orgs))
+
+		for _, org := range orgs {
+			fmt.Println(">>> " + org.GetLogin())
+		}
+	}
+
+	opt := &github.RepositoryListByAuthenticatedUserOptions{
+		Affiliation: "owner,organization_member",
+		ListOptions: github.ListOptions{PerPage: 50},
+	}
+	repos, err := ListRepos(ctx, client, opt, sel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Found %d repositories", len(repos))
+	warnRateBudget(ctx, client, len(repos), 1+len(m.Labels))
+	err = runFleet(ctx, repos, func(ctx context.Context, repo *github.Repository) error {
+		if repo.GetPermissions().GetAdmin() {
+			return SyncRepoLabels(ctx, client, repo, m, prune)
+		}
+		return skipRepo("no admin permission")
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// SyncRepoLabels makes the labels of repo match the manifest. Missing labels
+// are created, labels with a different color or description are updated and
+// labels named like an alias are renamed. With prune, all other labels are
+// deleted.
+func SyncRepoLabels(ctx context.Context, client *github.Client, repo *github.Repository, m *LabelManifest, prune bool) error {
+	owner := repo.GetOwner().GetLogin()
+	existing, err := ListLabels(ctx, client, repo)
+	if err != nil {
+		return err
+	}
+	byName := map[string]*github.Label{}
+	for _, l := range existing {
+		byName[strings.ToLower(l.GetName())] = l
+	}
+
+	keep := map[string]bool{}
+	for _, want := range m.Labels {
+		keep[strings.ToLower(want.Name)] = true
+		for _, alias := range want.Aliases {
+			keep[strings.ToLower(alias)] = true
+		}
+
+		cur, ok := byName[strings.ToLower(want.Name)]
+		for _, alias := range want.Aliases {
+			old, found := byName[strings.ToLower(alias)]
+			switch {
+			case !found:
+				continue
+			case ok:
+				logf(ctx, "%s has both label %q and its alias %q, leaving %q as it is", repo.GetFullName(), cur.GetName(), old.GetName(), old.GetName())
+				continue
+			}
+			printf(ctx, "[RENAME] %s label %q to %q\n", repo.GetFullName(), old.GetName(), want.Name)
+			cur, ok = old, true
+		}
+
+		label := &github.Label{
+			Name:        github.Ptr(want.Name),
+			Color:       github.Ptr(want.Color),
+			Description: github.Ptr(want.Description),
+		}
+		if !ok {
+			printf(ctx, "[CREATE] %s label %q\n", repo.GetFullName(), want.Name)
+			if _, _, err := client.Issues.CreateLabel(ctx, owner, repo.GetName(), label); err != nil {
+				return fmt.Errorf("label %s: %w", want.Name, err)
+			}
+			continue
+		}
+		if cur.GetName() == want.Name && strings.EqualFold(cur.GetColor(), want.Color) && cur.GetDescription() == want.Description {
+			continue
+		}
+		if strings.EqualFold(cur.GetName(), want.Name) {
+			printf(ctx, "[UPDATE] %s label %q\n", repo.GetFullName(), want.Name)
+		}
+		if _, _, err := client.Issues.EditLabel(ctx, owner, repo.GetName(), cur.GetName(), label); err != nil {
+			return fmt.Errorf("label %s: %w", cur.GetName(), err)
+		}
+	}
+
+	if !prune {
+		return nil
+	}
+	for _, l := range existing {
+		if keep[strings.ToLower(l.GetName())] {
+			continue
+		}
+		printf(ctx, "[DELETE] %s label %q\n", repo.GetFullName(), l.GetName())
+		if _, err := client.Issues.DeleteLabel(ctx, owner, repo.GetName(), l.GetName()); err != nil {
+			return fmt.Errorf("label %s: %w", l.GetName(), err)
+		}
+	}
+	return nil
+}
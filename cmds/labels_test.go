@@ -0,0 +1,112 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncRepoLabels(t *testing.T) {
+	srv, client := useFakeGitHub(t)
+	fake := srv.AddRepo("kubedb", "mysql").
+		AddLabel("bug", "d73a4a", "Something isn't working").
+		AddLabel("Enhancement", "a2eeef", "").
+		AddLabel("auto-merge", "ffffff", "").
+		AddLabel("wip", "000000", "").
+		AddLabel("question", "d876e3", "").
+		AddLabel("help", "008672", "")
+	m := &LabelManifest{Labels: []ManifestLabel{
+		{Name: "bug", Color: "d73a4a", Description: "Something isn't working"},
+		{Name: "enhancement", Color: "a2eeef", Description: "New feature or request"},
+		{Name: "automerge", Color: "fef2c0", Aliases: []string{"auto-merge"}},
+		{Name: "question", Color: "d876e3", Aliases: []string{"help"}},
+		{Name: "security", Color: "ee0701"},
+	}}
+
+	ctx := context.Background()
+	out := captureStdout(t, func() {
+		assert.NoError(t, SyncRepoLabels(ctx, client, fake.Repository(), m, false))
+	})
+	assert.Equal(t, `[UPDATE] kubedb/mysql label "enhancement"
+[RENAME] kubedb/mysql label "auto-merge" to "automerge"
+[CREATE] kubedb/mysql label "security"
+`, out)
+	assert.Equal(t, []string{
+		"bug=d73a4a",
+		"enhancement=a2eeef",
+		"automerge=fef2c0",
+		"wip=000000",
+		"question=d876e3",
+		"help=008672",
+		"security=ee0701",
+	}, labelColors(fake.Labels()))
+
+	// labels of the manifest and their aliases are not pruned
+	out = captureStdout(t, func() {
+		assert.NoError(t, SyncRepoLabels(ctx, client, fake.Repository(), m, true))
+	})
+	assert.Equal(t, "[DELETE] kubedb/mysql label \"wip\"\n", out)
+	assert.Len(t, fake.Labels(), 6)
+
+	// nothing changes once the labels are up to date
+	before := len(mutatingRequests(srv))
+	assert.NoError(t, SyncRepoLabels(ctx, client, fake.Repository(), m, true))
+	assert.Len(t, mutatingRequests(srv), before)
+}
+
+func TestLoadLabelManifest(t *testing.T) {
+	dir := t.TempDir()
+	write := func(data string) string {
+		filename := filepath.Join(dir, "labels.yaml")
+		assert.NoError(t, os.WriteFile(filename, []byte(data), 0o644))
+		return filename
+	}
+
+	m, err := loadLabelManifest(write(`
+labels:
+- name: automerge
+  color: "#FEF2C0"
+  description: Kodiak will auto merge PRs that have this label
+  aliases: [auto-merge]
+`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []ManifestLabel{{
+			Name:        "automerge",
+			Color:       "fef2c0",
+			Description: "Kodiak will auto merge PRs that have this label",
+			Aliases:     []string{"auto-merge"},
+		}}, m.Labels)
+	}
+
+	for data, msg := range map[string]string{
+		"labels:\n- color: fef2c0\n":                                                            "labels[0] has no name",
+		"labels:\n- name: bug\n  color: red\n":                                                  `label "bug" has color "red", must be a 6 digit hex code`,
+		"labels:\n- name: bug\n  color: d73a4a\n  colour: x\n":                                  "field colour not found",
+		"labels:\n- {name: bug, color: d73a4a}\n- {name: Bug, color: d73a4a}\n":                 `label "Bug" is already used by label "bug"`,
+		"labels:\n- {name: bug, color: d73a4a}\n- {name: fix, color: d73a4a, aliases: [bug]}\n": `alias "bug" of label "fix" is already used by label "bug"`,
+	} {
+		_, err := loadLabelManifest(write(data))
+		if assert.Error(t, err, data) {
+			assert.Contains(t, err.Error(), msg)
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/google/go-github/v84/github"
 	"github.com/spf13/cobra"
@@ -27,6 +28,7 @@ import (
 )
 
 func NewCmdListOrgs() *cobra.Command {
+	var output string
 	cmd := &cobra.Command{
 		Use:               "list-orgs",
 		Short:             "List orgs",
@@ -35,39 +37,86 @@ func NewCmdListOrgs() *cobra.Command {
 			flags.PrintFlags(c.Flags())
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			runListOrgs()
+			runListOrgs(output)
 		},
 	}
 	cmd.Flags().IntVar(&shards, "shards", shards, "Total number of shards")
 	cmd.Flags().IntVar(&shardIndex, "shard-index", shardIndex, "Shard Index to be processed")
+	addOutputFlag(cmd, &output, "org")
 	return cmd
 }
 
-func runListOrgs() {
+// OrgInfo is an organization as printed by list-orgs.
+type OrgInfo struct {
+	Login string `json:"login" yaml:"login"`
+	// Plan is only visible to org owners.
+	Plan string `json:"plan,omitempty" yaml:"plan,omitempty"`
+	// Role of the viewer, admin or member. It is empty for GitHub Apps.
+	Role string `json:"role,omitempty" yaml:"role,omitempty"`
+}
+
+var orgInfoColumns = []outputColumn[OrgInfo]{
+	{"login", func(o OrgInfo) string { return o.Login }},
+	{"plan", func(o OrgInfo) string { return o.Plan }},
+	{"role", func(o OrgInfo) string { return o.Role }},
+}
+
+func runListOrgs(output string) {
+	if err := validateOutputFormat(output); err != nil {
+		log.Fatalln(err)
+	}
+
 	ctx := context.Background()
 	client := newGitHubClient(ctx)
 
 	// Get the current user
-	user, _, err := client.Users.Get(ctx, "")
+	if err := logCurrentUser(ctx, client); err != nil {
+		log.Fatal(err)
+	}
+
+	opt := &github.ListOptions{PerPage: 50}
+	orgs, err := ListOrgs(ctx, client, opt)
 	if err != nil {
 		log.Fatal(err)
 	}
-	log.Println("user: ", user.GetLogin())
+	orgs = ShardOrgs(orgs, shardIndex, shards)
+	log.Printf("Found %d orgs", len(orgs))
+
+	if output == "" {
+		for _, org := range orgs {
+			fmt.Println(org.GetLogin())
+		}
+		return
+	}
 
-	{
-		opt := &github.ListOptions{PerPage: 50}
-		orgs, err := ListOrgs(ctx, client, opt)
+	infos := make([]OrgInfo, 0, len(orgs))
+	for _, org := range orgs {
+		info, err := getOrgInfo(ctx, client, org.GetLogin())
 		if err != nil {
-			log.Fatal(err)
+			log.Fatalln(err)
 		}
-		fmt.Println()
+		infos = append(infos, info)
+	}
+	if err := printOutput(os.Stdout, output, infos, orgInfoColumns); err != nil {
+		log.Fatalln(err)
+	}
+}
 
-		orgs = ShardOrgs(orgs, shardIndex, shards)
-		log.Printf("Found %d orgs", len(orgs))
-		fmt.Println()
+func getOrgInfo(ctx context.Context, client *github.Client, login string) (OrgInfo, error) {
+	info := OrgInfo{Login: login}
+	// list orgs api does not return plan info
+	org, _, err := client.Organizations.Get(ctx, login)
+	if err != nil {
+		return info, err
+	}
+	info.Plan = org.GetPlan().GetName()
 
-		for _, org := range orgs {
-			fmt.Println(org.GetLogin())
+	if githubApp == nil {
+		m, _, err := client.Organizations.GetOrgMembership(ctx, "", login)
+		if err != nil {
+			return info, err
 		}
+		info.Role = m.GetRole()
 	}
+	return info, nil
 }
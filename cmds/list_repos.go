@@ -20,7 +20,11 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/go-github/v84/github"
 	"github.com/spf13/cobra"
@@ -31,70 +35,185 @@ func NewCmdListRepos() *cobra.Command {
 	var orgs []string
 	var orgOwned bool
 	var ssh bool
+	var output string
 	cmd := &cobra.Command{
 		Use:               "list-repos",
 		Short:             "List repos for repo-refresher scripts",
 		DisableAutoGenTag: true,
 		Run: func(cmd *cobra.Command, args []string) {
-			printRepoList(sets.NewString(orgs...), orgOwned, fork, ssh)
+			printRepoList(sets.NewString(orgs...), orgOwned, fork, ssh, output)
 		},
 	}
-	cmd.Flags().StringSliceVar(&orgs, "orgs", orgs, "Orgs for which repo list will be printed")
+	cmd.Flags().StringSliceVar(&orgs, "orgs", orgs, "Orgs for which repo list will be printed. Defaults to the orgs of the selected profile.")
 	cmd.Flags().BoolVar(&fork, "fork", fork, "If true, return forked repos")
 	cmd.Flags().BoolVar(&orgOwned, "org-owned", orgOwned, "If true, return org owned repos")
 	cmd.Flags().BoolVar(&ssh, "ssh-url", orgOwned, "If true, return git clone ssh url")
+	addOutputFlag(cmd, &output, "repository")
+	addRepoSelectorFlag(cmd)
 	return cmd
 }
 
-func printRepoList(orgs sets.String, orgOwned, fork, ssh bool) {
+// RepoInfo is a repository as printed by list-repos.
+type RepoInfo struct {
+	FullName      string          `json:"fullName" yaml:"fullName"`
+	DefaultBranch string          `json:"defaultBranch" yaml:"defaultBranch"`
+	Visibility    string          `json:"visibility" yaml:"visibility"`
+	Fork          bool            `json:"fork" yaml:"fork"`
+	Archived      bool            `json:"archived" yaml:"archived"`
+	CloneURL      string          `json:"cloneURL" yaml:"cloneURL"`
+	SSHURL        string          `json:"sshURL" yaml:"sshURL"`
+	Topics        []string        `json:"topics,omitempty" yaml:"topics,omitempty"`
+	Language      string          `json:"language,omitempty" yaml:"language,omitempty"`
+	PushedAt      *time.Time      `json:"pushedAt,omitempty" yaml:"pushedAt,omitempty"`
+	Permissions   RepoPermissions `json:"permissions" yaml:"permissions"`
+}
+
+// RepoPermissions are the permissions of the viewer on a repository.
+type RepoPermissions struct {
+	Admin    bool `json:"admin" yaml:"admin"`
+	Maintain bool `json:"maintain" yaml:"maintain"`
+	Push     bool `json:"push" yaml:"push"`
+	Triage   bool `json:"triage" yaml:"triage"`
+	Pull     bool `json:"pull" yaml:"pull"`
+}
+
+// Role returns the highest permission, as named in the GitHub UI.
+func (p RepoPermissions) Role() string {
+	switch {
+	case p.Admin:
+		return "admin"
+	case p.Maintain:
+		return "maintain"
+	case p.Push:
+		return "write"
+	case p.Triage:
+		return "triage"
+	case p.Pull:
+		return "read"
+	}
+	return ""
+}
+
+var repoInfoColumns = []outputColumn[RepoInfo]{
+	{"fullName", func(r RepoInfo) string { return r.FullName }},
+	{"defaultBranch", func(r RepoInfo) string { return r.DefaultBranch }},
+	{"visibility", func(r RepoInfo) string { return r.Visibility }},
+	{"fork", func(r RepoInfo) string { return strconv.FormatBool(r.Fork) }},
+	{"archived", func(r RepoInfo) string { return strconv.FormatBool(r.Archived) }},
+	{"cloneURL", func(r RepoInfo) string { return r.CloneURL }},
+	{"sshURL", func(r RepoInfo) string { return r.SSHURL }},
+	{"topics", func(r RepoInfo) string { return strings.Join(r.Topics, ",") }},
+	{"language", func(r RepoInfo) string { return r.Language }},
+	{"pushedAt", func(r RepoInfo) string {
+		if r.PushedAt == nil {
+			return ""
+		}
+		return r.PushedAt.Format(time.RFC3339)
+	}},
+	{"permission", func(r RepoInfo) string { return r.Permissions.Role() }},
+}
+
+func newRepoInfo(repo *github.Repository) RepoInfo {
+	info := RepoInfo{
+		FullName:      repo.GetFullName(),
+		DefaultBranch: repo.GetDefaultBranch(),
+		Visibility:    repoVisibility(repo),
+		Fork:          repo.GetFork(),
+		Archived:      repo.GetArchived(),
+		CloneURL:      repo.GetCloneURL(),
+		SSHURL:        repo.GetSSHURL(),
+		Topics:        repo.Topics,
+		Language:      repo.GetLanguage(),
+	}
+	if repo.PushedAt != nil {
+		t := repo.PushedAt.UTC()
+		info.PushedAt = &t
+	}
+	if p := repo.Permissions; p != nil {
+		info.Permissions = RepoPermissions{
+			Admin:    p.GetAdmin(),
+			Maintain: p.GetMaintain(),
+			Push:     p.GetPush(),
+			Triage:   p.GetTriage(),
+			Pull:     p.GetPull(),
+		}
+	}
+	return info
+}
+
+func printRepoList(orgs sets.String, orgOwned, fork, ssh bool, output string) {
+	if err := validateOutputFormat(output); err != nil {
+		log.Fatalln(err)
+	}
+	defaults := defaultRepoTerms(fork)
+	if !orgOwned {
+		defaults = defaultRepoTerms(fork, "owner-type=organization")
+	}
+	sel, err := newRepoSelector(defaults)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	ctx := context.Background()
 	client := newGitHubClient(ctx)
+	if orgs.Len() == 0 && profile != nil {
+		orgs = sets.NewString(profile.Orgs...)
+	}
 
-	var listing []string
+	var result []*github.Repository
 	if orgOwned {
 		opt := &github.RepositoryListByOrgOptions{
 			Type:        "public",
 			ListOptions: github.ListOptions{PerPage: 50},
 		}
 		for _, org := range orgs.List() {
-			repos, err := ListOrgRepos(ctx, client, org, opt, fork)
+			repos, err := ListOrgRepos(ctx, client, org, opt, sel)
 			if err != nil {
 				log.Fatal(err)
 			}
-			for _, repo := range repos {
-				if ssh {
-					listing = append(listing, fmt.Sprintf("git clone git@github.com:%s/%s.git", repo.GetOwner().GetLogin(), repo.GetName()))
-				} else {
-					listing = append(listing, fmt.Sprintf("github.com/%s/%s", repo.GetOwner().GetLogin(), repo.GetName()))
-				}
-			}
+			result = append(result, repos...)
 		}
 	} else {
 		opt := &github.RepositoryListByAuthenticatedUserOptions{
 			Affiliation: "owner,organization_member",
 			ListOptions: github.ListOptions{PerPage: 50},
 		}
-		repos, err := ListRepos(ctx, client, opt, fork)
+		repos, err := ListRepos(ctx, client, opt, sel)
 		if err != nil {
 			log.Fatal(err)
 		}
-		listing = make([]string, 0, len(repos))
 		for _, repo := range repos {
-			if repo.GetOwner().GetType() == OwnerTypeUser {
-				continue // don't protect personal repos
-			}
 			if repo.GetPermissions().GetAdmin() && (orgs.Len() == 0 || orgs.Has(repo.GetOwner().GetLogin())) {
-				if ssh {
-					listing = append(listing, fmt.Sprintf("git clone git@github.com:%s/%s.git", repo.GetOwner().GetLogin(), repo.GetName()))
-				} else {
-					listing = append(listing, fmt.Sprintf("github.com/%s/%s", repo.GetOwner().GetLogin(), repo.GetName()))
-				}
+				result = append(result, repo)
 			}
 		}
 	}
 
-	sort.Strings(listing)
-	for _, entry := range listing {
-		fmt.Println(entry)
+	if output == "" {
+		listing := make([]string, 0, len(result))
+		for _, repo := range result {
+			listing = append(listing, repoListEntry(repo, ssh))
+		}
+		sort.Strings(listing)
+		for _, entry := range listing {
+			fmt.Println(entry)
+		}
+		return
+	}
+
+	infos := make([]RepoInfo, 0, len(result))
+	for _, repo := range result {
+		infos = append(infos, newRepoInfo(repo))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].FullName < infos[j].FullName })
+	if err := printOutput(os.Stdout, output, infos, repoInfoColumns); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func repoListEntry(repo *github.Repository, ssh bool) string {
+	if ssh {
+		return fmt.Sprintf("git clone git@%s:%s/%s.git", gitHost(), repo.GetOwner().GetLogin(), repo.GetName())
 	}
+	return fmt.Sprintf("%s/%s/%s", gitHost(), repo.GetOwner().GetLogin(), repo.GetName())
 }
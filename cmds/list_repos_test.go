@@ -0,0 +1,109 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+	"gomodules.xyz/sets"
+)
+
+// captureStdout returns what fn prints to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- data
+	}()
+	fn()
+	_ = w.Close()
+	return string(<-out)
+}
+
+func TestPrintRepoListOutput(t *testing.T) {
+	captureLog(t)
+	srv, _ := useFakeGitHub(t)
+	srv.AddOrg("kubedb")
+	pushed := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	srv.AddRepo("kubedb", "mysql", func(r *github.Repository) {
+		r.Topics = []string{"database"}
+		r.Language = github.Ptr("Go")
+		r.PushedAt = &github.Timestamp{Time: pushed}
+	})
+	srv.AddRepo("kubedb", "docs", func(r *github.Repository) {
+		r.Private = github.Ptr(true)
+		r.DefaultBranch = github.Ptr("main")
+	})
+	srv.AddRepo("kubedb", "fork", func(r *github.Repository) { r.Fork = github.Ptr(true) })
+	srv.AddRepo("tamal", "notes")
+
+	out := captureStdout(t, func() { printRepoList(sets.NewString(), false, false, false, outputJSON) })
+	var infos []RepoInfo
+	assert.NoError(t, json.Unmarshal([]byte(out), &infos))
+	if assert.Len(t, infos, 2) {
+		assert.Equal(t, RepoInfo{
+			FullName:      "kubedb/docs",
+			DefaultBranch: "main",
+			Visibility:    "private",
+			CloneURL:      srv.URL + "/kubedb/docs.git",
+			SSHURL:        "git@" + srv.Listener.Addr().String() + ":kubedb/docs.git",
+			Permissions:   RepoPermissions{Admin: true, Push: true, Pull: true},
+		}, infos[0])
+		assert.Equal(t, "kubedb/mysql", infos[1].FullName)
+		assert.Equal(t, []string{"database"}, infos[1].Topics)
+		assert.Equal(t, "Go", infos[1].Language)
+		assert.Equal(t, pushed, *infos[1].PushedAt)
+	}
+
+	out = captureStdout(t, func() {
+		printRepoList(sets.NewString(), false, false, false, "template={{.FullName}} {{.Visibility}} {{.Permissions.Role}}")
+	})
+	assert.Equal(t, "kubedb/docs private admin\nkubedb/mysql public admin\n", out)
+
+	// the plain listing is unchanged
+	out = captureStdout(t, func() { printRepoList(sets.NewString(), false, true, false, "") })
+	assert.Equal(t, "github.com/kubedb/docs\ngithub.com/kubedb/fork\ngithub.com/kubedb/mysql\n", out)
+}
+
+func TestRunListOrgsOutput(t *testing.T) {
+	captureLog(t)
+	srv, _ := useFakeGitHub(t)
+	srv.AddOrg("kubedb", func(org *github.Organization) { org.Plan = &github.Plan{Name: github.Ptr("team")} })
+	srv.AddOrg("stashed")
+	srv.SetOrgRole("stashed", "member")
+
+	out := captureStdout(t, func() { runListOrgs(outputCSV) })
+	assert.Equal(t, "login,plan,role\nkubedb,team,admin\nstashed,free,member\n", out)
+
+	out = captureStdout(t, func() { runListOrgs("") })
+	assert.Equal(t, "kubedb\nstashed\n", out)
+}
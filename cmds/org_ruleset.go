@@ -0,0 +1,441 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/spf13/cobra"
+	"gomodules.xyz/flags"
+)
+
+func NewCmdOrgRuleset() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "org-ruleset",
+		Short:             "Manage organization level repository rulesets",
+		DisableAutoGenTag: true,
+		PersistentPreRun: func(c *cobra.Command, args []string) {
+			flags.PrintFlags(c.Flags())
+		},
+	}
+	cmd.AddCommand(newCmdOrgRulesetList())
+	cmd.AddCommand(newCmdOrgRulesetExport())
+	cmd.AddCommand(newCmdOrgRulesetApply())
+	cmd.AddCommand(newCmdOrgRulesetDelete())
+	return cmd
+}
+
+func newCmdOrgRulesetList() *cobra.Command {
+	var org string
+	cmd := &cobra.Command{
+		Use:               "list",
+		Short:             "List rulesets of an organization",
+		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("read:org"),
+		Run: func(cmd *cobra.Command, args []string) {
+			runOrgRulesetList(org)
+		},
+	}
+	cmd.Flags().StringVar(&org, "org", "", "GitHub organization name (required)")
+	_ = cmd.MarkFlagRequired("org")
+	return cmd
+}
+
+func newCmdOrgRulesetExport() *cobra.Command {
+	var (
+		org   string
+		dir   string
+		names []string
+	)
+	cmd := &cobra.Command{
+		Use:               "export",
+		Short:             "Export rulesets of an organization to JSON files, one file per ruleset",
+		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("read:org"),
+		Run: func(cmd *cobra.Command, args []string) {
+			runOrgRulesetExport(org, dir, names)
+		},
+	}
+	cmd.Flags().StringVar(&org, "org", "", "GitHub organization name (required)")
+	cmd.Flags().StringVar(&dir, "dir", "", "Directory where ruleset files are written (required)")
+	cmd.Flags().StringSliceVar(&names, "name", nil, "If set, only export rulesets with these names")
+	_ = cmd.MarkFlagRequired("org")
+	_ = cmd.MarkFlagRequired("dir")
+	return cmd
+}
+
+func newCmdOrgRulesetApply() *cobra.Command {
+	var (
+		org   string
+		files []string
+	)
+	cmd := &cobra.Command{
+		Use:               "apply",
+		Short:             "Create or update organization rulesets from JSON files, matched by ruleset name",
+		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("admin:org"),
+		Run: func(cmd *cobra.Command, args []string) {
+			runOrgRulesetApply(org, files)
+		},
+	}
+	cmd.Flags().StringVar(&org, "org", "", "GitHub organization name (required)")
+	cmd.Flags().StringSliceVarP(&files, "filename", "f", nil, "Ruleset JSON file or directory of JSON files (repeatable)")
+	cmd.Flags().BoolVar(&dryrun, "dryrun", dryrun, "If set to true, will not apply changes.")
+	_ = cmd.MarkFlagRequired("org")
+	_ = cmd.MarkFlagRequired("filename")
+	return cmd
+}
+
+func newCmdOrgRulesetDelete() *cobra.Command {
+	var (
+		org            string
+		names          []string
+		deleteAllRules bool
+	)
+	cmd := &cobra.Command{
+		Use:               "delete",
+		Short:             "Delete organization rulesets by name",
+		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("admin:org"),
+		Run: func(cmd *cobra.Command, args []string) {
+			runOrgRulesetDelete(org, names, deleteAllRules)
+		},
+	}
+	cmd.Flags().StringVar(&org, "org", "", "GitHub organization name (required)")
+	cmd.Flags().StringSliceVar(&names, "name", nil, "Ruleset name to delete (repeatable)")
+	cmd.Flags().BoolVar(&deleteAllRules, "all", false, "If true, delete all rulesets of the organization")
+	cmd.Flags().BoolVar(&dryrun, "dryrun", dryrun, "If set to true, will not apply changes.")
+	_ = cmd.MarkFlagRequired("org")
+	return cmd
+}
+
+func runOrgRulesetList(org string) {
+	ctx := context.Background()
+	client := newGitHubClient(ctx)
+
+	rulesets, err := listOrgRulesets(ctx, client, org)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tNAME\tTARGET\tENFORCEMENT")
+	for _, rs := range rulesets {
+		target := ""
+		if rs.Target != nil {
+			target = string(*rs.Target)
+		}
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", rs.GetID(), rs.Name, target, rs.Enforcement)
+	}
+	_ = tw.Flush()
+}
+
+func runOrgRulesetExport(org, dir string, names []string) {
+	requested := normalizeRules(names)
+
+	ctx := context.Background()
+	client := newGitHubClient(ctx)
+
+	rulesets, err := listOrgRulesets(ctx, client, org)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Fatalln(err)
+	}
+
+	filenames := rulesetFilenames(rulesets)
+	exported := 0
+	for _, rs := range rulesets {
+		if len(requested) > 0 {
+			if _, ok := requested[rs.Name]; !ok {
+				continue
+			}
+		}
+		full, _, err := client.Organizations.GetRepositoryRuleset(ctx, org, rs.GetID())
+		if err != nil {
+			log.Fatalln(err)
+		}
+		data, err := json.MarshalIndent(rulesetRequest(full), "", "  ")
+		if err != nil {
+			log.Fatalln(err)
+		}
+		filename := filepath.Join(dir, filenames[rs.GetID()])
+		if err := os.WriteFile(filename, data, 0o644); err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("[EXPORT] %s ruleset %q (%d) -> %s", org, rs.Name, rs.GetID(), filename)
+		exported++
+	}
+	log.Printf("exported %d ruleset(s) from org %s", exported, org)
+}
+
+func runOrgRulesetApply(org string, files []string) {
+	rulesets, err := readRulesetFiles(files)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	ctx := context.Background()
+	client := newGitHubClient(ctx)
+
+	existing, err := listOrgRulesets(ctx, client, org)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	byName := map[string]*github.RepositoryRuleset{}
+	for _, rs := range existing {
+		byName[rs.Name] = rs
+	}
+
+	for _, rs := range rulesets {
+		cur, ok := byName[rs.Name]
+		if !ok {
+			fmt.Printf("[CREATE] %s ruleset %q\n", org, rs.Name)
+			if dryrun {
+				continue
+			}
+			if _, _, err := client.Organizations.CreateRepositoryRuleset(ctx, org, rs); err != nil {
+				log.Fatalln(err)
+			}
+			continue
+		}
+
+		full, _, err := client.Organizations.GetRepositoryRuleset(ctx, org, cur.GetID())
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if rulesetsEqual(rulesetRequest(full), rs) && conditionsEqual(full.Conditions, rs.Conditions) {
+			fmt.Printf("[UNCHANGED] %s ruleset %q (%d)\n", org, rs.Name, cur.GetID())
+			continue
+		}
+		fmt.Printf("[UPDATE] %s ruleset %q (%d)\n", org, rs.Name, cur.GetID())
+		if dryrun {
+			continue
+		}
+		if _, _, err := client.Organizations.UpdateRepositoryRuleset(ctx, org, cur.GetID(), rs); err != nil {
+			log.Fatalln(err)
+		}
+	}
+}
+
+func runOrgRulesetDelete(org string, names []string, deleteAllRules bool) {
+	requested := normalizeRules(names)
+	if !deleteAllRules && len(requested) == 0 {
+		log.Println("WARNING: no --name provided, nothing to delete")
+		return
+	}
+
+	ctx := context.Background()
+	client := newGitHubClient(ctx)
+
+	rulesets, err := listOrgRulesets(ctx, client, org)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	deleted := 0
+	for _, rs := range rulesets {
+		if !deleteAllRules {
+			if _, ok := requested[rs.Name]; !ok {
+				continue
+			}
+		}
+		log.Printf("[DELETE] %s ruleset %q (%d)", org, rs.Name, rs.GetID())
+		if dryrun {
+			continue
+		}
+		if _, err := client.Organizations.DeleteRepositoryRuleset(ctx, org, rs.GetID()); err != nil {
+			log.Fatalln(err)
+		}
+		deleted++
+	}
+	log.Printf("deleted %d ruleset(s) in org %s", deleted, org)
+}
+
+func listOrgRulesets(ctx context.Context, client *github.Client, org string) ([]*github.RepositoryRuleset, error) {
+	opt := &github.ListOptions{PerPage: 100}
+
+	var out []*github.RepositoryRuleset
+	for {
+		items, resp, err := client.Organizations.GetAllRepositoryRulesets(ctx, org, opt)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, items...)
+		if resp == nil || resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return out, nil
+}
+
+// readRulesetFiles reads one ruleset per JSON file. Directories are expanded
+// to the JSON files they contain.
+func readRulesetFiles(paths []string) ([]github.RepositoryRuleset, error) {
+	var files []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(p, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	seen := map[string]string{}
+	result := make([]github.RepositoryRuleset, 0, len(files))
+	for _, filename := range files {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		var rs github.RepositoryRuleset
+		if err := json.Unmarshal(data, &rs); err != nil {
+			return nil, fmt.Errorf("failed to parse ruleset %s: %w", filename, err)
+		}
+		if err := validateOrgRuleset(rs); err != nil {
+			return nil, fmt.Errorf("invalid ruleset %s: %w", filename, err)
+		}
+		if prev, ok := seen[rs.Name]; ok {
+			return nil, fmt.Errorf("ruleset %q is defined in both %s and %s", rs.Name, prev, filename)
+		}
+		seen[rs.Name] = filename
+		result = append(result, rulesetRequest(&rs))
+	}
+	return result, nil
+}
+
+func validateOrgRuleset(rs github.RepositoryRuleset) error {
+	if rs.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	c := rs.Conditions
+	if c == nil || (c.RepositoryName == nil && c.RepositoryID == nil && c.RepositoryProperty == nil) {
+		return fmt.Errorf("ruleset %q must set a repository_name, repository_id or repository_property condition", rs.Name)
+	}
+	return nil
+}
+
+// conditionsEqual compares ruleset conditions regardless of the order of
+// include and exclude lists. Missing, null and empty values are treated
+// alike, and so are the defaults the API fills in: protected=false and
+// source=custom.
+func conditionsEqual(a, b *github.RepositoryRulesetConditions) bool {
+	normalize := func(c *github.RepositoryRulesetConditions) any {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return nil
+		}
+		var out any
+		if err := json.Unmarshal(data, &out); err != nil {
+			return nil
+		}
+		return normalizeConditionValue("", out)
+	}
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+func normalizeConditionValue(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := map[string]any{}
+		for k, item := range v {
+			if item = normalizeConditionValue(k, item); item != nil {
+				out[k] = item
+			}
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return out
+	case []any:
+		if len(v) == 0 {
+			return nil
+		}
+		out := make([]any, 0, len(v))
+		for _, item := range v {
+			out = append(out, normalizeConditionValue("", item))
+		}
+		sort.Slice(out, func(i, j int) bool {
+			return fmt.Sprint(out[i]) < fmt.Sprint(out[j])
+		})
+		return out
+	case bool:
+		if !v {
+			return nil
+		}
+	case string:
+		if key == "source" && v == "custom" {
+			return nil
+		}
+	}
+	return v
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// rulesetFilenames returns the export file name of each ruleset by id. Names
+// are sanitized for the file system, so different names can map to the same
+// file, also on case insensitive file systems. Those files get the id of the
+// ruleset as suffix.
+func rulesetFilenames(rulesets []*github.RepositoryRuleset) map[int64]string {
+	count := map[string]int{}
+	for _, rs := range rulesets {
+		count[strings.ToLower(rulesetFilename(rs.Name, 0))]++
+	}
+	out := make(map[int64]string, len(rulesets))
+	for _, rs := range rulesets {
+		name := rulesetFilename(rs.Name, 0)
+		if count[strings.ToLower(name)] > 1 {
+			name = rulesetFilename(rs.Name, rs.GetID())
+		}
+		out[rs.GetID()] = name
+	}
+	return out
+}
+
+func rulesetFilename(name string, id int64) string {
+	name = strings.Trim(unsafeFilenameChars.ReplaceAllString(name, "-"), "-")
+	if name == "" {
+		name = "ruleset"
+	}
+	if id != 0 {
+		name += "-" + strconv.FormatInt(id, 10)
+	}
+	return name + ".json"
+}
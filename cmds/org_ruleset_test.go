@@ -0,0 +1,192 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRulesetFilenames(t *testing.T) {
+	rulesets := []*github.RepositoryRuleset{
+		{ID: github.Ptr(int64(1)), Name: "a/b"},
+		{ID: github.Ptr(int64(2)), Name: "a b"},
+		{ID: github.Ptr(int64(3)), Name: "Main"},
+		{ID: github.Ptr(int64(4)), Name: "main"},
+		{ID: github.Ptr(int64(5)), Name: "release"},
+		{ID: github.Ptr(int64(6)), Name: "***"},
+	}
+	assert.Equal(t, map[int64]string{
+		1: "a-b-1.json",
+		2: "a-b-2.json",
+		3: "Main-3.json",
+		4: "main-4.json",
+		5: "release.json",
+		6: "ruleset.json",
+	}, rulesetFilenames(rulesets))
+}
+
+func TestConditionsEqual(t *testing.T) {
+	file := &github.RepositoryRulesetConditions{
+		RefName: &github.RepositoryRulesetRefConditionParameters{
+			Include: []string{"~DEFAULT_BRANCH", "refs/heads/release-*"},
+		},
+		RepositoryProperty: &github.RepositoryRulesetRepositoryPropertyConditionParameters{
+			Include: []*github.RepositoryRulesetRepositoryPropertyTargetParameters{
+				{Name: "team", PropertyValues: []string{"db", "ui"}},
+			},
+		},
+	}
+	// as returned by the API
+	server := &github.RepositoryRulesetConditions{
+		RefName: &github.RepositoryRulesetRefConditionParameters{
+			Include: []string{"refs/heads/release-*", "~DEFAULT_BRANCH"},
+			Exclude: []string{},
+		},
+		RepositoryName: &github.RepositoryRulesetRepositoryNamesConditionParameters{
+			Include:   []string{},
+			Exclude:   []string{},
+			Protected: github.Ptr(false),
+		},
+		RepositoryProperty: &github.RepositoryRulesetRepositoryPropertyConditionParameters{
+			Include: []*github.RepositoryRulesetRepositoryPropertyTargetParameters{
+				{Name: "team", PropertyValues: []string{"ui", "db"}, Source: github.Ptr("custom")},
+			},
+			Exclude: []*github.RepositoryRulesetRepositoryPropertyTargetParameters{},
+		},
+	}
+	assert.True(t, conditionsEqual(file, server))
+	assert.True(t, conditionsEqual(nil, &github.RepositoryRulesetConditions{}))
+
+	server.RefName.Exclude = []string{"refs/heads/release-0.*"}
+	assert.False(t, conditionsEqual(file, server))
+	server.RefName.Exclude = nil
+	server.RepositoryName.Protected = github.Ptr(true)
+	assert.False(t, conditionsEqual(file, server))
+}
+
+func TestOrgRulesetExportApply(t *testing.T) {
+	captureLog(t)
+	srv, _ := useFakeGitHub(t)
+	srv.AddOrg("kubedb")
+	for _, name := range []string{"a/b", "a b"} {
+		srv.AddOrgRuleset("kubedb", github.RepositoryRuleset{
+			Name:        name,
+			Target:      github.Ptr(github.RulesetTargetBranch),
+			Enforcement: github.RulesetEnforcementActive,
+			Conditions: &github.RepositoryRulesetConditions{
+				RefName: &github.RepositoryRulesetRefConditionParameters{Include: []string{"~DEFAULT_BRANCH"}, Exclude: []string{}},
+				RepositoryName: &github.RepositoryRulesetRepositoryNamesConditionParameters{
+					Include:   []string{"mysql", "redis"},
+					Exclude:   []string{},
+					Protected: github.Ptr(false),
+				},
+			},
+			Rules: &github.RepositoryRulesetRules{Deletion: &github.EmptyRuleParameters{}},
+		})
+	}
+	ids := map[string]int64{}
+	for _, rs := range srv.OrgRulesets("kubedb") {
+		ids[rs.Name] = rs.GetID()
+	}
+
+	dir := t.TempDir()
+	runOrgRulesetExport("kubedb", dir, nil)
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2, "rulesets with the same file name do not overwrite each other")
+
+	// an exported ruleset is applied without changes
+	out := captureStdout(t, func() { runOrgRulesetApply("kubedb", []string{dir}) })
+	assert.Equal(t, `[UNCHANGED] kubedb ruleset "a/b" (`+strconv.FormatInt(ids["a/b"], 10)+`)
+[UNCHANGED] kubedb ruleset "a b" (`+strconv.FormatInt(ids["a b"], 10)+`)
+`, out)
+
+	// reordered repository names are no change either
+	filename := filepath.Join(dir, rulesetFilenames(srv.OrgRulesets("kubedb"))[ids["a/b"]])
+	var rs github.RepositoryRuleset
+	data, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &rs))
+	rs.Conditions.RepositoryName = &github.RepositoryRulesetRepositoryNamesConditionParameters{Include: []string{"redis", "mysql"}}
+	rs.Enforcement = github.RulesetEnforcementEvaluate
+	writeJSONFile(t, filename, rs)
+	rs.Name = "new"
+	writeJSONFile(t, filepath.Join(dir, "new.json"), rs)
+
+	out = captureStdout(t, func() { runOrgRulesetApply("kubedb", []string{dir}) })
+	assert.Equal(t, `[UPDATE] kubedb ruleset "a/b" (`+strconv.FormatInt(ids["a/b"], 10)+`)
+[UNCHANGED] kubedb ruleset "a b" (`+strconv.FormatInt(ids["a b"], 10)+`)
+[CREATE] kubedb ruleset "new"
+`, out)
+	enforcement := map[string]github.RulesetEnforcement{}
+	for _, rs := range srv.OrgRulesets("kubedb") {
+		enforcement[rs.Name] = rs.Enforcement
+	}
+	assert.Equal(t, map[string]github.RulesetEnforcement{
+		"a b": github.RulesetEnforcementActive,
+		"a/b": github.RulesetEnforcementEvaluate,
+		"new": github.RulesetEnforcementEvaluate,
+	}, enforcement)
+}
+
+func TestReadRulesetFiles(t *testing.T) {
+	dir := t.TempDir()
+	repoNames := &github.RepositoryRulesetConditions{
+		RepositoryName: &github.RepositoryRulesetRepositoryNamesConditionParameters{Include: []string{"~ALL"}, Exclude: []string{}},
+	}
+	writeJSONFile(t, filepath.Join(dir, "main.json"), github.RepositoryRuleset{
+		ID:          github.Ptr(int64(7)),
+		Name:        "main",
+		Enforcement: github.RulesetEnforcementActive,
+		Conditions:  repoNames,
+	})
+	writeJSONFile(t, filepath.Join(dir, "release.json"), github.RepositoryRuleset{
+		Name:        "release",
+		Enforcement: github.RulesetEnforcementEvaluate,
+		Conditions:  repoNames,
+	})
+
+	rulesets, err := readRulesetFiles([]string{dir})
+	if assert.NoError(t, err) && assert.Len(t, rulesets, 2) {
+		assert.Equal(t, "main", rulesets[0].Name)
+		assert.Nil(t, rulesets[0].ID, "read-only fields are dropped")
+		assert.Equal(t, "release", rulesets[1].Name)
+	}
+
+	// the same ruleset twice
+	_, err = readRulesetFiles([]string{dir, filepath.Join(dir, "main.json")})
+	assert.ErrorContains(t, err, `ruleset "main" is defined in both`)
+
+	// an org ruleset must select repositories
+	writeJSONFile(t, filepath.Join(dir, "branches.json"), github.RepositoryRuleset{Name: "branches"})
+	_, err = readRulesetFiles([]string{dir})
+	assert.ErrorContains(t, err, "must set a repository_name, repository_id or repository_property condition")
+}
+
+func writeJSONFile(t *testing.T, filename string, v any) {
+	t.Helper()
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filename, data, 0o644))
+}
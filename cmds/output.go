@@ -0,0 +1,128 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputJSON           = "json"
+	outputYAML           = "yaml"
+	outputCSV            = "csv"
+	outputTable          = "table"
+	outputTemplatePrefix = "template="
+)
+
+func addOutputFlag(cmd *cobra.Command, output *string, what string) {
+	cmd.Flags().StringVarP(output, "output", "o", *output,
+		fmt.Sprintf("Output format: %s, %s, %s, %s or %s<go-template>, executed for each %s. Defaults to one %s per line.", outputJSON, outputYAML, outputCSV, outputTable, outputTemplatePrefix, what, what))
+}
+
+// outputColumn is a column of the csv and table output formats.
+type outputColumn[T any] struct {
+	header string
+	value  func(T) string
+}
+
+func validateOutputFormat(format string) error {
+	switch format {
+	case "", outputJSON, outputYAML, outputCSV, outputTable:
+		return nil
+	}
+	if text, ok := strings.CutPrefix(format, outputTemplatePrefix); ok {
+		_, err := parseOutputTemplate(text)
+		return err
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+func parseOutputTemplate(text string) (*template.Template, error) {
+	return template.New("output").Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+}
+
+// printOutput writes items to w in a format validated by validateOutputFormat.
+func printOutput[T any](w io.Writer, format string, items []T, columns []outputColumn[T]) error {
+	if items == nil {
+		items = []T{}
+	}
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(items); err != nil {
+			return err
+		}
+		return enc.Close()
+	case outputCSV:
+		cw := csv.NewWriter(w)
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			row[i] = c.header
+		}
+		_ = cw.Write(row)
+		for _, item := range items {
+			for i, c := range columns {
+				row[i] = c.value(item)
+			}
+			_ = cw.Write(row)
+		}
+		cw.Flush()
+		return cw.Error()
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			row[i] = strings.ToUpper(c.header)
+		}
+		_, _ = fmt.Fprintln(tw, strings.Join(row, "\t"))
+		for _, item := range items {
+			for i, c := range columns {
+				row[i] = c.value(item)
+			}
+			_, _ = fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+
+	tmpl, err := parseOutputTemplate(strings.TrimPrefix(format, outputTemplatePrefix))
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := tmpl.Execute(w, item); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type outputItem struct {
+	Name string   `json:"name" yaml:"name"`
+	Tags []string `json:"tags" yaml:"tags"`
+}
+
+var outputItemColumns = []outputColumn[outputItem]{
+	{"name", func(i outputItem) string { return i.Name }},
+	{"tags", func(i outputItem) string { return strings.Join(i.Tags, ",") }},
+}
+
+func TestPrintOutput(t *testing.T) {
+	items := []outputItem{{Name: "kubedb", Tags: []string{"db", "k8s"}}, {Name: "stash"}}
+	cases := []struct {
+		format string
+		want   string
+	}{
+		{outputJSON, `[
+  {
+    "name": "kubedb",
+    "tags": [
+      "db",
+      "k8s"
+    ]
+  },
+  {
+    "name": "stash",
+    "tags": null
+  }
+]
+`},
+		{outputYAML, `- name: kubedb
+  tags:
+    - db
+    - k8s
+- name: stash
+  tags: []
+`},
+		{outputCSV, "name,tags\nkubedb,\"db,k8s\"\nstash,\n"},
+		{outputTable, "NAME    TAGS\nkubedb  db,k8s\nstash   \n"},
+		{`template={{.Name}}: {{join .Tags " "}}`, "kubedb: db k8s\nstash: \n"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		assert.NoError(t, printOutput(&buf, c.format, items, outputItemColumns), c.format)
+		assert.Equal(t, c.want, buf.String(), c.format)
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, printOutput[outputItem](&buf, outputJSON, nil, outputItemColumns))
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	for _, format := range []string{"", outputJSON, outputYAML, outputCSV, outputTable, "template={{.Name}}"} {
+		assert.NoError(t, validateOutputFormat(format), format)
+	}
+	for _, format := range []string{"xml", "template={{.Name", "go-template={{.Name}}"} {
+		assert.Error(t, validateOutputFormat(format), format)
+	}
+}
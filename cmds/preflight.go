@@ -0,0 +1,276 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/spf13/cobra"
+	"gomodules.xyz/sets"
+)
+
+// scopesAnnotation lists the comma separated token scopes a command needs.
+const scopesAnnotation = "gh-tools/scopes"
+
+const (
+	credentialsClassic     = "classic token"
+	credentialsFineGrained = "fine-grained token"
+	credentialsAppToken    = "GitHub App token"
+	credentialsUnscoped    = "token without OAuth scopes"
+	credentialsApp         = "GitHub App"
+)
+
+var (
+	skipPreflight bool
+
+	// tokenCredentials is the kind of the token used by newGitHubClient, as
+	// told by its prefix. It is empty if the prefix is not known.
+	tokenCredentials string
+)
+
+// tokenKind returns the kind of a token from its prefix, see
+// https://github.blog/engineering/platform-security/behind-githubs-new-authentication-token-formats/
+func tokenKind(token string) string {
+	switch {
+	case strings.HasPrefix(token, "github_pat_"):
+		return credentialsFineGrained
+	case strings.HasPrefix(token, "ghs_"), strings.HasPrefix(token, "ghu_"):
+		return credentialsAppToken
+	case strings.HasPrefix(token, "ghp_"), strings.HasPrefix(token, "gho_"):
+		return credentialsClassic
+	default:
+		return ""
+	}
+}
+
+// impliedScopes lists the scopes that are granted along with a classic token
+// scope.
+var impliedScopes = map[string][]string{
+	"repo":            {"repo:status", "repo_deployment", "public_repo", "repo:invite", "security_events"},
+	"admin:org":       {"write:org", "read:org"},
+	"write:org":       {"read:org"},
+	"write:packages":  {"read:packages"},
+	"delete:packages": {"read:packages"},
+	"admin:repo_hook": {"write:repo_hook", "read:repo_hook"},
+	"write:repo_hook": {"read:repo_hook"},
+	"user":            {"read:user", "user:email", "user:follow"},
+	"project":         {"read:project"},
+}
+
+// appScopePermissions maps a classic token scope to the GitHub App
+// permissions that give the same access to the commands of gh-tools.
+var appScopePermissions = map[string][]string{
+	"repo":            {"administration:write", "contents:write"},
+	"public_repo":     {"contents:write"},
+	"admin:org":       {"organization_administration:write", "members:write"},
+	"write:org":       {"members:write"},
+	"read:org":        {"members:read"},
+	"read:packages":   {"packages:read"},
+	"write:packages":  {"packages:write"},
+	"delete:packages": {"packages:write"},
+}
+
+// requiredScopes returns the annotations of a command that needs scopes.
+func requiredScopes(scopes ...string) map[string]string {
+	return map[string]string{scopesAnnotation: strings.Join(scopes, ",")}
+}
+
+func commandScopes(cmd *cobra.Command) []string {
+	v := cmd.Annotations[scopesAnnotation]
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+// runPreflight stops the command before it makes any change if the
+// credentials lack the scopes the command needs, or if they can not be
+// checked. It uses the client of the command.
+func runPreflight(cmd *cobra.Command) {
+	required := commandScopes(cmd)
+	if skipPreflight || len(required) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	if err := checkScopes(ctx, newGitHubClient(ctx), cmd.CommandPath(), required); err != nil {
+		log.Fatalln("preflight:", err)
+	}
+}
+
+// checkScopes returns an error if the credentials of client lack the
+// required scopes. The permissions of fine-grained tokens and of tokens of
+// GitHub Apps can not be listed, so they fail the check; grant the
+// equivalent permissions and use --skip-preflight.
+func checkScopes(ctx context.Context, client *github.Client, what string, required []string) error {
+	creds, err := loadCredentialScopes(ctx, client)
+	if err != nil {
+		return err
+	}
+	if !creds.checkable() {
+		return fmt.Errorf("the permissions of a %s can not be listed, %s needs the equivalent of %s. Grant them and use --skip-preflight.",
+			creds.kind, what, strings.Join(required, ", "))
+	}
+	if missing := creds.missing(required); len(missing) > 0 {
+		return fmt.Errorf("%s needs %s, the %s is missing %s. Run gh-tools doctor for details or use --skip-preflight.",
+			what, strings.Join(required, ", "), creds.kind, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// credentialScopes describes what the credentials in use can access.
+type credentialScopes struct {
+	kind string
+	// scopes of a classic token, including implied scopes
+	scopes sets.String
+	// installations of a GitHub App
+	installations []*github.Installation
+	rateLimits    *github.RateLimits
+}
+
+// loadCredentialScopes reads the scopes of a classic token from the
+// X-OAuth-Scopes header of /rate_limit, which does not count against the
+// rate limit. Fine-grained tokens and tokens of GitHub Apps do not return the
+// header; they are told apart by their prefix.
+func loadCredentialScopes(ctx context.Context, client *github.Client) (*credentialScopes, error) {
+	if githubApp != nil {
+		out := &credentialScopes{kind: credentialsApp}
+		installations, err := githubApp.listInstallations(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, inst := range installations {
+			if inProfileOrgs(inst.GetAccount().GetLogin()) {
+				out.installations = append(out.installations, inst)
+			}
+		}
+		if len(out.installations) > 0 {
+			if out.rateLimits, err = appRateLimits(ctx, client); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+
+	limits, resp, err := client.RateLimit.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := &credentialScopes{rateLimits: limits}
+
+	header, ok := resp.Header[http.CanonicalHeaderKey("X-OAuth-Scopes")]
+	switch {
+	case tokenCredentials == credentialsFineGrained || tokenCredentials == credentialsAppToken:
+		out.kind = tokenCredentials
+		return out, nil
+	case !ok:
+		out.kind = credentialsUnscoped
+		return out, nil
+	}
+	out.kind = credentialsClassic
+	out.scopes = expandScopes(parseScopes(strings.Join(header, ",")))
+	return out, nil
+}
+
+func parseScopes(header string) []string {
+	var out []string
+	for _, s := range strings.Split(header, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func expandScopes(scopes []string) sets.String {
+	out := sets.NewString()
+	var add func(s string)
+	add = func(s string) {
+		if out.Has(s) {
+			return
+		}
+		out.Insert(s)
+		for _, implied := range impliedScopes[s] {
+			add(implied)
+		}
+	}
+	for _, s := range scopes {
+		add(s)
+	}
+	return out
+}
+
+// checkable reports whether missing can tell what the credentials lack.
+func (c *credentialScopes) checkable() bool {
+	return c.kind == credentialsClassic || c.kind == credentialsApp
+}
+
+// missing returns the required scopes that are not granted. For a GitHub
+// App, it returns the missing permissions of each installation.
+func (c *credentialScopes) missing(required []string) []string {
+	var out []string
+	switch c.kind {
+	case credentialsClassic:
+		for _, s := range required {
+			if !c.scopes.Has(s) {
+				out = append(out, s)
+			}
+		}
+	case credentialsApp:
+		for _, inst := range c.installations {
+			granted := installationPermissionLevels(inst.GetPermissions())
+			for _, s := range required {
+				perms, ok := appScopePermissions[s]
+				if !ok {
+					out = append(out, fmt.Sprintf("%s (not available to a GitHub App)", s))
+					continue
+				}
+				for _, perm := range perms {
+					name, level, _ := strings.Cut(perm, ":")
+					if !permissionAllows(granted[name], level) {
+						out = append(out, fmt.Sprintf("%s (installation %s)", perm, inst.GetAccount().GetLogin()))
+					}
+				}
+			}
+		}
+	}
+	return sets.NewString(out...).List()
+}
+
+func installationPermissionLevels(p *github.InstallationPermissions) map[string]string {
+	out := map[string]string{}
+	if p == nil {
+		return out
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return out
+	}
+	_ = json.Unmarshal(data, &out)
+	return out
+}
+
+func permissionAllows(granted, required string) bool {
+	rank := map[string]int{"read": 1, "write": 2, "admin": 3}
+	return rank[granted] >= rank[required]
+}
@@ -0,0 +1,129 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandScopes(t *testing.T) {
+	got := expandScopes(parseScopes("admin:org, repo,"))
+	for _, s := range []string{"admin:org", "write:org", "read:org", "repo", "public_repo"} {
+		assert.True(t, got.Has(s), s)
+	}
+	assert.False(t, got.Has("delete:packages"))
+}
+
+func TestCredentialScopesMissing(t *testing.T) {
+	classic := &credentialScopes{kind: credentialsClassic, scopes: expandScopes([]string{"repo", "write:org"})}
+	assert.Empty(t, classic.missing([]string{"repo", "read:org"}))
+	assert.Equal(t, []string{"admin:org", "delete:packages"}, classic.missing([]string{"repo", "admin:org", "delete:packages"}))
+
+	app := &credentialScopes{
+		kind: credentialsApp,
+		installations: []*github.Installation{
+			{
+				Account:     &github.User{Login: github.Ptr("kubedb")},
+				Permissions: &github.InstallationPermissions{Administration: github.Ptr("write"), Contents: github.Ptr("write")},
+			},
+			{
+				Account:     &github.User{Login: github.Ptr("stashed")},
+				Permissions: &github.InstallationPermissions{Administration: github.Ptr("read"), Contents: github.Ptr("write")},
+			},
+		},
+	}
+	assert.Equal(t, []string{"administration:write (installation stashed)"}, app.missing([]string{"repo"}))
+	assert.Equal(t, []string{"notifications (not available to a GitHub App)"}, app.missing([]string{"notifications"}))
+}
+
+func TestLoadCredentialScopes(t *testing.T) {
+	scopes := "repo, read:org"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if scopes != "-" {
+			w.Header().Set("X-OAuth-Scopes", scopes)
+		}
+		_, _ = w.Write([]byte(`{"resources": {"core": {"limit": 5000, "remaining": 4990}}}`))
+	}))
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+
+	ctx := context.Background()
+	creds, err := loadCredentialScopes(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, credentialsClassic, creds.kind)
+	assert.Equal(t, []string{"admin:org"}, creds.missing([]string{"repo", "admin:org"}))
+
+	// fine-grained tokens and tokens of GitHub Apps are told by their prefix
+	defer func(kind string) { tokenCredentials = kind }(tokenCredentials)
+	for token, kind := range map[string]string{
+		"github_pat_11AAAA": credentialsFineGrained,
+		"ghs_16C7e42F292c":  credentialsAppToken,
+		"ghu_16C7e42F292c":  credentialsAppToken,
+	} {
+		tokenCredentials = tokenKind(token)
+		creds, err = loadCredentialScopes(ctx, client)
+		assert.NoError(t, err)
+		assert.Equal(t, kind, creds.kind, token)
+		assert.False(t, creds.checkable(), token)
+	}
+	tokenCredentials = tokenKind("ghp_16C7e42F292c")
+	creds, err = loadCredentialScopes(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, credentialsClassic, creds.kind)
+
+	// tokens of unknown kind without X-OAuth-Scopes can not be checked
+	tokenCredentials = ""
+	scopes = "-"
+	creds, err = loadCredentialScopes(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, credentialsUnscoped, creds.kind)
+
+	var buf bytes.Buffer
+	root := &cobra.Command{Use: "gh-tools"}
+	root.AddCommand(&cobra.Command{Use: "protect", Annotations: requiredScopes("repo", "admin:org")})
+	root.AddCommand(&cobra.Command{Use: "list-orgs"})
+	assert.NoError(t, printDoctorReport(&buf, creds, scopedCommands(root)))
+	assert.Contains(t, buf.String(), "Rate limit:   core 4990/5000")
+	assert.Contains(t, buf.String(), "gh-tools protect  repo, admin:org  unknown")
+	assert.NotContains(t, buf.String(), "list-orgs")
+
+	// the check fails closed if the permissions can not be listed
+	tokenCredentials = credentialsFineGrained
+	err = checkScopes(ctx, client, "gh-tools protect", []string{"repo", "admin:org"})
+	assert.EqualError(t, err, "the permissions of a fine-grained token can not be listed, gh-tools protect needs the equivalent of repo, admin:org. Grant them and use --skip-preflight.")
+
+	tokenCredentials = ""
+	scopes = "repo, read:org"
+	err = checkScopes(ctx, client, "gh-tools protect", []string{"repo", "admin:org"})
+	assert.EqualError(t, err, "gh-tools protect needs repo, admin:org, the classic token is missing admin:org. Run gh-tools doctor for details or use --skip-preflight.")
+	assert.NoError(t, checkScopes(ctx, client, "gh-tools protect", []string{"repo"}))
+}
@@ -0,0 +1,292 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	configFile  = os.Getenv("GH_TOOLS_CONFIG")
+	profileName = os.Getenv("GH_TOOLS_PROFILE")
+
+	// profile is the profile selected by --profile, loaded on first use.
+	profile       *Profile
+	profileLoaded bool
+	// profileExplicit is set if the profile was selected with --profile or
+	// GH_TOOLS_PROFILE rather than by currentProfile in the config file.
+	profileExplicit bool
+)
+
+// Config is the gh-tools config file. For example:
+//
+//	currentProfile: appscode
+//	profiles:
+//	  appscode:
+//	    token:
+//	      command: [gh, auth, token]
+//	    orgs: [appscode, kubedb]
+//	  enterprise:
+//	    host: ghe.example.com
+//	    token:
+//	      env: GHE_TOKEN
+type Config struct {
+	// CurrentProfile is used when --profile is not set.
+	CurrentProfile string             `yaml:"currentProfile,omitempty"`
+	Profiles       map[string]Profile `yaml:"profiles"`
+}
+
+// Profile is a named set of credentials.
+type Profile struct {
+	// Host is the GitHub Enterprise Server host, empty for github.com.
+	Host  string       `yaml:"host,omitempty"`
+	Token *TokenSource `yaml:"token,omitempty"`
+	App   *AppProfile  `yaml:"app,omitempty"`
+	// Orgs limits commands that walk all orgs and repos of the user to these orgs.
+	Orgs []string `yaml:"orgs,omitempty"`
+}
+
+// TokenSource tells where the token of a profile is read from. Exactly one
+// field must be set.
+type TokenSource struct {
+	Env     string   `yaml:"env,omitempty"`
+	File    string   `yaml:"file,omitempty"`
+	Command []string `yaml:"command,omitempty"`
+	// GHCLI reads the token of the profile host from the hosts file of the
+	// GitHub CLI.
+	GHCLI bool `yaml:"ghCLI,omitempty"`
+}
+
+// AppProfile holds the credentials of a GitHub App.
+type AppProfile struct {
+	ID             int64  `yaml:"id"`
+	PrivateKeyFile string `yaml:"privateKeyFile"`
+}
+
+func defaultConfigFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "gh-tools", "config.yaml")
+}
+
+// currentProfile returns the profile selected by --profile, or by
+// currentProfile in the config file. It returns nil if no profile is
+// selected.
+func currentProfile() (*Profile, error) {
+	if profileLoaded {
+		return profile, nil
+	}
+
+	filename := configFile
+	if filename == "" {
+		filename = defaultConfigFile()
+	}
+	cfg, err := loadConfig(filename)
+	if errors.Is(err, fs.ErrNotExist) && profileName == "" {
+		profileLoaded = true
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	name := profileName
+	profileExplicit = name != ""
+	if name == "" {
+		name = cfg.CurrentProfile
+	}
+	if name != "" {
+		p, ok := cfg.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("profile %q not found in %s", name, filename)
+		}
+		profile = &p
+		profileName = name
+	}
+	profileLoaded = true
+	return profile, nil
+}
+
+func loadConfig(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", filename, err)
+	}
+	for name, p := range cfg.Profiles {
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("invalid profile %q in %s: %w", name, filename, err)
+		}
+	}
+	return &cfg, nil
+}
+
+func (p Profile) validate() error {
+	if p.Token != nil && p.App != nil {
+		return errors.New("token and app can not both be set")
+	}
+	if p.App != nil && (p.App.ID == 0 || p.App.PrivateKeyFile == "") {
+		return errors.New("app requires id and privateKeyFile")
+	}
+	if p.Token == nil {
+		return nil
+	}
+	n := 0
+	for _, set := range []bool{p.Token.Env != "", p.Token.File != "", len(p.Token.Command) > 0, p.Token.GHCLI} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New("token must set exactly one of env, file, command or ghCLI")
+	}
+	return nil
+}
+
+// resolve returns the token for host.
+func (s TokenSource) resolve(host string) (string, error) {
+	var token string
+	switch {
+	case s.Env != "":
+		token = os.Getenv(s.Env)
+		if token == "" {
+			return "", fmt.Errorf("%s env var is not set", s.Env)
+		}
+	case s.File != "":
+		data, err := os.ReadFile(expandHome(s.File))
+		if err != nil {
+			return "", err
+		}
+		token = string(data)
+	case len(s.Command) > 0:
+		var stderr bytes.Buffer
+		cmd := exec.Command(s.Command[0], s.Command[1:]...)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("token command %q failed: %w: %s", strings.Join(s.Command, " "), err, strings.TrimSpace(stderr.String()))
+		}
+		token = string(out)
+	case s.GHCLI:
+		var err error
+		token, err = ghCLIToken(host)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", errors.New("token is empty")
+	}
+	return token, nil
+}
+
+// ghCLIToken reads the token for host from the hosts file of the GitHub CLI.
+// Newer versions of the GitHub CLI keep the token in the system keyring; use
+// command: [gh, auth, token] for those.
+func ghCLIToken(host string) (string, error) {
+	dir := os.Getenv("GH_CONFIG_DIR")
+	if dir == "" {
+		dir = filepath.Join(filepath.Dir(filepath.Dir(defaultConfigFile())), "gh")
+	}
+	filename := filepath.Join(dir, "hosts.yml")
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	var hosts map[string]struct {
+		OAuthToken string `yaml:"oauth_token"`
+	}
+	if err := yaml.Unmarshal(data, &hosts); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	h, ok := hosts[host]
+	if !ok {
+		return "", fmt.Errorf("host %s not found in %s", host, filename)
+	}
+	if h.OAuthToken == "" {
+		return "", fmt.Errorf("no oauth_token for host %s in %s; use command: [gh, auth, token] instead", host, filename)
+	}
+	return h.OAuthToken, nil
+}
+
+func expandHome(filename string) string {
+	if rest, ok := strings.CutPrefix(filename, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return filename
+}
+
+// githubToken returns the token of the selected profile, else GH_TOOLS_TOKEN.
+func githubToken() (string, error) {
+	if profile != nil && profile.Token != nil {
+		token, err := profile.Token.resolve(gitHost())
+		if err != nil {
+			return "", fmt.Errorf("failed to read token of profile %s: %w", profileName, err)
+		}
+		return token, nil
+	}
+	token, found := os.LookupEnv("GH_TOOLS_TOKEN")
+	if !found {
+		return "", errors.New("GH_TOOLS_TOKEN env var is not set. Set it, select a profile with --profile or use a GitHub App with --app-id and --app-private-key.")
+	}
+	return token, nil
+}
+
+// profileOwnsCredentials reports whether the host and credentials of the
+// explicitly selected profile win over the GH_TOOLS_HOST and GH_TOOLS_APP_ID
+// env vars. Flags always win. A profile picked by currentProfile in the config
+// file is only a default, so the env vars win over it.
+func profileOwnsCredentials() bool {
+	return profileExplicit && profile != nil && (profile.Token != nil || profile.App != nil)
+}
+
+// inProfileOrgs reports whether owner is one of the orgs of the selected
+// profile. It is always true if the profile does not list orgs.
+func inProfileOrgs(owner string) bool {
+	if profile == nil || len(profile.Orgs) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(profile.Orgs, func(org string) bool {
+		return strings.EqualFold(org, owner)
+	})
+}
@@ -0,0 +1,174 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `currentProfile: appscode
+profiles:
+  appscode:
+    token:
+      env: TEST_APPSCODE_TOKEN
+    orgs: [appscode, kubedb]
+  enterprise:
+    host: ghe.example.com
+    token:
+      command: [echo, " ghe-token "]
+`
+
+func withProfile(t *testing.T, config, name string) (*Profile, error) {
+	t.Helper()
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "config.yaml")
+	if config != "" {
+		if err := os.WriteFile(filename, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldFile, oldName, oldProfile, oldLoaded, oldExplicit := configFile, profileName, profile, profileLoaded, profileExplicit
+	t.Cleanup(func() {
+		configFile, profileName, profile, profileLoaded, profileExplicit = oldFile, oldName, oldProfile, oldLoaded, oldExplicit
+	})
+	configFile, profileName, profile, profileLoaded = filename, name, nil, false
+	return currentProfile()
+}
+
+func TestCurrentProfile(t *testing.T) {
+	p, err := withProfile(t, testConfig, "")
+	assert.NoError(t, err)
+	if assert.NotNil(t, p) {
+		assert.Equal(t, []string{"appscode", "kubedb"}, p.Orgs)
+		assert.Equal(t, "appscode", profileName)
+	}
+
+	p, err = withProfile(t, testConfig, "enterprise")
+	assert.NoError(t, err)
+	if assert.NotNil(t, p) {
+		assert.Equal(t, "ghe.example.com", p.Host)
+	}
+
+	_, err = withProfile(t, testConfig, "missing")
+	assert.ErrorContains(t, err, `profile "missing" not found`)
+
+	// no config file is fine unless a profile is requested
+	p, err = withProfile(t, "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+	_, err = withProfile(t, "", "appscode")
+	assert.Error(t, err)
+}
+
+func TestCredentialPrecedence(t *testing.T) {
+	defer func(h string, id int64) { githubHost, githubAppID = h, id }(githubHost, githubAppID)
+	t.Setenv("GH_TOOLS_HOST", "env.example.com")
+	t.Setenv("GH_TOOLS_APP_ID", "1")
+	t.Setenv("GH_TOOLS_APP_PRIVATE_KEY", "")
+	t.Setenv("GH_TOOLS_APP_PRIVATE_KEY_FILE", "")
+
+	// an explicitly selected profile wins over the env vars
+	_, err := withProfile(t, testConfig, "enterprise")
+	assert.NoError(t, err)
+	githubHost = ""
+	resolveGitHubHost()
+	assert.Equal(t, "ghe.example.com", githubHost)
+	appID, _, err := appCredentials()
+	assert.NoError(t, err)
+	assert.Zero(t, appID)
+
+	// flags win over the profile
+	githubHost = "flag.example.com"
+	resolveGitHubHost()
+	assert.Equal(t, "flag.example.com", githubHost)
+
+	// the env vars win over currentProfile of the config file
+	_, err = withProfile(t, testConfig, "")
+	assert.NoError(t, err)
+	githubHost = ""
+	resolveGitHubHost()
+	assert.Equal(t, "env.example.com", githubHost)
+	_, _, err = appCredentials()
+	assert.EqualError(t, err, "private key of GitHub App 1 is not set")
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	for name, config := range map[string]string{
+		"two token sources": "profiles:\n  a:\n    token:\n      env: A\n      file: /tmp/a\n",
+		"token and app":     "profiles:\n  a:\n    token:\n      env: A\n    app:\n      id: 1\n      privateKeyFile: key.pem\n",
+		"app without key":   "profiles:\n  a:\n    app:\n      id: 1\n",
+		"unknown field":     "profiles:\n  a:\n    tokn:\n      env: A\n",
+	} {
+		_, err := withProfile(t, config, "a")
+		assert.Error(t, err, name)
+	}
+}
+
+func TestTokenSource(t *testing.T) {
+	t.Setenv("TEST_APPSCODE_TOKEN", "env-token")
+	token, err := TokenSource{Env: "TEST_APPSCODE_TOKEN"}.resolve(defaultGitHubHost)
+	assert.NoError(t, err)
+	assert.Equal(t, "env-token", token)
+
+	_, err = TokenSource{Env: "TEST_UNSET_TOKEN"}.resolve(defaultGitHubHost)
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "token")
+	if err := os.WriteFile(filename, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	token, err = TokenSource{File: filename}.resolve(defaultGitHubHost)
+	assert.NoError(t, err)
+	assert.Equal(t, "file-token", token)
+
+	token, err = TokenSource{Command: []string{"echo", "command-token"}}.resolve(defaultGitHubHost)
+	assert.NoError(t, err)
+	assert.Equal(t, "command-token", token)
+
+	_, err = TokenSource{Command: []string{"false"}}.resolve(defaultGitHubHost)
+	assert.Error(t, err)
+
+	t.Setenv("GH_CONFIG_DIR", dir)
+	hosts := "github.com:\n  user: octocat\n  oauth_token: gh-token\nghe.example.com:\n  user: octocat\n"
+	if err := os.WriteFile(filepath.Join(dir, "hosts.yml"), []byte(hosts), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	token, err = TokenSource{GHCLI: true}.resolve(defaultGitHubHost)
+	assert.NoError(t, err)
+	assert.Equal(t, "gh-token", token)
+
+	_, err = TokenSource{GHCLI: true}.resolve("ghe.example.com")
+	assert.ErrorContains(t, err, "gh, auth, token")
+}
+
+func TestInProfileOrgs(t *testing.T) {
+	_, err := withProfile(t, testConfig, "appscode")
+	assert.NoError(t, err)
+	assert.True(t, inProfileOrgs("kubedb"))
+	assert.True(t, inProfileOrgs("AppsCode"))
+	assert.False(t, inProfileOrgs("stashed"))
+
+	_, err = withProfile(t, testConfig, "enterprise")
+	assert.NoError(t, err)
+	assert.True(t, inProfileOrgs("stashed"))
+}
@@ -22,10 +22,7 @@ import (
 	"log"
 	"math"
 	"net/http"
-	"slices"
 	"sort"
-	"strings"
-	"time"
 
 	"github.com/google/go-github/v84/github"
 	"github.com/spf13/cobra"
@@ -53,6 +50,7 @@ func NewCmdProtect() *cobra.Command {
 		Use:               "protect",
 		Short:             "Protect master/main, release-*, kubernetes-*, and ac-* branches across accessible repos",
 		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo", "admin:org"),
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			flags.PrintFlags(c.Flags())
 		},
@@ -65,19 +63,34 @@ func NewCmdProtect() *cobra.Command {
 	cmd.Flags().IntVar(&shardIndex, "shard-index", shardIndex, "Shard Index to be processed")
 	cmd.Flags().BoolVar(&fork, "fork", fork, "If true, return forked repos")
 	cmd.Flags().StringSliceVar(&skipList, "skip", skipList, "Skip owner/repository")
+	cmd.Flags().StringVar(&protectionPolicyFile, "policy", protectionPolicyFile, "Path to branch protection policy file (YAML or JSON). Uses the built-in policy if empty.")
+	addProtectBackendFlags(cmd)
+	addBranchPatternFlag(cmd)
+	addDiscoverChecksFlags(cmd)
+	addMergeProtectionFlag(cmd)
+	addRepoSelectorFlag(cmd)
+
+	cmd.AddCommand(NewCmdProtectPlan())
+	cmd.AddCommand(NewCmdProtectApply())
 	return cmd
 }
 
 func runProtect() {
+	if err := validateProtectOptions(); err != nil {
+		log.Fatalln(err)
+	}
+	sel, err := newRepoSelector(defaultRepoTerms(fork, "owner-type=organization"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	ctx := context.Background()
 	client := newGitHubClient(ctx)
 
 	// Get the current user
-	user, _, err := client.Users.Get(ctx, "")
-	if err != nil {
+	if err := logCurrentUser(ctx, client); err != nil {
 		log.Fatal(err)
 	}
-	log.Println("user: ", user.GetLogin())
 
 	//{
 	//	p, _, err := client.Repositories.GetBranchProtection(ctx, "stashed", "apimachinery", "master")
@@ -134,43 +147,39 @@ func runProtect() {
 			Affiliation: "owner,organization_member",
 			ListOptions: github.ListOptions{PerPage: 50},
 		}
-		repos, err := ListRepos(ctx, client, opt, fork)
+		repos, err := ListRepos(ctx, client, opt, sel)
 		if err != nil {
 			log.Fatal(err)
 		}
 		skipRepos := sets.NewString(skipList...)
 		log.Printf("Found %d repositories", len(repos))
-		for _, repo := range repos {
-			if repo.GetOwner().GetType() == OwnerTypeUser {
-				continue // don't protect personal repos
+		warnRateBudget(ctx, client, len(repos), protectCallsPerRepo())
+		err = runFleet(ctx, repos, func(ctx context.Context, repo *github.Repository) error {
+			if !repo.GetPermissions().GetAdmin() {
+				return skipRepo("no admin permission")
+			}
+			supported, reason, err := repoSupportsProtection(ctx, client, repo)
+			if err != nil {
+				return err
+			}
+			if !supported {
+				return skipRepo(reason)
 			}
-			if repo.GetPermissions().GetAdmin() {
-				supported, reason, err := repoSupportsProtection(ctx, client, repo)
-				if err != nil {
-					log.Fatalln(err)
-				}
-				if !supported {
-					log.Printf("Skipping %s (%s)", repo.GetFullName(), reason)
-					continue
-				}
-
-				// for appscode org, add repos by hand to team
-				if repo.GetOwner().GetLogin() != "appscode" {
-					err = TeamMaintainsRepo(ctx, client, repo.GetOwner().GetLogin(), teamReviewers, repo.GetName())
-					if err != nil {
-						log.Fatalln(err)
-					}
-				}
-				if skipRepos.Has(repo.GetFullName()) {
-					continue
-				}
 
-				err = ProtectRepo(ctx, client, repo)
+			// for appscode org, add repos by hand to team
+			if repo.GetOwner().GetLogin() != "appscode" {
+				err = TeamMaintainsRepo(ctx, client, repo.GetOwner().GetLogin(), teamReviewers, repo.GetName())
 				if err != nil {
-					log.Fatalln(err)
+					return err
 				}
-				time.Sleep(10 * time.Millisecond)
 			}
+			if skipRepos.Has(repo.GetFullName()) {
+				return skipRepo("in skip list")
+			}
+			return ProtectRepo(ctx, client, repo)
+		})
+		if err != nil {
+			log.Fatalln(err)
 		}
 	}
 	/*
@@ -184,6 +193,15 @@ func runProtect() {
 }
 
 func ListOrgs(ctx context.Context, client *github.Client, opt *github.ListOptions) ([]*github.Organization, error) {
+	if githubApp != nil {
+		result, err := listAppOrgs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].GetLogin() < result[j].GetLogin() })
+		return filterProfileOrgs(result), nil
+	}
+
 	var result []*github.Organization
 	for {
 		orgs, resp, err := client.Organizations.List(ctx, "", opt)
@@ -201,7 +219,18 @@ func ListOrgs(ctx context.Context, client *github.Client, opt *github.ListOption
 		opt.Page = resp.NextPage
 	}
 	sort.Slice(result, func(i, j int) bool { return result[i].GetLogin() < result[j].GetLogin() })
-	return result, nil
+	return filterProfileOrgs(result), nil
+}
+
+// filterProfileOrgs drops the orgs that are not listed in the selected profile.
+func filterProfileOrgs(in []*github.Organization) []*github.Organization {
+	out := in[:0]
+	for _, org := range in {
+		if inProfileOrgs(org.GetLogin()) {
+			out = append(out, org)
+		}
+	}
+	return out
 }
 
 func ShardOrgs(in []*github.Organization, shardIndex, shards int) []*github.Organization {
@@ -217,7 +246,23 @@ func ShardOrgs(in []*github.Organization, shardIndex, shards int) []*github.Orga
 	return in[start:end]
 }
 
-func ListRepos(ctx context.Context, client *github.Client, opt *github.RepositoryListByAuthenticatedUserOptions, fork bool) ([]*github.Repository, error) {
+// ListRepos lists the repos of the authenticated user, or of the app
+// installations, in the orgs of the profile that match sel.
+func ListRepos(ctx context.Context, client *github.Client, opt *github.RepositoryListByAuthenticatedUserOptions, sel *RepoSelector) ([]*github.Repository, error) {
+	if githubApp != nil {
+		repos, err := listAppRepos(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		var result []*github.Repository
+		for _, repo := range repos {
+			if inProfileOrgs(repo.GetOwner().GetLogin()) {
+				result = append(result, repo)
+			}
+		}
+		return sel.Filter(ctx, client, result)
+	}
+
 	var result []*github.Repository
 	for {
 		repos, resp, err := client.Repositories.ListByAuthenticatedUser(ctx, opt)
@@ -230,23 +275,20 @@ func ListRepos(ctx context.Context, client *github.Client, opt *github.Repositor
 		}
 
 		for idx := range repos {
-			if repos[idx].GetArchived() {
-				continue
+			if inProfileOrgs(repos[idx].GetOwner().GetLogin()) {
+				result = append(result, repos[idx])
 			}
-			if repos[idx].GetFork() && !fork {
-				continue
-			}
-			result = append(result, repos[idx])
 		}
 		if resp.NextPage == 0 {
 			break
 		}
 		opt.Page = resp.NextPage
 	}
-	return result, nil
+	return sel.Filter(ctx, client, result)
 }
 
-func ListOrgRepos(ctx context.Context, client *github.Client, org string, opt *github.RepositoryListByOrgOptions, fork bool) ([]*github.Repository, error) {
+// ListOrgRepos lists the repos of org that match sel.
+func ListOrgRepos(ctx context.Context, client *github.Client, org string, opt *github.RepositoryListByOrgOptions, sel *RepoSelector) ([]*github.Repository, error) {
 	var result []*github.Repository
 	for {
 		repos, resp, err := client.Repositories.ListByOrg(ctx, org, opt)
@@ -258,20 +300,21 @@ func ListOrgRepos(ctx context.Context, client *github.Client, org string, opt *g
 			return nil, err
 		}
 
-		for idx := range repos {
-			if repos[idx].GetArchived() {
-				continue
-			}
-			if repos[idx].GetFork() && !fork {
-				continue
-			}
-			result = append(result, repos[idx])
-		}
+		result = append(result, repos...)
 		if resp.NextPage == 0 {
 			break
 		}
 		opt.Page = resp.NextPage
 	}
+	result, err := sel.Filter(ctx, client, result)
+	if err != nil {
+		return nil, err
+	}
+	if githubApp != nil {
+		if err := setAppRepoPermissions(ctx, result); err != nil {
+			return nil, err
+		}
+	}
 	return result, nil
 }
 
@@ -303,143 +346,128 @@ func ListBranches(ctx context.Context, client *github.Client, repo *github.Repos
 }
 
 func ProtectRepo(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	if protectBackend == protectBackendRulesets {
+		return ProtectRepoWithRulesets(ctx, client, repo)
+	}
+
+	selector, err := currentBranchSelector()
+	if err != nil {
+		return err
+	}
+	if discoverChecks {
+		// discover once per repo, so that the proposed checks are also shown in dry run
+		if _, err := repoDiscoveredChecks(ctx, client, repo.Owner.GetLogin(), repo.GetName()); err != nil {
+			return err
+		}
+	}
 	branches, err := ListBranches(ctx, client, repo)
 	if err != nil {
 		return err
 	}
 	for _, branch := range branches {
-		if branch.GetName() == "master" ||
-			strings.HasPrefix(branch.GetName(), "release-") ||
-			strings.HasPrefix(branch.GetName(), "kubernetes-") ||
-			strings.HasPrefix(branch.GetName(), "ac-") {
+		if selector.Matches(repo, branch.GetName()) {
 			if err := ProtectBranch(ctx, client, repo.Owner.GetLogin(), repo.GetName(), branch.GetName(), repo.GetPrivate()); err != nil {
-				log.Println("error", err)
-				return nil // ignore error
+				return fmt.Errorf("branch %s: %w", branch.GetName(), err)
 			}
 		}
 	}
 	return nil
 }
 
-var requiredStatusChecks = map[string][]*github.RequiredStatusCheck{
-	"kubeform/gen-repo-refresher": {{Context: "DCO"}, {Context: "license/cla"}},
-	"kubeguard/guard":             {{Context: "DCO"}, {Context: "Build"}},
+// estimatedProtectedBranches is the number of branches or branch patterns
+// protect is expected to protect per repo, like the default branch and
+// release-*, for the rate limit estimate of a run.
+const estimatedProtectedBranches = 2
+
+// protectCallsPerRepo estimates the core API calls protect makes per repo
+// with the selected options.
+func protectCallsPerRepo() int {
+	// add the reviewers team and list the branches or rulesets
+	calls := 2
+	if protectBackend == protectBackendRulesets {
+		// list the branches, then read and create or update a ruleset and
+		// its push restriction ruleset per pattern
+		calls += 1 + 2*2*estimatedProtectedBranches
+	} else {
+		perBranch := 1
+		if mergeProtection {
+			// read the current protection first
+			perBranch++
+		}
+		calls += perBranch * estimatedProtectedBranches
+	}
+	if discoverChecks {
+		// list the commits, then the check runs and statuses of each
+		calls += 1 + 2*discoverCommits
+	}
+	return calls
+}
+
+// validateProtectOptions checks the flags shared by protect, protect-org and
+// protect-repo before any API call is made.
+func validateProtectOptions() error {
+	if err := validateProtectBackend(); err != nil {
+		return err
+	}
+	if _, err := currentProtectionPolicy(); err != nil {
+		return err
+	}
+	if mergeProtection && protectBackend != protectBackendClassic {
+		return fmt.Errorf("--merge is only supported by the %s backend", protectBackendClassic)
+	}
+	if discoverChecks && discoverCommits < 1 {
+		return fmt.Errorf("--discover-commits must be positive, found %d", discoverCommits)
+	}
+	_, err := currentBranchSelector()
+	return err
 }
 
 func ProtectBranch(ctx context.Context, client *github.Client, owner, repo, branch string, private bool) error {
-	fmt.Printf("[UPDATE] %s/%s:%s will be changed to protected\n", owner, repo, branch)
+	printf(ctx, "[UPDATE] %s/%s:%s will be changed to protected\n", owner, repo, branch)
 	if dryrun {
 		// return early
 		return nil
 	}
 
-	// set the branch to be protected
-	p := &github.ProtectionRequest{
-		RequiredStatusChecks: &github.RequiredStatusChecks{
-			Strict: true,
-			Checks: &[]*github.RequiredStatusCheck{
-				{Context: "Build"},
-				{Context: "DCO"},
-			},
-		},
-		RequiredPullRequestReviews: &github.PullRequestReviewsEnforcementRequest{
-			DismissStaleReviews: true,
-			DismissalRestrictionsRequest: &github.DismissalRestrictionsRequest{
-				Users: nil,
-				Teams: nil,
-			},
-			RequireCodeOwnerReviews:      false,
-			RequiredApprovingReviewCount: 1,
-		},
-		EnforceAdmins: !slices.Contains([]string{"docs", "website", "govanityurls"}, repo) &&
-			!slices.Contains([]string{
-				"appscode/blog",
-				"appscode/hugo-product-theme",
-				"appscode/static-assets",
-				"appscodelabs/gh-tools",
-				"opnpulse/alerts",
-				"opnpulse/grafana-dashboards",
-			}, fmt.Sprintf("%s/%s", owner, repo)) &&
-			slices.Contains([]string{"master", "main"}, branch),
-		Restrictions: &github.BranchRestrictionsRequest{
-			Users: make([]string, 1),
-			Teams: make([]string, 1),
-			// Apps:  []string{"kodiakhq"},
-		},
-	}
-
-	if owner == "appscode-cloud" || owner == "kubedb" || owner == "kubestash" {
-		p.Restrictions.Apps = []string{"kodiak-appscode"}
-	} else {
-		p.Restrictions.Apps = []string{"kodiakhq"}
-	}
-
-	// if !private {
-	// 	checks := append(
-	// 		*p.RequiredStatusChecks.Checks,
-	// 		&github.RequiredStatusCheck{Context: "license/cla"},
-	// 	)
-	// 	p.RequiredStatusChecks.Checks = &checks
-	// }
-
-	if repo == "installer" ||
-		(owner == "stashed" && repo == "catalog") {
-		checks := append(
-			*p.RequiredStatusChecks.Checks,
-			&github.RequiredStatusCheck{Context: "Kubernetes (v1.29.14)"},
-			&github.RequiredStatusCheck{Context: "Kubernetes (v1.31.14)"},
-			&github.RequiredStatusCheck{Context: "Kubernetes (v1.33.7)"},
-			&github.RequiredStatusCheck{Context: "Kubernetes (v1.35.0)"},
-		)
-		p.RequiredStatusChecks.Checks = &checks
-	}
-	if repo == "ui-wizards" {
-		checks := append(
-			*p.RequiredStatusChecks.Checks,
-			&github.RequiredStatusCheck{Context: "Kubernetes (v1.29.14)"},
-			&github.RequiredStatusCheck{Context: "Kubernetes (v1.31.14)"},
-			&github.RequiredStatusCheck{Context: "Kubernetes (v1.33.7)"},
-			&github.RequiredStatusCheck{Context: "Kubernetes (v1.35.0)"},
-		)
-		p.RequiredStatusChecks.Checks = &checks
-	}
-	if owner == "voyagermesh" {
-		checks := append(
-			*p.RequiredStatusChecks.Checks,
-			&github.RequiredStatusCheck{Context: "Kubernetes (v1.29.14)"},
-			&github.RequiredStatusCheck{Context: "Kubernetes (v1.31.14)"},
-			&github.RequiredStatusCheck{Context: "Kubernetes (v1.33.7)"},
-			&github.RequiredStatusCheck{Context: "Kubernetes (v1.35.0)"},
-		)
-		p.RequiredStatusChecks.Checks = &checks
-	}
-
-	if strings.EqualFold(repo, "CHANGELOG") {
-		// Avoid dismissing stale reviews, since delay in kodiak auto approval can fail release process.
-		p.RequiredPullRequestReviews.DismissStaleReviews = false
-		p.RequiredStatusChecks.Checks = &[]*github.RequiredStatusCheck{
-			{Context: "DCO"},
+	var current *github.Protection
+	if mergeProtection {
+		var err error
+		current, err = getBranchProtection(ctx, client, owner, repo, branch)
+		if err != nil {
+			return err
 		}
 	}
-	//if branch == "master" {
-	//	p.Restrictions.Apps = []string{"kodiakhq"}
-	//}
-
-	if predefinedChecks, ok := requiredStatusChecks[fmt.Sprintf("%s/%s", owner, repo)]; ok {
-		p.RequiredStatusChecks.Checks = &predefinedChecks
+	p, err := desiredProtectionRequest(ctx, client, owner, repo, branch, current)
+	if err != nil {
+		return err
 	}
 
-	_, _, err := client.Repositories.UpdateBranchProtection(ctx, owner, repo, branch, p)
+	_, _, err = client.Repositories.UpdateBranchProtection(ctx, owner, repo, branch, p)
 	return err
 }
 
+// desiredProtectionRequest returns the request that protect sends for a
+// branch, with the checks found by --discover-checks and, with --merge, the
+// current protection merged into it. protect plan uses it too, so that the
+// plan shows what protect would apply.
+func desiredProtectionRequest(ctx context.Context, client *github.Client, owner, repo, branch string, current *github.Protection) (*github.ProtectionRequest, error) {
+	p, err := branchProtectionRequest(ctx, client, owner, repo, branch)
+	if err != nil {
+		return nil, err
+	}
+	if mergeProtection {
+		p = mergeProtectionRequests(protectionRequestFromProtection(current), p)
+	}
+	return p, nil
+}
+
 func TeamMaintainsRepo(ctx context.Context, client *github.Client, org, team, repo string) error {
 	_, err := client.Teams.AddTeamRepoBySlug(ctx, org, team, org, repo, &github.TeamAddTeamRepoOptions{
 		Permission: "admin",
 	})
 	if err != nil {
 		if e, ok := err.(*github.ErrorResponse); ok && e.Response.StatusCode == http.StatusNotFound {
-			log.Println(err)
+			logf(ctx, "%v", err)
 			return nil
 		}
 		return err
@@ -0,0 +1,167 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"slices"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/spf13/cobra"
+)
+
+var mergeProtection bool
+
+func addMergeProtectionFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&mergeProtection, "merge", mergeProtection, "If true, keep checks, users, teams and apps already set on a branch and any stricter settings. Only supported by the classic backend.")
+}
+
+// mergeProtectionRequests returns desired with the required checks and push
+// restrictions of current added to it. For other settings, the stricter of
+// the two values is kept. Settings that desired does not manage are copied
+// from current.
+func mergeProtectionRequests(current, desired *github.ProtectionRequest) *github.ProtectionRequest {
+	if current == nil {
+		return desired
+	}
+	if desired == nil {
+		return current
+	}
+	out := *desired
+
+	switch {
+	case out.RequiredStatusChecks == nil:
+		out.RequiredStatusChecks = current.RequiredStatusChecks
+	case current.RequiredStatusChecks != nil:
+		out.RequiredStatusChecks = mergeRequiredStatusChecks(current.RequiredStatusChecks, out.RequiredStatusChecks)
+	}
+
+	switch {
+	case out.RequiredPullRequestReviews == nil:
+		out.RequiredPullRequestReviews = current.RequiredPullRequestReviews
+	case current.RequiredPullRequestReviews != nil:
+		out.RequiredPullRequestReviews = mergePullRequestReviews(current.RequiredPullRequestReviews, out.RequiredPullRequestReviews)
+	}
+
+	out.EnforceAdmins = out.EnforceAdmins || current.EnforceAdmins
+
+	switch {
+	case out.Restrictions == nil:
+		out.Restrictions = current.Restrictions
+	case current.Restrictions != nil:
+		out.Restrictions = &github.BranchRestrictionsRequest{
+			Users: unionStrings(out.Restrictions.Users, current.Restrictions.Users),
+			Teams: unionStrings(out.Restrictions.Teams, current.Restrictions.Teams),
+			Apps:  unionStrings(out.Restrictions.Apps, current.Restrictions.Apps),
+		}
+	}
+
+	out.RequireLinearHistory = stricterBool(current.RequireLinearHistory, out.RequireLinearHistory, true)
+	out.RequiredConversationResolution = stricterBool(current.RequiredConversationResolution, out.RequiredConversationResolution, true)
+	out.BlockCreations = stricterBool(current.BlockCreations, out.BlockCreations, true)
+	out.LockBranch = stricterBool(current.LockBranch, out.LockBranch, true)
+	out.AllowForcePushes = stricterBool(current.AllowForcePushes, out.AllowForcePushes, false)
+	out.AllowDeletions = stricterBool(current.AllowDeletions, out.AllowDeletions, false)
+	out.AllowForkSyncing = stricterBool(current.AllowForkSyncing, out.AllowForkSyncing, false)
+	return &out
+}
+
+func mergeRequiredStatusChecks(current, desired *github.RequiredStatusChecks) *github.RequiredStatusChecks {
+	out := &github.RequiredStatusChecks{
+		Strict: current.Strict || desired.Strict,
+	}
+
+	var checks []*github.RequiredStatusCheck
+	seen := map[string]bool{}
+	add := func(items *[]*github.RequiredStatusCheck) {
+		if items == nil {
+			return
+		}
+		for _, c := range *items {
+			if c == nil || c.Context == "" || seen[c.Context] {
+				continue
+			}
+			seen[c.Context] = true
+			checks = append(checks, c)
+		}
+	}
+	add(desired.Checks)
+	add(current.Checks)
+	if checks == nil {
+		checks = []*github.RequiredStatusCheck{}
+	}
+	out.Checks = &checks
+	return out
+}
+
+func mergePullRequestReviews(current, desired *github.PullRequestReviewsEnforcementRequest) *github.PullRequestReviewsEnforcementRequest {
+	out := *desired
+	out.DismissStaleReviews = out.DismissStaleReviews || current.DismissStaleReviews
+	out.RequireCodeOwnerReviews = out.RequireCodeOwnerReviews || current.RequireCodeOwnerReviews
+	out.RequiredApprovingReviewCount = max(out.RequiredApprovingReviewCount, current.RequiredApprovingReviewCount)
+	out.RequireLastPushApproval = stricterBool(current.RequireLastPushApproval, out.RequireLastPushApproval, true)
+
+	if d := current.DismissalRestrictionsRequest; d != nil {
+		merged := &github.DismissalRestrictionsRequest{}
+		var users, teams, apps []string
+		if x := out.DismissalRestrictionsRequest; x != nil {
+			users, teams, apps = derefStrings(x.Users), derefStrings(x.Teams), derefStrings(x.Apps)
+		}
+		users = unionStrings(users, derefStrings(d.Users))
+		teams = unionStrings(teams, derefStrings(d.Teams))
+		apps = unionStrings(apps, derefStrings(d.Apps))
+		merged.Users, merged.Teams, merged.Apps = &users, &teams, &apps
+		out.DismissalRestrictionsRequest = merged
+	}
+	if out.BypassPullRequestAllowancesRequest == nil {
+		out.BypassPullRequestAllowancesRequest = current.BypassPullRequestAllowancesRequest
+	}
+	return &out
+}
+
+// unionStrings returns the items of a followed by the items of b that are
+// missing from a. Empty strings are dropped.
+func unionStrings(a, b []string) []string {
+	out := make([]string, 0, len(a)+len(b))
+	for _, s := range slices.Concat(a, b) {
+		if s != "" && !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func derefStrings(in *[]string) []string {
+	if in == nil {
+		return nil
+	}
+	return *in
+}
+
+// stricterBool returns the stricter of two optional settings, where strict
+// is the value that restricts more.
+func stricterBool(current, desired *bool, strict bool) *bool {
+	switch {
+	case desired == nil:
+		return current
+	case current == nil:
+		return desired
+	case *current == strict || *desired == strict:
+		return github.Ptr(strict)
+	default:
+		return github.Ptr(!strict)
+	}
+}
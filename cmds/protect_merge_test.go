@@ -0,0 +1,87 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeProtectionRequests(t *testing.T) {
+	p, err := loadProtectionPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desired := p.ProtectionRequest("kubedb", "mysql", "release-1.0")
+
+	current := &github.ProtectionRequest{
+		RequiredStatusChecks: &github.RequiredStatusChecks{
+			Checks: &[]*github.RequiredStatusCheck{
+				{Context: "DCO"},
+				{Context: "e2e", AppID: github.Ptr(int64(15368))},
+			},
+		},
+		RequiredPullRequestReviews: &github.PullRequestReviewsEnforcementRequest{
+			RequiredApprovingReviewCount: 2,
+			RequireCodeOwnerReviews:      true,
+		},
+		EnforceAdmins: true,
+		Restrictions: &github.BranchRestrictionsRequest{
+			Users: []string{"", "tamalsaha"},
+			Teams: []string{"reviewers"},
+			Apps:  []string{"kodiak-appscode", "dependabot"},
+		},
+		RequireLinearHistory: github.Ptr(true),
+		AllowForcePushes:     github.Ptr(false),
+	}
+
+	merged := mergeProtectionRequests(current, desired)
+
+	var checks []string
+	for _, c := range *merged.RequiredStatusChecks.Checks {
+		checks = append(checks, c.Context)
+	}
+	assert.Equal(t, []string{"Build", "DCO", "e2e"}, checks)
+	assert.True(t, merged.RequiredStatusChecks.Strict)
+	assert.Equal(t, 2, merged.RequiredPullRequestReviews.RequiredApprovingReviewCount)
+	assert.True(t, merged.RequiredPullRequestReviews.DismissStaleReviews)
+	assert.True(t, merged.RequiredPullRequestReviews.RequireCodeOwnerReviews)
+	assert.True(t, merged.EnforceAdmins)
+	assert.Equal(t, []string{"tamalsaha"}, merged.Restrictions.Users)
+	assert.Equal(t, []string{"reviewers"}, merged.Restrictions.Teams)
+	assert.Equal(t, []string{"kodiak-appscode", "dependabot"}, merged.Restrictions.Apps)
+	assert.Equal(t, github.Ptr(true), merged.RequireLinearHistory)
+	assert.Equal(t, github.Ptr(false), merged.AllowForcePushes)
+
+	// the desired request is not modified
+	assert.Len(t, *desired.RequiredStatusChecks.Checks, 2)
+	assert.Equal(t, 1, desired.RequiredPullRequestReviews.RequiredApprovingReviewCount)
+}
+
+func TestMergeProtectionRequestsUnprotected(t *testing.T) {
+	desired := &github.ProtectionRequest{EnforceAdmins: true}
+	assert.Same(t, desired, mergeProtectionRequests(nil, desired))
+}
+
+func TestStricterBool(t *testing.T) {
+	assert.Equal(t, github.Ptr(true), stricterBool(github.Ptr(true), github.Ptr(false), true))
+	assert.Equal(t, github.Ptr(false), stricterBool(github.Ptr(true), github.Ptr(false), false))
+	assert.Equal(t, github.Ptr(true), stricterBool(github.Ptr(true), nil, false))
+	assert.Nil(t, stricterBool(nil, nil, true))
+}
@@ -20,7 +20,6 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"time"
 
 	"github.com/google/go-github/v84/github"
 	"github.com/spf13/cobra"
@@ -38,6 +37,7 @@ func NewCmdProtectOrg() *cobra.Command {
 		Use:               "protect-org",
 		Short:             "Protect master/main, release-*, kubernetes-*, and ac-* branches for all repos in an organization",
 		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			flags.PrintFlags(c.Flags())
 		},
@@ -48,6 +48,12 @@ func NewCmdProtectOrg() *cobra.Command {
 	cmd.Flags().StringVar(&org, "org", "", "GitHub organization name (required)")
 	cmd.Flags().BoolVar(&fork, "fork", false, "If true, include forked repos")
 	cmd.Flags().StringSliceVar(&orgSkipList, "skip", nil, "Skip repositories (repo names without org prefix)")
+	cmd.Flags().StringVar(&protectionPolicyFile, "policy", protectionPolicyFile, "Path to branch protection policy file (YAML or JSON). Uses the built-in policy if empty.")
+	addProtectBackendFlags(cmd)
+	addBranchPatternFlag(cmd)
+	addDiscoverChecksFlags(cmd)
+	addMergeProtectionFlag(cmd)
+	addRepoSelectorFlag(cmd)
 	_ = cmd.MarkFlagRequired("org")
 	return cmd
 }
@@ -56,16 +62,21 @@ func runProtectOrg(org string, includeForks bool, skipList []string) {
 	if org == "" {
 		log.Fatal("--org flag is required")
 	}
+	if err := validateProtectOptions(); err != nil {
+		log.Fatalln(err)
+	}
+	sel, err := newRepoSelector(defaultRepoTerms(includeForks))
+	if err != nil {
+		log.Fatalln(err)
+	}
 
 	ctx := context.Background()
 	client := newGitHubClient(ctx)
 
 	// Get the current user
-	user, _, err := client.Users.Get(ctx, "")
-	if err != nil {
+	if err := logCurrentUser(ctx, client); err != nil {
 		log.Fatal(err)
 	}
-	log.Println("user: ", user.GetLogin())
 
 	// Get org info to check plan
 	orgInfo, _, err := client.Organizations.Get(ctx, org)
@@ -96,47 +107,44 @@ func runProtectOrg(org string, includeForks bool, skipList []string) {
 	opt := &github.RepositoryListByOrgOptions{
 		ListOptions: github.ListOptions{PerPage: 50},
 	}
-	repos, err := ListOrgRepos(ctx, client, org, opt, includeForks)
+	repos, err := ListOrgRepos(ctx, client, org, opt, sel)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	skipRepos := sets.NewString(skipList...)
 	log.Printf("Found %d repositories in org %s", len(repos), org)
+	warnRateBudget(ctx, client, len(repos), protectCallsPerRepo())
 
-	for _, repo := range repos {
+	err = runFleet(ctx, repos, func(ctx context.Context, repo *github.Repository) error {
 		if !repo.GetPermissions().GetAdmin() {
-			log.Printf("Skipping %s (no admin permission)", repo.GetFullName())
-			continue
+			return skipRepo("no admin permission")
 		}
 
 		supported, reason, err := repoSupportsProtection(ctx, client, repo)
 		if err != nil {
-			log.Fatalln(err)
+			return err
 		}
 		if !supported {
-			log.Printf("Skipping %s (%s)", repo.GetFullName(), reason)
-			continue
+			return skipRepo(reason)
 		}
 
 		// For appscode org, repos are added to team manually
 		if org != "appscode" {
 			err = TeamMaintainsRepo(ctx, client, org, teamReviewers, repo.GetName())
 			if err != nil {
-				log.Fatalln(err)
+				return err
 			}
 		}
 
 		if skipRepos.Has(repo.GetName()) {
-			log.Printf("Skipping %s (in skip list)", repo.GetFullName())
-			continue
+			return skipRepo("in skip list")
 		}
 
-		err = ProtectRepo(ctx, client, repo)
-		if err != nil {
-			log.Fatalln(err)
-		}
-		time.Sleep(10 * time.Millisecond)
+		return ProtectRepo(ctx, client, repo)
+	})
+	if err != nil {
+		log.Fatalln(err)
 	}
 
 	log.Printf("Finished protecting repos in org %s", org)
@@ -0,0 +1,572 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/spf13/cobra"
+	"gomodules.xyz/sets"
+)
+
+// ProtectionPlan is the set of branch protection changes computed by
+// `protect plan` and applied by `protect apply`.
+type ProtectionPlan struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	Policy      string    `json:"policy"`
+	// Repos are the owner/repo names of the planned repos.
+	Repos    []string     `json:"repos,omitempty"`
+	Branches []BranchPlan `json:"branches"`
+}
+
+// BranchPlan holds the changes needed to bring one branch in line with the
+// policy, the request that makes them and the protection they were computed
+// from.
+type BranchPlan struct {
+	Owner   string                    `json:"owner"`
+	Repo    string                    `json:"repo"`
+	Branch  string                    `json:"branch"`
+	Changes []ProtectionChange        `json:"changes"`
+	Request *github.ProtectionRequest `json:"request"`
+	Current *protectionState          `json:"current,omitempty"`
+}
+
+// ProtectionChange describes a single field that differs between the current
+// and the desired protection of a branch.
+type ProtectionChange struct {
+	Field   string   `json:"field"`
+	Current string   `json:"current"`
+	Desired string   `json:"desired"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+const (
+	fieldProtected           = "protected"
+	fieldStrictChecks        = "required_status_checks.strict"
+	fieldChecks              = "required_status_checks.checks"
+	fieldReviewCount         = "required_pull_request_reviews.required_approving_review_count"
+	fieldDismissStaleReviews = "required_pull_request_reviews.dismiss_stale_reviews"
+	fieldCodeOwnerReviews    = "required_pull_request_reviews.require_code_owner_reviews"
+	fieldEnforceAdmins       = "enforce_admins"
+	fieldRestrictionUsers    = "restrictions.users"
+	fieldRestrictionTeams    = "restrictions.teams"
+	fieldRestrictionApps     = "restrictions.apps"
+)
+
+func NewCmdProtectPlan() *cobra.Command {
+	var (
+		org         string
+		out         string
+		includeFork bool
+		skipRepos   []string
+	)
+	cmd := &cobra.Command{
+		Use:               "plan",
+		Short:             "Show the branch protection changes protect would make",
+		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
+		Run: func(cmd *cobra.Command, args []string) {
+			runProtectPlan(org, out, includeFork, skipRepos)
+		},
+	}
+	cmd.Flags().StringVar(&org, "org", "", "If set, only plan repos in this organization")
+	cmd.Flags().StringVar(&out, "out", "", "If set, write the plan to this file as JSON. With --checkpoint, the plan of the repos done in an earlier run is kept.")
+	cmd.Flags().BoolVar(&includeFork, "fork", false, "If true, include forked repos")
+	cmd.Flags().StringSliceVar(&skipRepos, "skip", nil, "Skip owner/repository")
+	cmd.Flags().IntVar(&shards, "shards", shards, "Total number of shards")
+	cmd.Flags().IntVar(&shardIndex, "shard-index", shardIndex, "Shard Index to be processed")
+	cmd.Flags().StringVar(&protectionPolicyFile, "policy", protectionPolicyFile, "Path to branch protection policy file (YAML or JSON). Uses the built-in policy if empty.")
+	addBranchPatternFlag(cmd)
+	addDiscoverChecksFlags(cmd)
+	addMergeProtectionFlag(cmd)
+	addRepoSelectorFlag(cmd)
+	return cmd
+}
+
+func NewCmdProtectApply() *cobra.Command {
+	var planFile string
+	cmd := &cobra.Command{
+		Use:               "apply",
+		Short:             "Apply a plan saved with protect plan --out",
+		Long:              "Apply a plan saved with protect plan --out. Before a branch is updated, its protection is fetched again and a warning is printed if it changed since the plan was made.",
+		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
+		Run: func(cmd *cobra.Command, args []string) {
+			runProtectApply(planFile)
+		},
+	}
+	cmd.Flags().StringVar(&planFile, "plan", "", "Path to plan file (required)")
+	_ = cmd.MarkFlagRequired("plan")
+	return cmd
+}
+
+func runProtectPlan(org, out string, includeFork bool, skipRepos []string) {
+	if err := validateProtectOptions(); err != nil {
+		log.Fatalln(err)
+	}
+
+	ctx := context.Background()
+	client := newGitHubClient(ctx)
+
+	plan, upToDate, planErr := planProtection(ctx, client, org, includeFork, skipRepos)
+	if out != "" && checkpointFile != "" {
+		prev, err := loadPlan(out)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Fatalln(err)
+		}
+		if prev != nil {
+			plan.resume(prev)
+		}
+	}
+	fmt.Printf("\nPlan: %d branch(es) to change, %d up to date.\n", len(plan.Branches), upToDate)
+
+	if out != "" {
+		if err := savePlan(out, plan); err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("plan saved to %s", out)
+	}
+	if planErr != nil {
+		log.Fatalln(planErr)
+	}
+}
+
+// planProtection plans the repos of the orgs in the shard selected by
+// --shard-index, or only the repos of org if set. The repos are walked with
+// runFleet like protect does. The plan of the repos that were planned is
+// returned even if the run fails, together with the number of branches that
+// are up to date.
+func planProtection(ctx context.Context, client *github.Client, org string, includeFork bool, skipRepos []string) (*ProtectionPlan, int, error) {
+	plan := &ProtectionPlan{
+		GeneratedAt: time.Now().UTC(),
+		Policy:      policySource(protectionPolicyFile),
+	}
+
+	selector, err := currentBranchSelector()
+	if err != nil {
+		return plan, 0, err
+	}
+	sel, err := newRepoSelector(defaultRepoTerms(includeFork, "owner-type=organization"))
+	if err != nil {
+		return plan, 0, err
+	}
+
+	orgs, err := ListOrgs(ctx, client, &github.ListOptions{PerPage: 50})
+	if err != nil {
+		return plan, 0, err
+	}
+	orgs = ShardOrgs(orgs, shardIndex, shards)
+	planOrgs := sets.NewString()
+	for _, o := range orgs {
+		if org == "" || o.GetLogin() == org {
+			planOrgs.Insert(o.GetLogin())
+		}
+	}
+	log.Printf("Found %d orgs", planOrgs.Len())
+
+	var repos []*github.Repository
+	if org != "" {
+		repos, err = ListOrgRepos(ctx, client, org, &github.RepositoryListByOrgOptions{
+			ListOptions: github.ListOptions{PerPage: 50},
+		}, sel)
+	} else {
+		repos, err = ListRepos(ctx, client, &github.RepositoryListByAuthenticatedUserOptions{
+			Affiliation: "owner,organization_member",
+			ListOptions: github.ListOptions{PerPage: 50},
+		}, sel)
+	}
+	if err != nil {
+		return plan, 0, err
+	}
+	repos = slices.DeleteFunc(repos, func(repo *github.Repository) bool {
+		return !planOrgs.Has(repo.GetOwner().GetLogin())
+	})
+	skipSet := sets.NewString(skipRepos...)
+	log.Printf("Found %d repositories", len(repos))
+
+	var (
+		mu       sync.Mutex
+		upToDate int
+	)
+	err = runFleet(ctx, repos, func(ctx context.Context, repo *github.Repository) error {
+		if !repo.GetPermissions().GetAdmin() {
+			return skipRepo("no admin permission")
+		}
+		supported, reason, err := repoSupportsProtection(ctx, client, repo)
+		if err != nil {
+			return err
+		}
+		if !supported {
+			return skipRepo(reason)
+		}
+		if skipSet.Has(repo.GetFullName()) {
+			return skipRepo("in skip list")
+		}
+
+		branches, err := ListBranches(ctx, client, repo)
+		if err != nil {
+			return err
+		}
+		var bps []BranchPlan
+		current := 0
+		for _, branch := range branches {
+			if !selector.Matches(repo, branch.GetName()) {
+				continue
+			}
+			bp, err := planBranch(ctx, client, repo.GetOwner().GetLogin(), repo.GetName(), branch.GetName())
+			if err != nil {
+				return fmt.Errorf("branch %s: %w", branch.GetName(), err)
+			}
+			if bp == nil {
+				current++
+				continue
+			}
+			printBranchPlan(ctx, *bp)
+			bps = append(bps, *bp)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		plan.Repos = append(plan.Repos, repo.GetFullName())
+		plan.Branches = append(plan.Branches, bps...)
+		upToDate += current
+		return nil
+	})
+
+	plan.sort()
+	return plan, upToDate, err
+}
+
+// planBranch returns the changes protect would make to a branch, or nil if
+// the branch is protected as desired.
+func planBranch(ctx context.Context, client *github.Client, owner, repo, branch string) (*BranchPlan, error) {
+	current, err := getBranchProtection(ctx, client, owner, repo, branch)
+	if err != nil {
+		return nil, err
+	}
+	desired, err := desiredProtectionRequest(ctx, client, owner, repo, branch, current)
+	if err != nil {
+		return nil, err
+	}
+	changes := diffProtection(current, desired)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	state := stateFromProtection(current)
+	return &BranchPlan{
+		Owner:   owner,
+		Repo:    repo,
+		Branch:  branch,
+		Changes: changes,
+		Request: desired,
+		Current: &state,
+	}, nil
+}
+
+func (p *ProtectionPlan) sort() {
+	slices.Sort(p.Repos)
+	slices.SortFunc(p.Branches, func(a, b BranchPlan) int {
+		return cmp.Or(
+			strings.Compare(a.Owner, b.Owner),
+			strings.Compare(a.Repo, b.Repo),
+			strings.Compare(a.Branch, b.Branch),
+		)
+	})
+}
+
+// resume adds the repos of prev that were not planned again to the plan, so
+// that a plan resumed with --checkpoint also covers the repos of the earlier
+// runs.
+func (p *ProtectionPlan) resume(prev *ProtectionPlan) {
+	planned := sets.NewString(p.Repos...)
+	for _, repo := range prev.Repos {
+		if !planned.Has(repo) {
+			p.Repos = append(p.Repos, repo)
+		}
+	}
+	for _, bp := range prev.Branches {
+		if !planned.Has(bp.Owner + "/" + bp.Repo) {
+			p.Branches = append(p.Branches, bp)
+		}
+	}
+	p.sort()
+}
+
+func loadPlan(filename string) (*ProtectionPlan, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var plan ProtectionPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan %s: %w", filename, err)
+	}
+	return &plan, nil
+}
+
+func savePlan(filename string, plan *ProtectionPlan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o644)
+}
+func runProtectApply(planFile string) {
+	plan, err := loadPlan(planFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	ctx := context.Background()
+	client := newGitHubClient(ctx)
+
+	applied, err := applyProtectionPlan(ctx, client, plan)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("applied protection changes to %d branch(es)", applied)
+}
+
+// applyProtectionPlan updates the branches of plan and returns the number of
+// updated branches. The protection of every branch is fetched first, and a
+// warning is logged if it no longer matches the protection the plan was
+// computed from, since the update overwrites those changes.
+func applyProtectionPlan(ctx context.Context, client *github.Client, plan *ProtectionPlan) (int, error) {
+	applied := 0
+	for _, b := range plan.Branches {
+		if len(b.Changes) == 0 || b.Request == nil {
+			continue
+		}
+		if b.Current != nil {
+			current, err := getBranchProtection(ctx, client, b.Owner, b.Repo, b.Branch)
+			if err != nil {
+				return applied, err
+			}
+			if drift := diffStates(*b.Current, stateFromProtection(current)); len(drift) > 0 {
+				log.Printf("WARNING: protection of %s/%s:%s changed since the plan was made, the update overwrites:", b.Owner, b.Repo, b.Branch)
+				for _, c := range drift {
+					log.Printf("    %s: planned %s, found %s", c.Field, c.Current, c.Desired)
+				}
+			}
+		}
+		fmt.Printf("[UPDATE] %s/%s:%s\n", b.Owner, b.Repo, b.Branch)
+		if _, _, err := client.Repositories.UpdateBranchProtection(ctx, b.Owner, b.Repo, b.Branch, b.Request); err != nil {
+			return applied, err
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// getBranchProtection returns the current protection of a branch, or nil if
+// the branch is not protected.
+func getBranchProtection(ctx context.Context, client *github.Client, owner, repo, branch string) (*github.Protection, error) {
+	p, _, err := client.Repositories.GetBranchProtection(ctx, owner, repo, branch)
+	if err != nil {
+		if errors.Is(err, github.ErrBranchNotProtected) {
+			return nil, nil
+		}
+		if e, ok := err.(*github.ErrorResponse); ok && e.Response != nil && e.Response.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// protectionState is the subset of branch protection settings that protect
+// manages, in a form that can be compared across requests and responses.
+type protectionState struct {
+	Protected           bool     `json:"protected"`
+	StrictChecks        bool     `json:"strictChecks"`
+	Checks              []string `json:"checks,omitempty"`
+	ReviewCount         int      `json:"reviewCount"`
+	DismissStaleReviews bool     `json:"dismissStaleReviews"`
+	CodeOwnerReviews    bool     `json:"codeOwnerReviews"`
+	EnforceAdmins       bool     `json:"enforceAdmins"`
+	RestrictionUsers    []string `json:"restrictionUsers,omitempty"`
+	RestrictionTeams    []string `json:"restrictionTeams,omitempty"`
+	RestrictionApps     []string `json:"restrictionApps,omitempty"`
+}
+
+func stateFromProtection(p *github.Protection) protectionState {
+	var s protectionState
+	if p == nil {
+		return s
+	}
+	s.Protected = true
+	if rsc := p.RequiredStatusChecks; rsc != nil {
+		s.StrictChecks = rsc.Strict
+		switch {
+		case rsc.Checks != nil:
+			for _, c := range *rsc.Checks {
+				s.Checks = append(s.Checks, c.Context)
+			}
+		case rsc.Contexts != nil:
+			s.Checks = append(s.Checks, *rsc.Contexts...)
+		}
+	}
+	if r := p.RequiredPullRequestReviews; r != nil {
+		s.ReviewCount = r.RequiredApprovingReviewCount
+		s.DismissStaleReviews = r.DismissStaleReviews
+		s.CodeOwnerReviews = r.RequireCodeOwnerReviews
+	}
+	if p.EnforceAdmins != nil {
+		s.EnforceAdmins = p.EnforceAdmins.Enabled
+	}
+	if r := p.Restrictions; r != nil {
+		for _, u := range r.Users {
+			s.RestrictionUsers = append(s.RestrictionUsers, u.GetLogin())
+		}
+		for _, t := range r.Teams {
+			s.RestrictionTeams = append(s.RestrictionTeams, t.GetSlug())
+		}
+		for _, a := range r.Apps {
+			s.RestrictionApps = append(s.RestrictionApps, a.GetSlug())
+		}
+	}
+	s.normalize()
+	return s
+}
+
+func stateFromRequest(p *github.ProtectionRequest) protectionState {
+	var s protectionState
+	if p == nil {
+		return s
+	}
+	s.Protected = true
+	if rsc := p.RequiredStatusChecks; rsc != nil {
+		s.StrictChecks = rsc.Strict
+		switch {
+		case rsc.Checks != nil:
+			for _, c := range *rsc.Checks {
+				s.Checks = append(s.Checks, c.Context)
+			}
+		case rsc.Contexts != nil:
+			s.Checks = append(s.Checks, *rsc.Contexts...)
+		}
+	}
+	if r := p.RequiredPullRequestReviews; r != nil {
+		s.ReviewCount = r.RequiredApprovingReviewCount
+		s.DismissStaleReviews = r.DismissStaleReviews
+		s.CodeOwnerReviews = r.RequireCodeOwnerReviews
+	}
+	s.EnforceAdmins = p.EnforceAdmins
+	if r := p.Restrictions; r != nil {
+		s.RestrictionUsers = slices.Clone(r.Users)
+		s.RestrictionTeams = slices.Clone(r.Teams)
+		s.RestrictionApps = slices.Clone(r.Apps)
+	}
+	s.normalize()
+	return s
+}
+
+func (s *protectionState) normalize() {
+	clean := func(in []string) []string {
+		out := sets.NewString()
+		for _, v := range in {
+			if v = strings.TrimSpace(v); v != "" {
+				out.Insert(v)
+			}
+		}
+		return out.List()
+	}
+	s.Checks = clean(s.Checks)
+	s.RestrictionUsers = clean(s.RestrictionUsers)
+	s.RestrictionTeams = clean(s.RestrictionTeams)
+	s.RestrictionApps = clean(s.RestrictionApps)
+}
+
+// diffProtection compares the current protection of a branch against the
+// desired request field by field. A nil current means the branch is not
+// protected.
+func diffProtection(current *github.Protection, desired *github.ProtectionRequest) []ProtectionChange {
+	return diffStates(stateFromProtection(current), stateFromRequest(desired))
+}
+
+// diffStates compares two protection states field by field.
+func diffStates(cur, want protectionState) []ProtectionChange {
+	var changes []ProtectionChange
+	boolField := func(field string, c, d bool) {
+		if c != d {
+			changes = append(changes, ProtectionChange{Field: field, Current: strconv.FormatBool(c), Desired: strconv.FormatBool(d)})
+		}
+	}
+	listField := func(field string, c, d []string) {
+		added := sets.NewString(d...).Difference(sets.NewString(c...)).List()
+		removed := sets.NewString(c...).Difference(sets.NewString(d...)).List()
+		if len(added) == 0 && len(removed) == 0 {
+			return
+		}
+		changes = append(changes, ProtectionChange{
+			Field:   field,
+			Current: formatList(c),
+			Desired: formatList(d),
+			Added:   added,
+			Removed: removed,
+		})
+	}
+
+	boolField(fieldProtected, cur.Protected, want.Protected)
+	boolField(fieldStrictChecks, cur.StrictChecks, want.StrictChecks)
+	listField(fieldChecks, cur.Checks, want.Checks)
+	if cur.ReviewCount != want.ReviewCount {
+		changes = append(changes, ProtectionChange{Field: fieldReviewCount, Current: strconv.Itoa(cur.ReviewCount), Desired: strconv.Itoa(want.ReviewCount)})
+	}
+	boolField(fieldDismissStaleReviews, cur.DismissStaleReviews, want.DismissStaleReviews)
+	boolField(fieldCodeOwnerReviews, cur.CodeOwnerReviews, want.CodeOwnerReviews)
+	boolField(fieldEnforceAdmins, cur.EnforceAdmins, want.EnforceAdmins)
+	listField(fieldRestrictionUsers, cur.RestrictionUsers, want.RestrictionUsers)
+	listField(fieldRestrictionTeams, cur.RestrictionTeams, want.RestrictionTeams)
+	listField(fieldRestrictionApps, cur.RestrictionApps, want.RestrictionApps)
+	return changes
+}
+
+func formatList(in []string) string {
+	return "[" + strings.Join(in, ", ") + "]"
+}
+
+func printBranchPlan(ctx context.Context, bp BranchPlan) {
+	printf(ctx, "~ %s/%s:%s\n", bp.Owner, bp.Repo, bp.Branch)
+	for _, c := range bp.Changes {
+		if len(c.Added) > 0 || len(c.Removed) > 0 {
+			for _, v := range c.Removed {
+				printf(ctx, "    - %s: %s\n", c.Field, v)
+			}
+			for _, v := range c.Added {
+				printf(ctx, "    + %s: %s\n", c.Field, v)
+			}
+			continue
+		}
+		printf(ctx, "    %s: %s => %s\n", c.Field, c.Current, c.Desired)
+	}
+}
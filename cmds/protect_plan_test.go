@@ -0,0 +1,169 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffProtection(t *testing.T) {
+	p, err := loadProtectionPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desired := p.ProtectionRequest("kubedb", "apimachinery", "master")
+
+	current := &github.Protection{
+		RequiredStatusChecks: &github.RequiredStatusChecks{
+			Strict: true,
+			Checks: &[]*github.RequiredStatusCheck{{Context: "DCO"}, {Context: "Build"}},
+		},
+		RequiredPullRequestReviews: &github.PullRequestReviewsEnforcement{
+			DismissStaleReviews:          true,
+			RequiredApprovingReviewCount: 1,
+		},
+		EnforceAdmins: &github.AdminEnforcement{Enabled: true},
+		Restrictions: &github.BranchRestrictions{
+			Apps: []*github.App{{Slug: github.Ptr("kodiak-appscode")}},
+		},
+	}
+	assert.Empty(t, diffProtection(current, desired))
+
+	current.EnforceAdmins.Enabled = false
+	current.RequiredPullRequestReviews.RequiredApprovingReviewCount = 2
+	current.RequiredStatusChecks.Checks = &[]*github.RequiredStatusCheck{{Context: "DCO"}, {Context: "lint"}}
+	changes := diffProtection(current, desired)
+	assert.Equal(t, []ProtectionChange{
+		{Field: fieldChecks, Current: "[DCO, lint]", Desired: "[Build, DCO]", Added: []string{"Build"}, Removed: []string{"lint"}},
+		{Field: fieldReviewCount, Current: "2", Desired: "1"},
+		{Field: fieldEnforceAdmins, Current: "false", Desired: "true"},
+	}, changes)
+
+	changes = diffProtection(nil, desired)
+	assert.Equal(t, fieldProtected, changes[0].Field)
+}
+
+func TestPlanBranchMerge(t *testing.T) {
+	defer func(m bool) { mergeProtection = m }(mergeProtection)
+
+	srv, client := useFakeGitHub(t)
+	fake := srv.AddRepo("kubedb", "mysql")
+	fake.SetProtection("master", &github.Protection{
+		RequiredStatusChecks: &github.RequiredStatusChecks{
+			Strict: true,
+			Checks: &[]*github.RequiredStatusCheck{{Context: "DCO"}, {Context: "Build"}, {Context: "e2e"}},
+		},
+		RequiredPullRequestReviews: &github.PullRequestReviewsEnforcement{
+			DismissStaleReviews:          true,
+			RequiredApprovingReviewCount: 1,
+		},
+		EnforceAdmins: &github.AdminEnforcement{Enabled: true},
+		Restrictions: &github.BranchRestrictions{
+			Apps: []*github.App{{Slug: github.Ptr("kodiak-appscode")}},
+		},
+	})
+
+	ctx := context.Background()
+	bp, err := planBranch(ctx, client, "kubedb", "mysql", "master")
+	if assert.NoError(t, err) && assert.NotNil(t, bp) {
+		assert.Equal(t, []ProtectionChange{
+			{Field: fieldChecks, Current: "[Build, DCO, e2e]", Desired: "[Build, DCO]", Added: []string{}, Removed: []string{"e2e"}},
+		}, bp.Changes)
+	}
+
+	// with --merge, the plan keeps the extra check like protect does
+	mergeProtection = true
+	bp, err = planBranch(ctx, client, "kubedb", "mysql", "master")
+	assert.NoError(t, err)
+	assert.Nil(t, bp)
+}
+
+func TestPlanProtectionShardsOrgs(t *testing.T) {
+	defer func(i, n, c int) { shardIndex, shards, concurrency = i, n, c }(shardIndex, shards, concurrency)
+	shardIndex, shards, concurrency = 1, 2, 4
+	captureLog(t)
+
+	srv, client := useFakeGitHub(t)
+	for _, org := range []string{"kubedb", "stashed"} {
+		srv.AddOrg(org)
+		srv.AddRepo(org, "apimachinery").AddBranch("release-1.0")
+		srv.AddRepo(org, "installer")
+	}
+
+	ctx := context.Background()
+	var plan *ProtectionPlan
+	var upToDate int
+	var err error
+	captureStdout(t, func() {
+		plan, upToDate, err = planProtection(ctx, client, "", false, []string{"stashed/installer"})
+	})
+	assert.NoError(t, err)
+	assert.Zero(t, upToDate)
+	assert.Equal(t, []string{"stashed/apimachinery"}, plan.Repos)
+	var branches []string
+	for _, bp := range plan.Branches {
+		branches = append(branches, bp.Owner+"/"+bp.Repo+":"+bp.Branch)
+		assert.Equal(t, &protectionState{}, bp.Current)
+	}
+	assert.Equal(t, []string{"stashed/apimachinery:master", "stashed/apimachinery:release-1.0"}, branches)
+	assert.Empty(t, mutatingRequests(srv))
+
+	// a resumed run keeps the repos planned before
+	prev := &ProtectionPlan{
+		Repos:    []string{"kubedb/apimachinery", "stashed/apimachinery"},
+		Branches: []BranchPlan{{Owner: "kubedb", Repo: "apimachinery", Branch: "master"}, {Owner: "stashed", Repo: "apimachinery", Branch: "stale"}},
+	}
+	plan.resume(prev)
+	assert.Equal(t, []string{"kubedb/apimachinery", "stashed/apimachinery"}, plan.Repos)
+	assert.Len(t, plan.Branches, 3)
+	assert.Equal(t, "kubedb", plan.Branches[0].Owner)
+}
+
+func TestApplyProtectionPlanWarnsOnDrift(t *testing.T) {
+	buf := captureLog(t)
+	srv, client := useFakeGitHub(t)
+	srv.AddOrg("kubedb")
+	fake := srv.AddRepo("kubedb", "mysql").AddBranch("release-1.0")
+
+	ctx := context.Background()
+	var plan ProtectionPlan
+	for _, branch := range []string{"master", "release-1.0"} {
+		bp, err := planBranch(ctx, client, "kubedb", "mysql", branch)
+		if assert.NoError(t, err) && assert.NotNil(t, bp) {
+			plan.Branches = append(plan.Branches, *bp)
+		}
+	}
+
+	// someone protects release-1.0 by hand after the plan was made
+	fake.SetProtection("release-1.0", &github.Protection{EnforceAdmins: &github.AdminEnforcement{Enabled: true}})
+
+	var applied int
+	var err error
+	captureStdout(t, func() {
+		applied, err = applyProtectionPlan(ctx, client, &plan)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, applied)
+	assert.NotContains(t, buf.String(), "kubedb/mysql:master changed")
+	assert.Contains(t, buf.String(), "WARNING: protection of kubedb/mysql:release-1.0 changed since the plan was made")
+	assert.Contains(t, buf.String(), "protected: planned false, found true")
+	assert.NotNil(t, fake.Protection("master"))
+}
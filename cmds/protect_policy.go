@@ -0,0 +1,299 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v84/github"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed protect_policy.yaml
+var defaultProtectionPolicy []byte
+
+var (
+	protectionPolicyFile string
+	protectionPolicy     *ProtectionPolicy
+)
+
+// ProtectionPolicy describes how branches are protected. It is loaded from a
+// YAML or JSON file passed with --policy, or from the embedded
+// protect_policy.yaml when no file is given.
+type ProtectionPolicy struct {
+	BranchPatterns []string                  `json:"branchPatterns,omitempty" yaml:"branchPatterns,omitempty"`
+	CheckSets      map[string][]string       `json:"checkSets,omitempty" yaml:"checkSets,omitempty"`
+	Defaults       ProtectionRule            `json:"defaults" yaml:"defaults"`
+	Branches       []BranchProtectionRule    `json:"branches,omitempty" yaml:"branches,omitempty"`
+	Orgs           map[string]ProtectionRule `json:"orgs,omitempty" yaml:"orgs,omitempty"`
+	Repos          map[string]ProtectionRule `json:"repos,omitempty" yaml:"repos,omitempty"`
+}
+
+// BranchProtectionRule applies a ProtectionRule to branches matching Pattern.
+type BranchProtectionRule struct {
+	Pattern        string `json:"pattern" yaml:"pattern"`
+	ProtectionRule `yaml:",inline"`
+}
+
+// ProtectionRule holds the protection settings at one level of the policy.
+// Unset fields inherit the value from the previous level.
+type ProtectionRule struct {
+	StrictChecks                 *bool    `json:"strictChecks,omitempty" yaml:"strictChecks,omitempty"`
+	Checks                       []string `json:"checks,omitempty" yaml:"checks,omitempty"`
+	AddChecks                    []string `json:"addChecks,omitempty" yaml:"addChecks,omitempty"`
+	AddCheckSets                 []string `json:"addCheckSets,omitempty" yaml:"addCheckSets,omitempty"`
+	DismissStaleReviews          *bool    `json:"dismissStaleReviews,omitempty" yaml:"dismissStaleReviews,omitempty"`
+	RequireCodeOwnerReviews      *bool    `json:"requireCodeOwnerReviews,omitempty" yaml:"requireCodeOwnerReviews,omitempty"`
+	RequiredApprovingReviewCount *int     `json:"requiredApprovingReviewCount,omitempty" yaml:"requiredApprovingReviewCount,omitempty"`
+	EnforceAdmins                *bool    `json:"enforceAdmins,omitempty" yaml:"enforceAdmins,omitempty"`
+	RestrictionUsers             []string `json:"restrictionUsers,omitempty" yaml:"restrictionUsers,omitempty"`
+	RestrictionTeams             []string `json:"restrictionTeams,omitempty" yaml:"restrictionTeams,omitempty"`
+	RestrictionApps              []string `json:"restrictionApps,omitempty" yaml:"restrictionApps,omitempty"`
+}
+
+// currentProtectionPolicy returns the policy selected with --policy, loading
+// it on first use.
+func currentProtectionPolicy() (*ProtectionPolicy, error) {
+	if protectionPolicy != nil {
+		return protectionPolicy, nil
+	}
+	p, err := loadProtectionPolicy(protectionPolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	protectionPolicy = p
+	return p, nil
+}
+
+func loadProtectionPolicy(filename string) (*ProtectionPolicy, error) {
+	data := defaultProtectionPolicy
+	if filename != "" {
+		var err error
+		data, err = os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var p ProtectionPolicy
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("failed to parse protection policy %s: %w", policySource(filename), err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid protection policy %s: %w", policySource(filename), err)
+	}
+	return &p, nil
+}
+
+func policySource(filename string) string {
+	if filename == "" {
+		return "(built-in)"
+	}
+	return filename
+}
+
+func (p *ProtectionPolicy) validate() error {
+	check := func(where string, r ProtectionRule) error {
+		for _, name := range r.AddCheckSets {
+			if _, ok := p.CheckSets[name]; !ok {
+				return fmt.Errorf("%s refers to unknown check set %q", where, name)
+			}
+		}
+		if r.RequiredApprovingReviewCount != nil {
+			if n := *r.RequiredApprovingReviewCount; n < 0 || n > 6 {
+				return fmt.Errorf("%s sets requiredApprovingReviewCount to %d, must be between 0 and 6", where, n)
+			}
+		}
+		return nil
+	}
+
+	if len(p.BranchPatterns) > 0 {
+		if _, err := parseBranchSelector(p.BranchPatterns); err != nil {
+			return err
+		}
+	}
+	if err := check("defaults", p.Defaults); err != nil {
+		return err
+	}
+	for i, b := range p.Branches {
+		if b.Pattern == "" {
+			return fmt.Errorf("branches[%d] is missing pattern", i)
+		}
+		if _, err := path.Match(b.Pattern, ""); err != nil {
+			return fmt.Errorf("branches[%d] has invalid pattern %q: %w", i, b.Pattern, err)
+		}
+		if err := check(fmt.Sprintf("branches[%d]", i), b.ProtectionRule); err != nil {
+			return err
+		}
+	}
+	for org, r := range p.Orgs {
+		if err := check("orgs."+org, r); err != nil {
+			return err
+		}
+	}
+	for key, r := range p.Repos {
+		if _, err := path.Match(key, ""); err != nil {
+			return fmt.Errorf("repos.%s is not a valid pattern: %w", key, err)
+		}
+		if err := check("repos."+key, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolvedProtection is the effective protection for a single branch after
+// all matching policy rules have been applied.
+type ResolvedProtection struct {
+	StrictChecks                 bool
+	Checks                       []string
+	DismissStaleReviews          bool
+	RequireCodeOwnerReviews      bool
+	RequiredApprovingReviewCount int
+	EnforceAdmins                bool
+	RestrictionUsers             []string
+	RestrictionTeams             []string
+	RestrictionApps              []string
+}
+
+// Resolve applies the matching policy rules for owner/repo:branch.
+func (p *ProtectionPolicy) Resolve(owner, repo, branch string) ResolvedProtection {
+	var out ResolvedProtection
+	p.apply(&out, p.Defaults)
+
+	for _, b := range p.Branches {
+		if ok, _ := path.Match(b.Pattern, branch); ok {
+			p.apply(&out, b.ProtectionRule)
+		}
+	}
+
+	if r, ok := p.Orgs[owner]; ok {
+		p.apply(&out, r)
+	}
+
+	fullName := strings.ToLower(owner + "/" + repo)
+	var byName, byFullName []string
+	for key := range p.Repos {
+		if strings.Contains(key, "/") {
+			if ok, _ := path.Match(strings.ToLower(key), fullName); ok {
+				byFullName = append(byFullName, key)
+			}
+		} else {
+			if ok, _ := path.Match(strings.ToLower(key), strings.ToLower(repo)); ok {
+				byName = append(byName, key)
+			}
+		}
+	}
+	sort.Strings(byName)
+	sort.Strings(byFullName)
+	for _, key := range append(byName, byFullName...) {
+		p.apply(&out, p.Repos[key])
+	}
+
+	return out
+}
+
+func (p *ProtectionPolicy) apply(out *ResolvedProtection, r ProtectionRule) {
+	if r.StrictChecks != nil {
+		out.StrictChecks = *r.StrictChecks
+	}
+	if r.Checks != nil {
+		out.Checks = slices.Clone(r.Checks)
+	}
+	out.Checks = appendMissing(out.Checks, r.AddChecks...)
+	for _, name := range r.AddCheckSets {
+		out.Checks = appendMissing(out.Checks, p.CheckSets[name]...)
+	}
+	if r.DismissStaleReviews != nil {
+		out.DismissStaleReviews = *r.DismissStaleReviews
+	}
+	if r.RequireCodeOwnerReviews != nil {
+		out.RequireCodeOwnerReviews = *r.RequireCodeOwnerReviews
+	}
+	if r.RequiredApprovingReviewCount != nil {
+		out.RequiredApprovingReviewCount = *r.RequiredApprovingReviewCount
+	}
+	if r.EnforceAdmins != nil {
+		out.EnforceAdmins = *r.EnforceAdmins
+	}
+	if r.RestrictionUsers != nil {
+		out.RestrictionUsers = slices.Clone(r.RestrictionUsers)
+	}
+	if r.RestrictionTeams != nil {
+		out.RestrictionTeams = slices.Clone(r.RestrictionTeams)
+	}
+	if r.RestrictionApps != nil {
+		out.RestrictionApps = slices.Clone(r.RestrictionApps)
+	}
+}
+
+// ProtectionRequest builds the branch protection request for owner/repo:branch.
+func (p *ProtectionPolicy) ProtectionRequest(owner, repo, branch string) *github.ProtectionRequest {
+	r := p.Resolve(owner, repo, branch)
+
+	checks := make([]*github.RequiredStatusCheck, 0, len(r.Checks))
+	for _, c := range r.Checks {
+		checks = append(checks, &github.RequiredStatusCheck{Context: c})
+	}
+
+	return &github.ProtectionRequest{
+		RequiredStatusChecks: &github.RequiredStatusChecks{
+			Strict: r.StrictChecks,
+			Checks: &checks,
+		},
+		RequiredPullRequestReviews: &github.PullRequestReviewsEnforcementRequest{
+			DismissStaleReviews: r.DismissStaleReviews,
+			DismissalRestrictionsRequest: &github.DismissalRestrictionsRequest{
+				Users: nil,
+				Teams: nil,
+			},
+			RequireCodeOwnerReviews:      r.RequireCodeOwnerReviews,
+			RequiredApprovingReviewCount: r.RequiredApprovingReviewCount,
+		},
+		EnforceAdmins: r.EnforceAdmins,
+		Restrictions: &github.BranchRestrictionsRequest{
+			Users: nonNilStrings(r.RestrictionUsers),
+			Teams: nonNilStrings(r.RestrictionTeams),
+			Apps:  nonNilStrings(r.RestrictionApps),
+		},
+	}
+}
+
+func appendMissing(in []string, items ...string) []string {
+	for _, item := range items {
+		if !slices.Contains(in, item) {
+			in = append(in, item)
+		}
+	}
+	return in
+}
+
+func nonNilStrings(in []string) []string {
+	if in == nil {
+		return []string{}
+	}
+	return in
+}
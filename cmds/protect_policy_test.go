@@ -0,0 +1,111 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var kubernetesChecks = []string{
+	"Kubernetes (v1.29.14)",
+	"Kubernetes (v1.31.14)",
+	"Kubernetes (v1.33.7)",
+	"Kubernetes (v1.35.0)",
+}
+
+func TestDefaultProtectionPolicy(t *testing.T) {
+	p, err := loadProtectionPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		owner, repo, branch string
+		checks              []string
+		enforceAdmins       bool
+		dismissStale        bool
+		apps                []string
+	}{
+		{"kubedb", "apimachinery", "master", []string{"Build", "DCO"}, true, true, []string{"kodiak-appscode"}},
+		{"kubedb", "apimachinery", "release-1.0", []string{"Build", "DCO"}, false, true, []string{"kodiak-appscode"}},
+		{"stashed", "apimachinery", "main", []string{"Build", "DCO"}, true, true, []string{"kodiakhq"}},
+		{"stashed", "catalog", "master", append([]string{"Build", "DCO"}, kubernetesChecks...), true, true, []string{"kodiakhq"}},
+		{"kubedb", "installer", "master", append([]string{"Build", "DCO"}, kubernetesChecks...), true, true, []string{"kodiak-appscode"}},
+		{"voyagermesh", "voyager", "master", append([]string{"Build", "DCO"}, kubernetesChecks...), true, true, []string{"kodiakhq"}},
+		{"kubedb", "docs", "master", []string{"Build", "DCO"}, false, true, []string{"kodiak-appscode"}},
+		{"appscodelabs", "gh-tools", "master", []string{"Build", "DCO"}, false, true, []string{"kodiakhq"}},
+		{"kubedb", "CHANGELOG", "master", []string{"DCO"}, true, false, []string{"kodiak-appscode"}},
+		{"kubedb", "changelog", "master", []string{"DCO"}, true, false, []string{"kodiak-appscode"}},
+		{"kubeform", "gen-repo-refresher", "master", []string{"DCO", "license/cla"}, true, true, []string{"kodiakhq"}},
+		{"kubeguard", "guard", "master", []string{"DCO", "Build"}, true, true, []string{"kodiakhq"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.owner+"/"+tt.repo+":"+tt.branch, func(t *testing.T) {
+			req := p.ProtectionRequest(tt.owner, tt.repo, tt.branch)
+
+			var checks []string
+			for _, c := range *req.RequiredStatusChecks.Checks {
+				checks = append(checks, c.Context)
+			}
+			assert.Equal(t, tt.checks, checks)
+			assert.True(t, req.RequiredStatusChecks.Strict)
+			assert.Equal(t, tt.enforceAdmins, req.EnforceAdmins)
+			assert.Equal(t, tt.dismissStale, req.RequiredPullRequestReviews.DismissStaleReviews)
+			assert.Equal(t, 1, req.RequiredPullRequestReviews.RequiredApprovingReviewCount)
+			assert.Equal(t, tt.apps, req.Restrictions.Apps)
+			assert.Equal(t, []string{}, req.Restrictions.Users)
+		})
+	}
+}
+
+func TestLoadProtectionPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	if err := os.WriteFile(valid, []byte(`{
+  "checkSets": {"e2e": ["e2e"]},
+  "defaults": {"checks": ["Build"], "requiredApprovingReviewCount": 2},
+  "repos": {"kube*": {"addCheckSets": ["e2e"]}}
+}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := loadProtectionPolicy(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := p.Resolve("kubedb", "kubedb-operator", "master")
+	assert.Equal(t, []string{"Build", "e2e"}, r.Checks)
+	assert.Equal(t, 2, r.RequiredApprovingReviewCount)
+
+	unknownSet := filepath.Join(dir, "unknown-set.yaml")
+	if err := os.WriteFile(unknownSet, []byte("defaults:\n  addCheckSets: [missing]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadProtectionPolicy(unknownSet)
+	assert.ErrorContains(t, err, `unknown check set "missing"`)
+
+	unknownField := filepath.Join(dir, "unknown-field.yaml")
+	if err := os.WriteFile(unknownField, []byte("defaults:\n  enforceAdmin: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadProtectionPolicy(unknownField)
+	assert.Error(t, err)
+}
@@ -35,6 +35,7 @@ func NewCmdProtectRepo() *cobra.Command {
 		Use:               "protect-repo",
 		Short:             "Protect master/main, release-*, kubernetes-*, and ac-* branches in a repository",
 		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			flags.PrintFlags(c.Flags())
 		},
@@ -44,10 +45,19 @@ func NewCmdProtectRepo() *cobra.Command {
 	}
 	cmd.Flags().StringVar(&owner, "owner", owner, "GitHub user or org name")
 	cmd.Flags().StringVar(&repo, "repo", repo, "GitHub repository name")
+	cmd.Flags().StringVar(&protectionPolicyFile, "policy", protectionPolicyFile, "Path to branch protection policy file (YAML or JSON). Uses the built-in policy if empty.")
+	addProtectBackendFlags(cmd)
+	addBranchPatternFlag(cmd)
+	addDiscoverChecksFlags(cmd)
+	addMergeProtectionFlag(cmd)
 	return cmd
 }
 
 func runProtectRepo(owner, repo string) {
+	if err := validateProtectOptions(); err != nil {
+		log.Fatalln(err)
+	}
+
 	ctx := context.Background()
 	client := newGitHubClient(ctx)
 
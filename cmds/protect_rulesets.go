@@ -0,0 +1,434 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/spf13/cobra"
+	"gomodules.xyz/sets"
+)
+
+const (
+	protectBackendClassic  = "classic"
+	protectBackendRulesets = "rulesets"
+
+	// repositoryAdminRoleID is the actor id of the built-in repository admin
+	// role when used as a ruleset bypass actor.
+	repositoryAdminRoleID = 5
+
+	// pushRestrictionRulesetSuffix is appended to the name of the ruleset
+	// that restricts who may push to the branches of a managed ruleset.
+	pushRestrictionRulesetSuffix = "push-restriction"
+)
+
+var (
+	protectBackend = protectBackendClassic
+	rulesetName    = "gh-tools"
+
+	appIDs   = map[string]int64{}
+	appIDsMu sync.Mutex
+)
+
+func addProtectBackendFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&protectBackend, "backend", protectBackend, "Protection backend: classic (branch protection) or rulesets (repository rulesets)")
+	cmd.Flags().StringVar(&rulesetName, "ruleset-name", rulesetName, "Name of the repository ruleset managed by the rulesets backend")
+}
+
+func validateProtectBackend() error {
+	switch protectBackend {
+	case protectBackendClassic, protectBackendRulesets:
+		return nil
+	default:
+		return fmt.Errorf("unknown protection backend %q, must be %s or %s", protectBackend, protectBackendClassic, protectBackendRulesets)
+	}
+}
+
+// ProtectRepoWithRulesets creates or updates the repository rulesets managed
+// by gh-tools so that they enforce the same rules as ProtectBranch. Rulesets
+// are matched by name: branch patterns that resolve to identical rules share
+// a ruleset called --ruleset-name, or --ruleset-name/<first pattern> when the
+// policy needs more than one ruleset. Push restrictions go to a ruleset of
+// the same name with a /push-restriction suffix. Like with the classic
+// backend, only the branches that exist are protected: the policy is resolved
+// for the branches a pattern matches, and patterns without any are left out.
+// Managed rulesets that are no longer needed are deleted.
+func ProtectRepoWithRulesets(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	owner := repo.GetOwner().GetLogin()
+	desired, err := desiredRepoRulesets(ctx, client, repo)
+	if err != nil {
+		return err
+	}
+
+	existing, err := listRepoRulesets(ctx, client, owner, repo.GetName())
+	if err != nil {
+		return err
+	}
+	byName := map[string]*github.RepositoryRuleset{}
+	for _, rs := range existing {
+		byName[rs.Name] = rs
+	}
+
+	keep := map[string]bool{}
+	for _, rs := range desired {
+		keep[rs.Name] = true
+
+		cur, ok := byName[rs.Name]
+		if !ok {
+			printf(ctx, "[CREATE] %s ruleset %q\n", repo.GetFullName(), rs.Name)
+			if dryrun {
+				continue
+			}
+			if _, _, err := client.Repositories.CreateRuleset(ctx, owner, repo.GetName(), rs); err != nil {
+				return err
+			}
+			continue
+		}
+
+		full, _, err := client.Repositories.GetRuleset(ctx, owner, repo.GetName(), cur.GetID(), false)
+		if err != nil {
+			return err
+		}
+		if rulesetsEqual(rulesetRequest(full), rs) {
+			continue
+		}
+		printf(ctx, "[UPDATE] %s ruleset %q (%d)\n", repo.GetFullName(), rs.Name, cur.GetID())
+		if dryrun {
+			continue
+		}
+		if _, _, err := client.Repositories.UpdateRuleset(ctx, owner, repo.GetName(), cur.GetID(), rs); err != nil {
+			return err
+		}
+	}
+
+	for _, rs := range existing {
+		if !isManagedRuleset(rs.Name) || keep[rs.Name] {
+			continue
+		}
+		printf(ctx, "[DELETE] %s ruleset %q (%d)\n", repo.GetFullName(), rs.Name, rs.GetID())
+		if dryrun {
+			continue
+		}
+		if _, err := client.Repositories.DeleteRuleset(ctx, owner, repo.GetName(), rs.GetID()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isManagedRuleset(name string) bool {
+	return name == rulesetName || strings.HasPrefix(name, rulesetName+"/")
+}
+
+func desiredRepoRulesets(ctx context.Context, client *github.Client, repo *github.Repository) ([]github.RepositoryRuleset, error) {
+	selector, err := currentBranchSelector()
+	if err != nil {
+		return nil, err
+	}
+	branches, err := ListBranches(ctx, client, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := repo.GetOwner().GetLogin()
+	type group struct {
+		patterns []refPattern
+		rulesets []github.RepositoryRuleset
+	}
+	var groups []*group
+	for _, pattern := range selector.RefPatterns(repo, branches) {
+		if len(pattern.branches) == 0 {
+			continue
+		}
+		p, err := refPatternProtectionRequest(ctx, client, owner, repo.GetName(), pattern)
+		if err != nil {
+			return nil, err
+		}
+		rulesets, err := rulesetsFromProtection(ctx, client, owner, p)
+		if err != nil {
+			return nil, err
+		}
+
+		var found *group
+		for _, g := range groups {
+			if slices.EqualFunc(g.rulesets, rulesets, rulesetsEqual) {
+				found = g
+				break
+			}
+		}
+		if found == nil {
+			found = &group{rulesets: rulesets}
+			groups = append(groups, found)
+		}
+		found.patterns = append(found.patterns, pattern)
+	}
+
+	var result []github.RepositoryRuleset
+	for _, g := range groups {
+		name := rulesetName
+		if len(groups) > 1 {
+			name = rulesetName + "/" + g.patterns[0].label
+		}
+		for i, rs := range g.rulesets {
+			rs.Name = name
+			if i > 0 {
+				rs.Name = name + "/" + pushRestrictionRulesetSuffix
+			}
+			include := make([]string, 0, len(g.patterns))
+			for _, p := range g.patterns {
+				include = append(include, p.ref)
+			}
+			rs.Conditions = &github.RepositoryRulesetConditions{
+				RefName: &github.RepositoryRulesetRefConditionParameters{
+					Include: include,
+					Exclude: []string{},
+				},
+			}
+			result = append(result, rs)
+		}
+	}
+	return result, nil
+}
+
+// refPatternProtectionRequest resolves the policy for every branch matched by
+// pattern. A ruleset applies the same rules to all of them, so it fails if the
+// policy protects them differently.
+func refPatternProtectionRequest(ctx context.Context, client *github.Client, owner, repo string, pattern refPattern) (*github.ProtectionRequest, error) {
+	var (
+		first string
+		req   *github.ProtectionRequest
+	)
+	for _, branch := range pattern.branches {
+		p, err := branchProtectionRequest(ctx, client, owner, repo, branch)
+		if err != nil {
+			return nil, err
+		}
+		if req == nil {
+			first, req = branch, p
+			continue
+		}
+		if !reflect.DeepEqual(stateFromRequest(req), stateFromRequest(p)) {
+			return nil, fmt.Errorf("the policy protects branches %s and %s of %s/%s differently, but a ruleset for %s protects them alike; select them with separate branch patterns", first, branch, owner, repo, pattern.label)
+		}
+	}
+	return req, nil
+}
+
+// rulesetsFromProtection translates a branch protection request into the
+// equivalent rulesets. The first ruleset holds the rules and lets admins
+// bypass them unless enforce_admins is set. Push restrictions only control who
+// may push, so they become a second ruleset with just the update rule: the
+// restricted apps and teams bypass it, but not the required checks and
+// reviews. Conditions and names are left for the caller to fill in.
+func rulesetsFromProtection(ctx context.Context, client *github.Client, owner string, p *github.ProtectionRequest) ([]github.RepositoryRuleset, error) {
+	rules := &github.RepositoryRulesetRules{
+		Deletion:       &github.EmptyRuleParameters{},
+		NonFastForward: &github.EmptyRuleParameters{},
+	}
+	if rsc := p.RequiredStatusChecks; rsc != nil {
+		params := &github.RequiredStatusChecksRuleParameters{
+			DoNotEnforceOnCreate:             github.Ptr(false),
+			RequiredStatusChecks:             []*github.RuleStatusCheck{},
+			StrictRequiredStatusChecksPolicy: rsc.Strict,
+		}
+		if rsc.Checks != nil {
+			for _, c := range *rsc.Checks {
+				params.RequiredStatusChecks = append(params.RequiredStatusChecks, &github.RuleStatusCheck{Context: c.Context, IntegrationID: c.AppID})
+			}
+		}
+		rules.RequiredStatusChecks = params
+	}
+	if r := p.RequiredPullRequestReviews; r != nil {
+		rules.PullRequest = &github.PullRequestRuleParameters{
+			AllowedMergeMethods: []github.PullRequestMergeMethod{
+				github.PullRequestMergeMethodMerge,
+				github.PullRequestMergeMethodSquash,
+				github.PullRequestMergeMethodRebase,
+			},
+			DismissStaleReviewsOnPush:    r.DismissStaleReviews,
+			RequireCodeOwnerReview:       r.RequireCodeOwnerReviews,
+			RequiredApprovingReviewCount: r.RequiredApprovingReviewCount,
+		}
+	}
+
+	adminBypass := []*github.BypassActor{}
+	if !p.EnforceAdmins {
+		adminBypass = append(adminBypass, &github.BypassActor{
+			ActorID:    github.Ptr(int64(repositoryAdminRoleID)),
+			ActorType:  github.Ptr(github.BypassActorTypeRepositoryRole),
+			BypassMode: github.Ptr(github.BypassModeAlways),
+		})
+	}
+	result := []github.RepositoryRuleset{{
+		Target:       github.Ptr(github.RulesetTargetBranch),
+		Enforcement:  github.RulesetEnforcementActive,
+		BypassActors: adminBypass,
+		Rules:        rules,
+	}}
+
+	r := p.Restrictions
+	if r == nil {
+		return result, nil
+	}
+	// only the restricted actors may update matching branches
+	bypass := slices.Clone(adminBypass)
+	for _, slug := range r.Apps {
+		if slug == "" {
+			continue
+		}
+		id, err := getAppID(ctx, client, slug)
+		if err != nil {
+			return nil, err
+		}
+		bypass = append(bypass, &github.BypassActor{
+			ActorID:    github.Ptr(id),
+			ActorType:  github.Ptr(github.BypassActorTypeIntegration),
+			BypassMode: github.Ptr(github.BypassModeAlways),
+		})
+	}
+	for _, slug := range r.Teams {
+		if slug == "" {
+			continue
+		}
+		t, _, err := client.Teams.GetTeamBySlug(ctx, owner, slug)
+		if err != nil {
+			return nil, err
+		}
+		bypass = append(bypass, &github.BypassActor{
+			ActorID:    t.ID,
+			ActorType:  github.Ptr(github.BypassActorTypeTeam),
+			BypassMode: github.Ptr(github.BypassModeAlways),
+		})
+	}
+	for _, login := range r.Users {
+		if login != "" {
+			logf(ctx, "WARNING: rulesets can not grant bypass to user %s; ignored", login)
+		}
+	}
+	return append(result, github.RepositoryRuleset{
+		Target:       github.Ptr(github.RulesetTargetBranch),
+		Enforcement:  github.RulesetEnforcementActive,
+		BypassActors: bypass,
+		Rules:        &github.RepositoryRulesetRules{Update: &github.UpdateRuleParameters{}},
+	}), nil
+}
+
+func getAppID(ctx context.Context, client *github.Client, slug string) (int64, error) {
+	appIDsMu.Lock()
+	id, ok := appIDs[slug]
+	appIDsMu.Unlock()
+	if ok {
+		return id, nil
+	}
+	app, _, err := client.Apps.Get(ctx, slug)
+	if err != nil {
+		return 0, err
+	}
+	appIDsMu.Lock()
+	appIDs[slug] = app.GetID()
+	appIDsMu.Unlock()
+	return app.GetID(), nil
+}
+
+// rulesetsEqual compares the user editable parts of two rulesets. Name is
+// ignored and only the ref name includes of the conditions are compared.
+// GitHub fills in unset parameters with their zero value defaults and does
+// not preserve the order of lists, so zero values are ignored and all lists
+// are compared regardless of order.
+func rulesetsEqual(a, b github.RepositoryRuleset) bool {
+	normalize := func(rs github.RepositoryRuleset) any {
+		data, err := json.Marshal(github.RepositoryRuleset{
+			Target:       rs.Target,
+			Enforcement:  rs.Enforcement,
+			BypassActors: rs.BypassActors,
+			Rules:        rs.Rules,
+		})
+		if err != nil {
+			return nil
+		}
+		var out any
+		if err := json.Unmarshal(data, &out); err != nil {
+			return nil
+		}
+		return canonicalJSON(out)
+	}
+	if !reflect.DeepEqual(normalize(a), normalize(b)) {
+		return false
+	}
+	return reflect.DeepEqual(sets.NewString(refNameIncludes(a)...).List(), sets.NewString(refNameIncludes(b)...).List())
+}
+
+// canonicalJSON drops the zero values from a decoded JSON value and sorts its
+// lists, so that values that only differ in defaults and order are equal.
+func canonicalJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if item = canonicalJSON(item); item == nil {
+				delete(v, key)
+			} else {
+				v[key] = item
+			}
+		}
+		if len(v) == 0 {
+			return nil
+		}
+		return v
+	case []any:
+		items := make([]any, 0, len(v))
+		for _, item := range v {
+			if item = canonicalJSON(item); item != nil {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		sort.Slice(items, func(i, j int) bool {
+			return fmt.Sprint(items[i]) < fmt.Sprint(items[j])
+		})
+		return items
+	case bool:
+		if !v {
+			return nil
+		}
+	case float64:
+		if v == 0 {
+			return nil
+		}
+	case string:
+		if v == "" {
+			return nil
+		}
+	}
+	return v
+}
+
+func refNameIncludes(rs github.RepositoryRuleset) []string {
+	if rs.Conditions == nil || rs.Conditions.RefName == nil {
+		return nil
+	}
+	return rs.Conditions.RefName.Include
+}
@@ -0,0 +1,229 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRulesetsFromProtection(t *testing.T) {
+	srv, client := useFakeGitHub(t)
+	srv.AddOrg("kubedb")
+	srv.AddApp("kodiak-appscode", 42)
+
+	p, err := loadProtectionPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	rulesets, err := rulesetsFromProtection(ctx, client, "kubedb", p.ProtectionRequest("kubedb", "mysql", "release-1.0"))
+	if !assert.NoError(t, err) || !assert.Len(t, rulesets, 2) {
+		return
+	}
+
+	// admins may bypass release branches, since enforce_admins is not set
+	rules := rulesets[0]
+	assert.Equal(t, []*github.BypassActor{{
+		ActorID:    github.Ptr(int64(repositoryAdminRoleID)),
+		ActorType:  github.Ptr(github.BypassActorTypeRepositoryRole),
+		BypassMode: github.Ptr(github.BypassModeAlways),
+	}}, rules.BypassActors, "kodiak can not bypass required checks and reviews")
+	assert.NotNil(t, rules.Rules.RequiredStatusChecks)
+	assert.NotNil(t, rules.Rules.PullRequest)
+	assert.Nil(t, rules.Rules.Update)
+
+	push := rulesets[1]
+	assert.Equal(t, &github.RepositoryRulesetRules{Update: &github.UpdateRuleParameters{}}, push.Rules)
+	assert.Equal(t, []*github.BypassActor{
+		{
+			ActorID:    github.Ptr(int64(repositoryAdminRoleID)),
+			ActorType:  github.Ptr(github.BypassActorTypeRepositoryRole),
+			BypassMode: github.Ptr(github.BypassModeAlways),
+		},
+		{
+			ActorID:    github.Ptr(int64(42)),
+			ActorType:  github.Ptr(github.BypassActorTypeIntegration),
+			BypassMode: github.Ptr(github.BypassModeAlways),
+		},
+	}, push.BypassActors)
+
+	// without push restrictions there is no second ruleset
+	req := p.ProtectionRequest("kubedb", "mysql", "master")
+	req.EnforceAdmins = true
+	req.Restrictions = nil
+	rulesets, err = rulesetsFromProtection(ctx, client, "kubedb", req)
+	if assert.NoError(t, err) && assert.Len(t, rulesets, 1) {
+		assert.Empty(t, rulesets[0].BypassActors)
+	}
+}
+
+func TestDesiredRepoRulesetsNames(t *testing.T) {
+	srv, client := useFakeGitHub(t)
+	srv.AddOrg("kubedb")
+	srv.AddApp("kodiak-appscode", 42)
+
+	rulesets, err := desiredRepoRulesets(context.Background(), client, srv.AddRepo("kubedb", "mysql").AddBranch("release-1.0").Repository())
+	assert.NoError(t, err)
+	var names []string
+	for _, rs := range rulesets {
+		names = append(names, rs.Name)
+		assert.True(t, isManagedRuleset(rs.Name), rs.Name)
+	}
+	assert.Equal(t, []string{
+		"gh-tools/default",
+		"gh-tools/default/push-restriction",
+		"gh-tools/release-*",
+		"gh-tools/release-*/push-restriction",
+	}, names)
+}
+
+func TestRulesetsEqual(t *testing.T) {
+	admin := &github.BypassActor{
+		ActorID:    github.Ptr(int64(repositoryAdminRoleID)),
+		ActorType:  github.Ptr(github.BypassActorTypeRepositoryRole),
+		BypassMode: github.Ptr(github.BypassModeAlways),
+	}
+	kodiak := &github.BypassActor{
+		ActorID:    github.Ptr(int64(42)),
+		ActorType:  github.Ptr(github.BypassActorTypeIntegration),
+		BypassMode: github.Ptr(github.BypassModeAlways),
+	}
+	a := github.RepositoryRuleset{
+		Name:         "gh-tools",
+		Target:       github.Ptr(github.RulesetTargetBranch),
+		Enforcement:  github.RulesetEnforcementActive,
+		BypassActors: []*github.BypassActor{admin, kodiak},
+		Rules: &github.RepositoryRulesetRules{
+			Deletion:       &github.EmptyRuleParameters{},
+			NonFastForward: &github.EmptyRuleParameters{},
+		},
+		Conditions: &github.RepositoryRulesetConditions{
+			RefName: &github.RepositoryRulesetRefConditionParameters{Include: []string{"refs/heads/master"}},
+		},
+	}
+	b := a
+	b.Name = "gh-tools/master"
+	b.BypassActors = []*github.BypassActor{kodiak, admin}
+	assert.True(t, rulesetsEqual(a, b), "name and order are ignored")
+
+	b.Conditions = &github.RepositoryRulesetConditions{
+		RefName: &github.RepositoryRulesetRefConditionParameters{Include: []string{"refs/heads/release-*"}},
+	}
+	assert.False(t, rulesetsEqual(a, b))
+
+	b = a
+	b.Enforcement = github.RulesetEnforcementDisabled
+	assert.False(t, rulesetsEqual(a, b))
+}
+
+func TestIsManagedRuleset(t *testing.T) {
+	assert.True(t, isManagedRuleset("gh-tools"))
+	assert.True(t, isManagedRuleset("gh-tools/master"))
+	assert.False(t, isManagedRuleset("gh-tools-old"))
+	assert.False(t, isManagedRuleset("manual"))
+}
+
+func TestDesiredRepoRulesetsResolvesMatchingBranches(t *testing.T) {
+	defer func(p *ProtectionPolicy, s *BranchSelector) { protectionPolicy, branchSelector = p, s }(protectionPolicy, branchSelector)
+	captureLog(t)
+
+	srv, client := useFakeGitHub(t)
+	srv.AddOrg("kubedb")
+	fake := srv.AddRepo("kubedb", "mysql").AddBranch("release-1.0")
+
+	protectionPolicy = &ProtectionPolicy{
+		Branches: []BranchProtectionRule{{Pattern: "release-1.*", ProtectionRule: ProtectionRule{EnforceAdmins: github.Ptr(true)}}},
+	}
+	var err error
+	branchSelector, err = parseBranchSelector([]string{"release-*", "ac-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the rules for release-1.0 apply to release-*, ac-* matches no branch
+	ctx := context.Background()
+	rulesets, err := desiredRepoRulesets(ctx, client, fake.Repository())
+	if assert.NoError(t, err) && assert.Len(t, rulesets, 2) {
+		assert.Equal(t, []string{"refs/heads/release-*"}, refNameIncludes(rulesets[0]))
+		assert.Empty(t, rulesets[0].BypassActors)
+	}
+
+	// a ruleset can not protect release-1.0 and release-2.0 differently
+	fake.AddBranch("release-2.0")
+	_, err = desiredRepoRulesets(ctx, client, fake.Repository())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "the policy protects branches release-1.0 and release-2.0 of kubedb/mysql differently")
+	}
+
+	// unless they are selected one by one
+	branchSelector, err = parseBranchSelector([]string{"re:^release-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rulesets, err = desiredRepoRulesets(ctx, client, fake.Repository())
+	assert.NoError(t, err)
+	var names []string
+	for _, rs := range rulesets {
+		names = append(names, rs.Name)
+	}
+	assert.Equal(t, []string{"gh-tools/release-1.0", "gh-tools/release-1.0/push-restriction", "gh-tools/release-2.0", "gh-tools/release-2.0/push-restriction"}, names)
+}
+
+func TestRulesetsEqualIgnoresDefaultsAndOrder(t *testing.T) {
+	a := github.RepositoryRuleset{
+		Enforcement: github.RulesetEnforcementActive,
+		Rules: &github.RepositoryRulesetRules{
+			Deletion: &github.EmptyRuleParameters{},
+			RequiredStatusChecks: &github.RequiredStatusChecksRuleParameters{
+				RequiredStatusChecks: []*github.RuleStatusCheck{{Context: "DCO"}, {Context: "Build"}},
+			},
+			PullRequest: &github.PullRequestRuleParameters{
+				AllowedMergeMethods:          []github.PullRequestMergeMethod{github.PullRequestMergeMethodSquash, github.PullRequestMergeMethodMerge},
+				RequiredApprovingReviewCount: 1,
+			},
+		},
+		Conditions: &github.RepositoryRulesetConditions{
+			RefName: &github.RepositoryRulesetRefConditionParameters{Include: []string{"~DEFAULT_BRANCH", "refs/heads/release-*"}},
+		},
+	}
+	b := github.RepositoryRuleset{
+		Enforcement:  github.RulesetEnforcementActive,
+		BypassActors: []*github.BypassActor{},
+		Rules: &github.RepositoryRulesetRules{
+			PullRequest: &github.PullRequestRuleParameters{
+				AllowedMergeMethods:          []github.PullRequestMergeMethod{github.PullRequestMergeMethodMerge, github.PullRequestMergeMethodSquash},
+				RequiredApprovingReviewCount: 1,
+			},
+			RequiredStatusChecks: &github.RequiredStatusChecksRuleParameters{
+				DoNotEnforceOnCreate: github.Ptr(false),
+				RequiredStatusChecks: []*github.RuleStatusCheck{{Context: "Build"}, {Context: "DCO"}},
+			},
+			Deletion: &github.EmptyRuleParameters{},
+		},
+		Conditions: &github.RepositoryRulesetConditions{
+			RefName: &github.RepositoryRulesetRefConditionParameters{Include: []string{"refs/heads/release-*", "~DEFAULT_BRANCH"}, Exclude: []string{}},
+		},
+	}
+	assert.True(t, rulesetsEqual(a, b))
+
+	b.Rules.PullRequest.RequiredApprovingReviewCount = 2
+	assert.False(t, rulesetsEqual(a, b))
+}
@@ -0,0 +1,81 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtectRepo(t *testing.T) {
+	srv, client := useFakeGitHub(t)
+	srv.AddOrg("kubedb")
+	repo := srv.AddRepo("kubedb", "mysql").AddBranch("release-1.0", "feature-x").Repository()
+
+	ctx := context.Background()
+	assert.NoError(t, ProtectRepo(ctx, client, repo))
+
+	fake := srv.Repo("kubedb", "mysql")
+	assert.Nil(t, fake.Protection("feature-x"))
+	for _, branch := range []string{"master", "release-1.0"} {
+		current := fake.Protection(branch)
+		if !assert.NotNil(t, current, branch) {
+			continue
+		}
+		assert.Equal(t, branch == "master", current.GetEnforceAdmins().Enabled, branch)
+		assert.Equal(t, []string{"kodiak-appscode"}, []string{current.GetRestrictions().Apps[0].GetSlug()}, branch)
+
+		desired, err := branchProtectionRequest(ctx, client, "kubedb", "mysql", branch)
+		assert.NoError(t, err)
+		assert.Empty(t, diffProtection(current, desired), "protection of %s round trips", branch)
+	}
+}
+
+func TestProtectRepoWithRulesets(t *testing.T) {
+	defer func(b string) { protectBackend = b }(protectBackend)
+	protectBackend = protectBackendRulesets
+
+	srv, client := useFakeGitHub(t)
+	srv.AddOrg("kubedb")
+	srv.AddApp("kodiak-appscode", 42)
+	fake := srv.AddRepo("kubedb", "mysql").AddBranch("release-1.0")
+	repo := fake.Repository()
+	stale := fake.AddRuleset(github.RepositoryRuleset{Name: rulesetName + "/old", Target: github.Ptr(github.RulesetTargetBranch)})
+	other := fake.AddRuleset(github.RepositoryRuleset{Name: "manual", Target: github.Ptr(github.RulesetTargetBranch)})
+
+	ctx := context.Background()
+	assert.NoError(t, ProtectRepoWithRulesets(ctx, client, repo))
+
+	var ids []int64
+	names := map[string]bool{}
+	for _, rs := range fake.Rulesets() {
+		ids = append(ids, rs.GetID())
+		names[rs.Name] = true
+	}
+	assert.NotContains(t, ids, stale, "stale managed ruleset is deleted")
+	assert.Contains(t, ids, other, "rulesets not managed by gh-tools are kept")
+	assert.True(t, len(names) > 1)
+
+	// a second run finds nothing to change, although GitHub fills in
+	// defaults and reorders the stored rulesets
+	before := len(mutatingRequests(srv))
+	assert.NoError(t, ProtectRepoWithRulesets(ctx, client, repo))
+	assert.Len(t, mutatingRequests(srv), before)
+}
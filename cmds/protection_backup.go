@@ -0,0 +1,383 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/spf13/cobra"
+	"gomodules.xyz/flags"
+	"gomodules.xyz/sets"
+)
+
+// ProtectionBackup is the saved branch protection and ruleset state of a
+// single repository.
+type ProtectionBackup struct {
+	Owner             string                        `json:"owner"`
+	Repo              string                        `json:"repo"`
+	CreatedAt         time.Time                     `json:"createdAt"`
+	BranchProtections map[string]*github.Protection `json:"branchProtections"`
+	Rulesets          []*github.RepositoryRuleset   `json:"rulesets"`
+}
+
+func NewCmdRestoreProtection() *cobra.Command {
+	var (
+		dir   string
+		repos []string
+	)
+	cmd := &cobra.Command{
+		Use:               "restore-protection",
+		Short:             "Restore branch protections and rulesets saved with unprotect --backup-dir",
+		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
+		PersistentPreRun: func(c *cobra.Command, args []string) {
+			flags.PrintFlags(c.Flags())
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			runRestoreProtection(dir, sets.NewString(repos...))
+		},
+	}
+	cmd.Flags().StringVar(&dir, "dir", "", "Directory containing the backup (required)")
+	cmd.Flags().StringSliceVar(&repos, "repo", nil, "If set, only restore these owner/repository")
+	_ = cmd.MarkFlagRequired("dir")
+	return cmd
+}
+
+func runRestoreProtection(dir string, repos sets.String) {
+	backups, err := readProtectionBackups(dir)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	ctx := context.Background()
+	client := newGitHubClient(ctx)
+
+	restored := 0
+	for _, b := range backups {
+		if repos.Len() > 0 && !repos.Has(b.Owner+"/"+b.Repo) {
+			continue
+		}
+		if err := restoreRepoProtection(ctx, client, b); err != nil {
+			log.Fatalln(err)
+		}
+		restored++
+	}
+	log.Printf("restored protection for %d repositories", restored)
+}
+
+func protectionBackupPath(dir, owner, repo string) string {
+	return filepath.Join(dir, owner, repo+".json")
+}
+
+// backupRepoProtection saves the branch protections and repository rulesets
+// of repo to dir/owner/repo.json. An existing backup is never overwritten, so
+// that rerunning unprotect with the same --backup-dir, for example to resume
+// from a checkpoint or to remove another rule, keeps the original state.
+func backupRepoProtection(ctx context.Context, client *github.Client, repo *github.Repository, dir string) error {
+	owner := repo.GetOwner().GetLogin()
+	filename := protectionBackupPath(dir, owner, repo.GetName())
+	if _, err := os.Stat(filename); err == nil {
+		logf(ctx, "[BACKUP] %s: keeping existing backup %s", repo.GetFullName(), filename)
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	b := ProtectionBackup{
+		Owner:             owner,
+		Repo:              repo.GetName(),
+		CreatedAt:         time.Now().UTC(),
+		BranchProtections: map[string]*github.Protection{},
+	}
+
+	branches, err := ListBranches(ctx, client, repo)
+	if err != nil {
+		return err
+	}
+	for _, branch := range branches {
+		if !branch.GetProtected() {
+			continue
+		}
+		p, err := getBranchProtection(ctx, client, owner, repo.GetName(), branch.GetName())
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			b.BranchProtections[branch.GetName()] = p
+		}
+	}
+
+	rulesets, err := listRepoRulesets(ctx, client, owner, repo.GetName())
+	if err != nil {
+		return err
+	}
+	for _, rs := range rulesets {
+		full, _, err := client.Repositories.GetRuleset(ctx, owner, repo.GetName(), rs.GetID(), false)
+		if err != nil {
+			return err
+		}
+		b.Rulesets = append(b.Rulesets, full)
+	}
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		logf(ctx, "[BACKUP] %s: keeping existing backup %s", repo.GetFullName(), filename)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	logf(ctx, "[BACKUP] %s: %d branch protection(s), %d ruleset(s) -> %s", repo.GetFullName(), len(b.BranchProtections), len(b.Rulesets), filename)
+	return nil
+}
+
+func readProtectionBackups(dir string) ([]*ProtectionBackup, error) {
+	var result []*ProtectionBackup
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var b ProtectionBackup
+		if err := json.Unmarshal(data, &b); err != nil {
+			return fmt.Errorf("failed to parse backup %s: %w", path, err)
+		}
+		if b.Owner == "" || b.Repo == "" {
+			return fmt.Errorf("backup %s is missing owner or repo", path)
+		}
+		result = append(result, &b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Owner+"/"+result[i].Repo < result[j].Owner+"/"+result[j].Repo
+	})
+	return result, nil
+}
+
+func restoreRepoProtection(ctx context.Context, client *github.Client, b *ProtectionBackup) error {
+	branches := make([]string, 0, len(b.BranchProtections))
+	for name := range b.BranchProtections {
+		branches = append(branches, name)
+	}
+	sort.Strings(branches)
+
+	for _, branch := range branches {
+		log.Printf("[RESTORE] %s/%s branch protection %q", b.Owner, b.Repo, branch)
+		if err := restoreBranchProtection(ctx, client, b.Owner, b.Repo, branch, b.BranchProtections[branch]); err != nil {
+			return err
+		}
+	}
+
+	if len(b.Rulesets) == 0 {
+		return nil
+	}
+	existing, err := listRepoRulesets(ctx, client, b.Owner, b.Repo)
+	if err != nil {
+		return err
+	}
+	byName := map[string]int64{}
+	for _, rs := range existing {
+		byName[rs.Name] = rs.GetID()
+	}
+	for _, rs := range b.Rulesets {
+		req := rulesetRequest(rs)
+		if id, ok := byName[rs.Name]; ok {
+			log.Printf("[RESTORE] %s/%s ruleset %q (update %d)", b.Owner, b.Repo, rs.Name, id)
+			if _, _, err := client.Repositories.UpdateRuleset(ctx, b.Owner, b.Repo, id, req); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Printf("[RESTORE] %s/%s ruleset %q (create)", b.Owner, b.Repo, rs.Name)
+		if _, _, err := client.Repositories.CreateRuleset(ctx, b.Owner, b.Repo, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreBranchProtection sets the protection of a branch to p, as returned
+// by the API.
+func restoreBranchProtection(ctx context.Context, client *github.Client, owner, repo, branch string, p *github.Protection) error {
+	if _, _, err := client.Repositories.UpdateBranchProtection(ctx, owner, repo, branch, protectionRequestFromProtection(p)); err != nil {
+		return err
+	}
+	if p.RequiredSignatures == nil {
+		return nil
+	}
+	var err error
+	if p.RequiredSignatures.GetEnabled() {
+		_, _, err = client.Repositories.RequireSignaturesOnProtectedBranch(ctx, owner, repo, branch)
+	} else {
+		_, err = client.Repositories.OptionalSignaturesOnProtectedBranch(ctx, owner, repo, branch)
+	}
+	return err
+}
+
+// rulesetRequest strips the read-only fields of a ruleset returned by the
+// API so that it can be sent back to create or update a ruleset.
+func rulesetRequest(rs *github.RepositoryRuleset) github.RepositoryRuleset {
+	return github.RepositoryRuleset{
+		Name:         rs.Name,
+		Target:       rs.Target,
+		Enforcement:  rs.Enforcement,
+		BypassActors: rs.BypassActors,
+		Conditions:   rs.Conditions,
+		Rules:        rs.Rules,
+	}
+}
+
+// protectionRequestFromProtection converts a branch protection returned by
+// the API into the request that re-creates it.
+func protectionRequestFromProtection(p *github.Protection) *github.ProtectionRequest {
+	if p == nil {
+		return nil
+	}
+	req := &github.ProtectionRequest{}
+
+	if rsc := p.RequiredStatusChecks; rsc != nil {
+		checks := &github.RequiredStatusChecks{Strict: rsc.Strict}
+		switch {
+		case rsc.Checks != nil:
+			items := make([]*github.RequiredStatusCheck, 0, len(*rsc.Checks))
+			for _, c := range *rsc.Checks {
+				items = append(items, &github.RequiredStatusCheck{Context: c.Context, AppID: c.AppID})
+			}
+			checks.Checks = &items
+		case rsc.Contexts != nil:
+			items := make([]*github.RequiredStatusCheck, 0, len(*rsc.Contexts))
+			for _, c := range *rsc.Contexts {
+				items = append(items, &github.RequiredStatusCheck{Context: c})
+			}
+			checks.Checks = &items
+		default:
+			checks.Checks = &[]*github.RequiredStatusCheck{}
+		}
+		req.RequiredStatusChecks = checks
+	}
+
+	if r := p.RequiredPullRequestReviews; r != nil {
+		reviews := &github.PullRequestReviewsEnforcementRequest{
+			DismissStaleReviews:          r.DismissStaleReviews,
+			RequireCodeOwnerReviews:      r.RequireCodeOwnerReviews,
+			RequiredApprovingReviewCount: r.RequiredApprovingReviewCount,
+			RequireLastPushApproval:      github.Ptr(r.RequireLastPushApproval),
+		}
+		if d := r.DismissalRestrictions; d != nil {
+			users, teams, apps := actorNames(d.Users, d.Teams, d.Apps)
+			reviews.DismissalRestrictionsRequest = &github.DismissalRestrictionsRequest{
+				Users: &users,
+				Teams: &teams,
+				Apps:  &apps,
+			}
+		}
+		if a := r.BypassPullRequestAllowances; a != nil {
+			users, teams, apps := actorNames(a.Users, a.Teams, a.Apps)
+			reviews.BypassPullRequestAllowancesRequest = &github.BypassPullRequestAllowancesRequest{
+				Users: users,
+				Teams: teams,
+				Apps:  apps,
+			}
+		}
+		req.RequiredPullRequestReviews = reviews
+	}
+
+	if p.EnforceAdmins != nil {
+		req.EnforceAdmins = p.EnforceAdmins.Enabled
+	}
+
+	if r := p.Restrictions; r != nil {
+		users, teams, apps := actorNames(r.Users, r.Teams, r.Apps)
+		req.Restrictions = &github.BranchRestrictionsRequest{
+			Users: users,
+			Teams: teams,
+			Apps:  apps,
+		}
+	}
+
+	if p.RequireLinearHistory != nil {
+		req.RequireLinearHistory = github.Ptr(p.RequireLinearHistory.Enabled)
+	}
+	if p.AllowForcePushes != nil {
+		req.AllowForcePushes = github.Ptr(p.AllowForcePushes.Enabled)
+	}
+	if p.AllowDeletions != nil {
+		req.AllowDeletions = github.Ptr(p.AllowDeletions.Enabled)
+	}
+	if p.RequiredConversationResolution != nil {
+		req.RequiredConversationResolution = github.Ptr(p.RequiredConversationResolution.Enabled)
+	}
+	if p.BlockCreations != nil {
+		req.BlockCreations = p.BlockCreations.Enabled
+	}
+	if p.LockBranch != nil {
+		req.LockBranch = p.LockBranch.Enabled
+	}
+	if p.AllowForkSyncing != nil {
+		req.AllowForkSyncing = p.AllowForkSyncing.Enabled
+	}
+	return req
+}
+
+func actorNames(users []*github.User, teams []*github.Team, apps []*github.App) ([]string, []string, []string) {
+	u := make([]string, 0, len(users))
+	for _, v := range users {
+		u = append(u, v.GetLogin())
+	}
+	t := make([]string, 0, len(teams))
+	for _, v := range teams {
+		t = append(t, v.GetSlug())
+	}
+	a := make([]string, 0, len(apps))
+	for _, v := range apps {
+		a = append(a, v.GetSlug())
+	}
+	return u, t, a
+}
@@ -0,0 +1,216 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtectionBackupRoundTrip(t *testing.T) {
+	captureLog(t)
+	srv, client := useFakeGitHub(t)
+	fake := srv.AddRepo("kubedb", "mysql").AddBranch("release-1.0", "feature-x")
+	repo := fake.Repository()
+
+	ctx := context.Background()
+	_, _, err := client.Repositories.UpdateBranchProtection(ctx, "kubedb", "mysql", "master", &github.ProtectionRequest{
+		RequiredStatusChecks: &github.RequiredStatusChecks{
+			Strict: true,
+			Checks: &[]*github.RequiredStatusCheck{{Context: "DCO"}, {Context: "e2e", AppID: github.Ptr(int64(15368))}},
+		},
+		RequiredPullRequestReviews: &github.PullRequestReviewsEnforcementRequest{
+			DismissalRestrictionsRequest: &github.DismissalRestrictionsRequest{
+				Users: &[]string{"tamalsaha"},
+				Teams: &[]string{"reviewers"},
+				Apps:  &[]string{},
+			},
+			BypassPullRequestAllowancesRequest: &github.BypassPullRequestAllowancesRequest{
+				Users: []string{},
+				Teams: []string{"maintainers"},
+				Apps:  []string{"kodiak-appscode"},
+			},
+			DismissStaleReviews:          true,
+			RequireCodeOwnerReviews:      true,
+			RequiredApprovingReviewCount: 2,
+			RequireLastPushApproval:      github.Ptr(true),
+		},
+		EnforceAdmins: true,
+		Restrictions: &github.BranchRestrictionsRequest{
+			Users: []string{"1gtm"},
+			Teams: []string{"reviewers"},
+			Apps:  []string{"kodiak-appscode"},
+		},
+		RequireLinearHistory:           github.Ptr(true),
+		AllowForcePushes:               github.Ptr(false),
+		AllowDeletions:                 github.Ptr(false),
+		RequiredConversationResolution: github.Ptr(true),
+		BlockCreations:                 github.Ptr(true),
+		LockBranch:                     github.Ptr(false),
+		AllowForkSyncing:               github.Ptr(true),
+	})
+	assert.NoError(t, err)
+	_, _, err = client.Repositories.RequireSignaturesOnProtectedBranch(ctx, "kubedb", "mysql", "master")
+	assert.NoError(t, err)
+	// no checks, reviews or restrictions
+	_, _, err = client.Repositories.UpdateBranchProtection(ctx, "kubedb", "mysql", "release-1.0", &github.ProtectionRequest{})
+	assert.NoError(t, err)
+	fake.AddRuleset(github.RepositoryRuleset{
+		Name:        "manual",
+		Target:      github.Ptr(github.RulesetTargetBranch),
+		Enforcement: github.RulesetEnforcementActive,
+		Rules:       &github.RepositoryRulesetRules{Deletion: &github.EmptyRuleParameters{}},
+	})
+
+	protections := map[string]*github.Protection{}
+	for _, branch := range []string{"master", "release-1.0"} {
+		protections[branch] = fake.Protection(branch)
+	}
+	rulesets := fake.Rulesets()
+
+	dir := t.TempDir()
+	assert.NoError(t, backupRepoProtection(ctx, client, repo, dir))
+
+	for branch := range protections {
+		_, err := client.Repositories.RemoveBranchProtection(ctx, "kubedb", "mysql", branch)
+		assert.NoError(t, err)
+	}
+	_, err = client.Repositories.DeleteRuleset(ctx, "kubedb", "mysql", rulesets[0].GetID())
+	assert.NoError(t, err)
+
+	// a rerun with the same dir keeps the state before the first run
+	assert.NoError(t, backupRepoProtection(ctx, client, repo, dir))
+
+	backups, err := readProtectionBackups(dir)
+	if !assert.NoError(t, err) || !assert.Len(t, backups, 1) {
+		return
+	}
+	assert.Len(t, backups[0].BranchProtections, 2, "unprotected branches are not backed up")
+	assert.NoError(t, restoreRepoProtection(ctx, client, backups[0]))
+
+	for branch, p := range protections {
+		assert.Equal(t, p, fake.Protection(branch), branch)
+	}
+	assert.Nil(t, fake.Protection("feature-x"))
+	if restored := fake.Rulesets(); assert.Len(t, restored, 1) {
+		assert.Equal(t, rulesetRequest(rulesets[0]), rulesetRequest(restored[0]))
+	}
+}
+
+func TestProtectionRequestFromProtectionNil(t *testing.T) {
+	assert.Nil(t, protectionRequestFromProtection(nil))
+
+	req := protectionRequestFromProtection(&github.Protection{
+		RequiredStatusChecks:       &github.RequiredStatusChecks{Strict: true},
+		RequiredPullRequestReviews: &github.PullRequestReviewsEnforcement{RequiredApprovingReviewCount: 1},
+	})
+	assert.Equal(t, &github.ProtectionRequest{
+		RequiredStatusChecks: &github.RequiredStatusChecks{Strict: true, Checks: &[]*github.RequiredStatusCheck{}},
+		RequiredPullRequestReviews: &github.PullRequestReviewsEnforcementRequest{
+			RequiredApprovingReviewCount: 1,
+			RequireLastPushApproval:      github.Ptr(false),
+		},
+	}, req)
+}
+
+func TestProtectionRequestFromProtection(t *testing.T) {
+	req := protectionRequestFromProtection(&github.Protection{
+		RequiredStatusChecks: &github.RequiredStatusChecks{
+			Strict:   true,
+			Contexts: &[]string{"DCO", "Build"},
+		},
+		RequiredPullRequestReviews: &github.PullRequestReviewsEnforcement{
+			DismissalRestrictions: &github.DismissalRestrictions{
+				Users: []*github.User{{Login: github.Ptr("tamalsaha")}},
+				Teams: []*github.Team{{Slug: github.Ptr("reviewers")}},
+			},
+			BypassPullRequestAllowances: &github.BypassPullRequestAllowances{
+				Apps: []*github.App{{Slug: github.Ptr("kodiak-appscode")}},
+			},
+			DismissStaleReviews:          true,
+			RequiredApprovingReviewCount: 2,
+			RequireLastPushApproval:      true,
+		},
+		EnforceAdmins: &github.AdminEnforcement{Enabled: true},
+		Restrictions: &github.BranchRestrictions{
+			Users: []*github.User{{Login: github.Ptr("1gtm")}},
+			Apps:  []*github.App{{Slug: github.Ptr("kodiak-appscode")}},
+		},
+		RequireLinearHistory: &github.RequireLinearHistory{Enabled: true},
+		AllowDeletions:       &github.AllowDeletions{Enabled: false},
+		LockBranch:           &github.LockBranch{Enabled: github.Ptr(true)},
+	})
+	assert.Equal(t, &github.ProtectionRequest{
+		RequiredStatusChecks: &github.RequiredStatusChecks{
+			Strict: true,
+			Checks: &[]*github.RequiredStatusCheck{{Context: "DCO"}, {Context: "Build"}},
+		},
+		RequiredPullRequestReviews: &github.PullRequestReviewsEnforcementRequest{
+			DismissalRestrictionsRequest: &github.DismissalRestrictionsRequest{
+				Users: &[]string{"tamalsaha"},
+				Teams: &[]string{"reviewers"},
+				Apps:  &[]string{},
+			},
+			BypassPullRequestAllowancesRequest: &github.BypassPullRequestAllowancesRequest{
+				Users: []string{},
+				Teams: []string{},
+				Apps:  []string{"kodiak-appscode"},
+			},
+			DismissStaleReviews:          true,
+			RequiredApprovingReviewCount: 2,
+			RequireLastPushApproval:      github.Ptr(true),
+		},
+		EnforceAdmins: true,
+		Restrictions: &github.BranchRestrictionsRequest{
+			Users: []string{"1gtm"},
+			Teams: []string{},
+			Apps:  []string{"kodiak-appscode"},
+		},
+		RequireLinearHistory: github.Ptr(true),
+		AllowDeletions:       github.Ptr(false),
+		LockBranch:           github.Ptr(true),
+	}, req)
+}
+
+func TestReadProtectionBackups(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		filename := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+		assert.NoError(t, os.WriteFile(filename, []byte(data), 0o644))
+	}
+	write("stashed/ui.json", `{"owner":"stashed","repo":"ui"}`)
+	write("kubedb/mysql.json", `{"owner":"kubedb","repo":"mysql","branchProtections":{"master":{"enforce_admins":{"enabled":true}}}}`)
+	write("kubedb/README.md", "not a backup")
+
+	backups, err := readProtectionBackups(dir)
+	if assert.NoError(t, err) && assert.Len(t, backups, 2) {
+		assert.Equal(t, "kubedb", backups[0].Owner)
+		assert.Equal(t, "mysql", backups[0].Repo)
+		assert.True(t, backups[0].BranchProtections["master"].GetEnforceAdmins().Enabled)
+		assert.Equal(t, "stashed/ui", backups[1].Owner+"/"+backups[1].Repo)
+	}
+
+	write("broken.json", `{"repo":"redis"}`)
+	_, err = readProtectionBackups(dir)
+	assert.ErrorContains(t, err, "is missing owner or repo")
+}
@@ -0,0 +1,250 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+)
+
+const (
+	rateResourceCore       = "core"
+	rateResourceSearch     = "search"
+	rateResourceCodeSearch = "code_search"
+	rateResourceGraphQL    = "graphql"
+
+	// ratePaceFraction is the fraction of the rate limit below which calls
+	// are spread evenly until the rate limit resets.
+	ratePaceFraction = 0.2
+)
+
+// rateLimitHeadroom is the number of calls per resource left unused for other
+// tools sharing the same token.
+var rateLimitHeadroom = 100
+
+// RateBudget is the last known rate limit of a resource.
+type RateBudget struct {
+	Resource  string
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// Available returns the number of calls that can be made before the rate
+// limit resets, keeping rateLimitHeadroom in reserve.
+func (b RateBudget) Available() int {
+	return max(b.Remaining-rateLimitHeadroom, 0)
+}
+
+// rateBudgetKey identifies a budget. Every installation of a GitHub App has
+// its own rate limits, so budgets are kept per credentials and resource.
+type rateBudgetKey struct {
+	// credentials is empty for the token, or names the installation.
+	credentials string
+	resource    string
+}
+
+func (k rateBudgetKey) String() string {
+	if k.credentials == "" {
+		return k.resource
+	}
+	return k.resource + " (" + k.credentials + ")"
+}
+
+type rateBudgetTracker struct {
+	mu      sync.Mutex
+	budgets map[rateBudgetKey]*RateBudget
+	next    map[rateBudgetKey]time.Time
+	pacing  map[rateBudgetKey]bool
+}
+
+var rateBudgets = newRateBudgetTracker()
+
+func newRateBudgetTracker() *rateBudgetTracker {
+	return &rateBudgetTracker{
+		budgets: map[rateBudgetKey]*RateBudget{},
+		next:    map[rateBudgetKey]time.Time{},
+		pacing:  map[rateBudgetKey]bool{},
+	}
+}
+
+// currentRateBudget returns the last known budget of a resource of the token.
+func currentRateBudget(resource string) (RateBudget, bool) {
+	return rateBudgets.get(rateBudgetKey{resource: resource})
+}
+
+func (t *rateBudgetTracker) get(key rateBudgetKey) (RateBudget, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.budgets[key]
+	if !ok {
+		return RateBudget{}, false
+	}
+	return *b, true
+}
+
+// requestCredentials names the credentials a request is made with: the
+// installation of a GitHub App, or "" for the token.
+func requestCredentials(req *http.Request) string {
+	if githubApp == nil {
+		return ""
+	}
+	id, ok := req.Context().Value(installationIDKey{}).(int64)
+	if !ok {
+		owner := ownerFromPath(req.URL.Path)
+		if owner == "" {
+			return ""
+		}
+		inst, err := githubApp.installationFor(req.Context(), owner)
+		if err != nil {
+			// the request fails without a token anyway
+			return ""
+		}
+		id = inst.GetID()
+	}
+	return "installation " + strconv.FormatInt(id, 10)
+}
+
+// requestResource returns the rate limit resource that a request counts
+// against, or "" if it is not rate limited.
+func requestResource(req *http.Request) string {
+	p := strings.TrimPrefix(req.URL.Path, "/api/v3")
+	switch {
+	case p == "/rate_limit":
+		return ""
+	case strings.HasPrefix(p, "/search/code"):
+		return rateResourceCodeSearch
+	case strings.HasPrefix(p, "/search/"):
+		return rateResourceSearch
+	case p == "/graphql" || p == "/api/graphql":
+		return rateResourceGraphQL
+	default:
+		return rateResourceCore
+	}
+}
+
+// update records the rate limit headers of a response to a request made with
+// credentials.
+func (t *rateBudgetTracker) update(credentials string, resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	reset := parseUnixTime(resp.Header.Get("X-RateLimit-Reset"))
+	resource := resp.Header.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = rateResourceCore
+	}
+
+	key := rateBudgetKey{credentials: credentials, resource: resource}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.budgets[key]
+	if ok && b.Reset.Equal(reset) && remaining > b.Remaining {
+		return // a response to an older request, when requests run in parallel
+	}
+	t.budgets[key] = &RateBudget{
+		Resource:  resource,
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     reset,
+	}
+}
+
+// reserve accounts for one call to resource with credentials and returns how
+// long the caller must wait before making it. Once the budget runs low, calls
+// are spread evenly until the reset time. Once only the headroom is left,
+// calls wait for the reset.
+func (t *rateBudgetTracker) reserve(credentials, resource string, now time.Time) time.Duration {
+	if resource == "" {
+		return 0
+	}
+
+	key := rateBudgetKey{credentials: credentials, resource: resource}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.budgets[key]
+	if !ok || b.Reset.IsZero() || !now.Before(b.Reset) {
+		return 0
+	}
+
+	untilReset := b.Reset.Sub(now)
+	available := b.Available()
+	if available == 0 {
+		log.Printf("GitHub API %s rate limit budget used up (remaining=%d, headroom=%d); waiting %s for reset", key, b.Remaining, rateLimitHeadroom, untilReset.Round(time.Second))
+		return untilReset + time.Second
+	}
+	b.Remaining--
+
+	if float64(available) >= float64(b.Limit)*ratePaceFraction {
+		return 0
+	}
+	if !t.pacing[key] {
+		t.pacing[key] = true
+		log.Printf("GitHub API %s rate limit budget is low (remaining=%d, headroom=%d); spreading calls until reset at %s", key, b.Remaining, rateLimitHeadroom, b.Reset.Local().Format(time.Kitchen))
+	}
+	interval := untilReset / time.Duration(available)
+	slot := t.next[key]
+	if slot.Before(now) {
+		slot = now
+	}
+	t.next[key] = slot.Add(interval)
+	return slot.Sub(now)
+}
+
+// warnRateBudget logs the number of core API calls a run is expected to make
+// and the calls available to it, with a warning if the run will have to slow
+// down to stay within the rate limit.
+func warnRateBudget(ctx context.Context, client *github.Client, repos, callsPerRepo int) {
+	var (
+		limits *github.RateLimits
+		err    error
+	)
+	if githubApp != nil {
+		limits, err = appRateLimits(ctx, client)
+	} else {
+		limits, _, err = client.RateLimit.Get(ctx)
+	}
+	if err != nil {
+		log.Printf("failed to read rate limit: %v", err)
+		return
+	}
+	core := limits.GetCore()
+	if core == nil {
+		return
+	}
+	b := RateBudget{
+		Resource:  rateResourceCore,
+		Limit:     core.Limit,
+		Remaining: core.Remaining,
+		Reset:     core.Reset.Time,
+	}
+
+	needed := repos * callsPerRepo
+	log.Printf("this run needs ~%d API calls, %d of %d are available until %s", needed, b.Available(), b.Limit, b.Reset.Local().Format(time.Kitchen))
+	if needed > b.Available() {
+		log.Printf("WARNING: this run needs ~%d API calls, you have %d; it will slow down to stay within the rate limit", needed, b.Available())
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rateLimitResponse(resource string, limit, remaining int, reset time.Time) *http.Response {
+	h := http.Header{}
+	h.Set("X-RateLimit-Resource", resource)
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	return &http.Response{Header: h}
+}
+
+func TestRateBudgetReserve(t *testing.T) {
+	defer func(h int) { rateLimitHeadroom = h }(rateLimitHeadroom)
+	rateLimitHeadroom = 100
+
+	now := time.Now().Truncate(time.Second)
+	reset := now.Add(time.Hour)
+
+	tr := newRateBudgetTracker()
+	assert.Zero(t, tr.reserve("", rateResourceCore, now), "unknown budget")
+
+	tr.update("", rateLimitResponse(rateResourceCore, 5000, 4000, reset))
+	assert.Zero(t, tr.reserve("", rateResourceCore, now), "plenty of budget")
+	assert.Zero(t, tr.reserve("", rateResourceSearch, now), "budget of another resource")
+
+	// 200 calls left after headroom, spread over an hour
+	tr.update("", rateLimitResponse(rateResourceCore, 5000, 300, reset))
+	assert.Zero(t, tr.reserve("", rateResourceCore, now))
+	d := tr.reserve("", rateResourceCore, now)
+	assert.InDelta(t, float64(time.Hour/199), float64(d), float64(time.Second))
+
+	// a response to an older request does not raise the budget
+	tr.update("", rateLimitResponse(rateResourceCore, 5000, 4000, reset))
+	b, ok := tr.get(rateBudgetKey{resource: rateResourceCore})
+	assert.True(t, ok)
+	assert.Equal(t, 298, b.Remaining)
+
+	// only the headroom is left
+	tr.update("", rateLimitResponse(rateResourceCore, 5000, 100, reset))
+	assert.Equal(t, time.Hour+time.Second, tr.reserve("", rateResourceCore, now))
+
+	// installations of a GitHub App have their own budgets
+	tr.update("installation 2", rateLimitResponse(rateResourceCore, 5000, 4000, reset))
+	assert.Zero(t, tr.reserve("installation 2", rateResourceCore, now))
+	assert.Equal(t, time.Hour+time.Second, tr.reserve("", rateResourceCore, now))
+
+	// the budget is refreshed after the reset time
+	assert.Zero(t, tr.reserve("", rateResourceCore, reset))
+}
+
+func TestRequestResource(t *testing.T) {
+	tests := map[string]string{
+		"https://api.github.com/repos/a/b/branches":         rateResourceCore,
+		"https://api.github.com/search/issues?q=x":          rateResourceSearch,
+		"https://api.github.com/search/code?q=x":            rateResourceCodeSearch,
+		"https://api.github.com/graphql":                    rateResourceGraphQL,
+		"https://api.github.com/rate_limit":                 "",
+		"https://ghe.example.com/api/v3/search/issues?q=x":  rateResourceSearch,
+		"https://ghe.example.com/api/v3/repos/a/b/branches": rateResourceCore,
+	}
+	for u, want := range tests {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, want, requestResource(req), u)
+	}
+}
@@ -37,6 +37,7 @@ func NewCmdRelease() *cobra.Command {
 		Use:               "release",
 		Short:             "create GitHub release and upload artifacts",
 		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			flags.PrintFlags(c.Flags())
 		},
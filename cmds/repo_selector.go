@@ -0,0 +1,344 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/spf13/cobra"
+)
+
+// Keys of repo selector terms. Custom properties are selected with
+// repoKeyPropertyPrefix followed by the property name.
+const (
+	repoKeyOrg            = "org"
+	repoKeyRepo           = "repo"
+	repoKeyName           = "name"
+	repoKeyOwnerType      = "owner-type"
+	repoKeyVisibility     = "visibility"
+	repoKeyFork           = "fork"
+	repoKeyArchived       = "archived"
+	repoKeyTopic          = "topic"
+	repoKeyLanguage       = "language"
+	repoKeyDefaultBranch  = "default-branch"
+	repoKeyPushedSince    = "pushed-since"
+	repoKeyPropertyPrefix = "property."
+)
+
+var repoSelectExprs []string
+
+var repoTermRegex = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9._-]*)(!=|!~|=|~)(.*)$`)
+
+func addRepoSelectorFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&repoSelectExprs, "select", repoSelectExprs,
+		fmt.Sprintf("Select repositories (repeatable). Space separated terms key=value, key!=value, key~pattern or key!~pattern, where values are comma separated and patterns are globs or %q prefixed regular expressions, both matched case-insensitively. Keys: %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s and %s<name> for custom properties. All terms must match; a term replaces the default of the command for its key, for example archived=false.",
+			regexPatternPrefix, repoKeyOrg, repoKeyRepo, repoKeyName, repoKeyOwnerType, repoKeyVisibility, repoKeyFork, repoKeyArchived, repoKeyTopic, repoKeyLanguage, repoKeyDefaultBranch, repoKeyPushedSince, repoKeyPropertyPrefix))
+}
+
+// RepoSelector decides which repositories a command processes.
+type RepoSelector struct {
+	terms []repoTerm
+}
+
+type repoTerm struct {
+	key    string
+	negate bool
+	// values are matched by =, patterns by ~
+	values   []string
+	patterns []valuePattern
+	// since is the time of a pushed-since term
+	since time.Time
+}
+
+type valuePattern struct {
+	regex *regexp.Regexp
+	glob  string
+}
+
+// defaultRepoTerms are the terms of commands that process repos: archived
+// repos are skipped, and forks unless fork is true.
+func defaultRepoTerms(fork bool, extra ...string) []string {
+	terms := []string{repoKeyArchived + "=false"}
+	if !fork {
+		terms = append(terms, repoKeyFork+"=false")
+	}
+	return append(terms, extra...)
+}
+
+// newRepoSelector returns the selector of --select, along with the default
+// terms of the command for the keys not used in --select.
+func newRepoSelector(defaults []string) (*RepoSelector, error) {
+	user, err := parseRepoTerms(repoSelectExprs)
+	if err != nil {
+		return nil, err
+	}
+	base, err := parseRepoTerms(defaults)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]bool{}
+	for _, t := range user {
+		keys[t.key] = true
+	}
+	s := &RepoSelector{}
+	for _, t := range base {
+		if !keys[t.key] {
+			s.terms = append(s.terms, t)
+		}
+	}
+	s.terms = append(s.terms, user...)
+	return s, nil
+}
+
+func parseRepoTerms(exprs []string) ([]repoTerm, error) {
+	var terms []repoTerm
+	for _, expr := range exprs {
+		for _, raw := range strings.Fields(expr) {
+			t, err := parseRepoTerm(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid repo selector %q: %w", raw, err)
+			}
+			terms = append(terms, t)
+		}
+	}
+	return terms, nil
+}
+
+func parseRepoTerm(raw string) (repoTerm, error) {
+	m := repoTermRegex.FindStringSubmatch(raw)
+	if m == nil {
+		return repoTerm{}, fmt.Errorf("must be key=value, key!=value, key~pattern or key!~pattern")
+	}
+	key, op, value := m[1], m[2], m[3]
+	if !strings.HasPrefix(key, repoKeyPropertyPrefix) {
+		key = strings.ToLower(key)
+	}
+	t := repoTerm{key: key, negate: strings.HasPrefix(op, "!")}
+	if value == "" {
+		return t, fmt.Errorf("missing value")
+	}
+
+	switch key {
+	case repoKeyOrg, repoKeyRepo, repoKeyName, repoKeyTopic, repoKeyLanguage, repoKeyDefaultBranch:
+	case repoKeyOwnerType:
+		if err := checkRepoTermValues(op, value, "organization", "user"); err != nil {
+			return t, err
+		}
+	case repoKeyVisibility:
+		if err := checkRepoTermValues(op, value, "public", "private", "internal"); err != nil {
+			return t, err
+		}
+	case repoKeyFork, repoKeyArchived:
+		if err := checkRepoTermValues(op, value, "true", "false"); err != nil {
+			return t, err
+		}
+	case repoKeyPushedSince:
+		if op != "=" {
+			return t, fmt.Errorf("%s only supports =", key)
+		}
+		since, err := parseSince(value, time.Now())
+		if err != nil {
+			return t, err
+		}
+		t.since = since
+		return t, nil
+	default:
+		if !strings.HasPrefix(key, repoKeyPropertyPrefix) || key == repoKeyPropertyPrefix {
+			return t, fmt.Errorf("unknown key %q", key)
+		}
+	}
+
+	for _, v := range strings.Split(value, ",") {
+		if v == "" {
+			return t, fmt.Errorf("empty value")
+		}
+		if strings.HasSuffix(op, "=") {
+			t.values = append(t.values, v)
+			continue
+		}
+		if expr, ok := strings.CutPrefix(v, regexPatternPrefix); ok {
+			// case-insensitive like the globs
+			re, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				return t, err
+			}
+			t.patterns = append(t.patterns, valuePattern{regex: re})
+		} else {
+			if _, err := path.Match(v, ""); err != nil {
+				return t, err
+			}
+			t.patterns = append(t.patterns, valuePattern{glob: strings.ToLower(v)})
+		}
+	}
+	return t, nil
+}
+
+func checkRepoTermValues(op, value string, allowed ...string) error {
+	if !strings.HasSuffix(op, "=") {
+		return nil
+	}
+	for _, v := range strings.Split(value, ",") {
+		if !slices.ContainsFunc(allowed, func(a string) bool { return strings.EqualFold(v, a) }) {
+			return fmt.Errorf("value %q must be one of %s", v, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
+// Filter returns the repos that match all terms. The custom properties of
+// repos are fetched if the list response did not include them.
+func (s *RepoSelector) Filter(ctx context.Context, client *github.Client, repos []*github.Repository) ([]*github.Repository, error) {
+	var result []*github.Repository
+	for _, repo := range repos {
+		ok, err := s.Matches(ctx, client, repo)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, repo)
+		}
+	}
+	return result, nil
+}
+
+// Matches reports whether repo matches all terms.
+func (s *RepoSelector) Matches(ctx context.Context, client *github.Client, repo *github.Repository) (bool, error) {
+	for _, t := range s.terms {
+		if strings.HasPrefix(t.key, repoKeyPropertyPrefix) && repo.CustomProperties == nil {
+			if err := loadCustomProperties(ctx, client, repo); err != nil {
+				return false, err
+			}
+		}
+		if !t.matches(repo) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (t repoTerm) matches(repo *github.Repository) bool {
+	if t.key == repoKeyPushedSince {
+		return !repo.GetPushedAt().Before(t.since)
+	}
+
+	return t.matchesAny(repoField(repo, t.key)) != t.negate
+}
+
+func (t repoTerm) matchesAny(fields []string) bool {
+	for _, field := range fields {
+		for _, v := range t.values {
+			if strings.EqualFold(field, v) {
+				return true
+			}
+		}
+		for _, p := range t.patterns {
+			if p.matches(field) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p valuePattern) matches(s string) bool {
+	if p.regex != nil {
+		return p.regex.MatchString(s)
+	}
+	ok, _ := path.Match(p.glob, strings.ToLower(s))
+	return ok
+}
+
+// repoField returns the values of a repo for a selector key.
+func repoField(repo *github.Repository, key string) []string {
+	switch key {
+	case repoKeyOrg:
+		return []string{repo.GetOwner().GetLogin()}
+	case repoKeyRepo:
+		return []string{repo.GetFullName()}
+	case repoKeyName:
+		return []string{repo.GetName()}
+	case repoKeyOwnerType:
+		return []string{repo.GetOwner().GetType()}
+	case repoKeyVisibility:
+		return []string{repoVisibility(repo)}
+	case repoKeyFork:
+		return []string{strconv.FormatBool(repo.GetFork())}
+	case repoKeyArchived:
+		return []string{strconv.FormatBool(repo.GetArchived())}
+	case repoKeyTopic:
+		return repo.Topics
+	case repoKeyLanguage:
+		return []string{repo.GetLanguage()}
+	case repoKeyDefaultBranch:
+		return []string{repo.GetDefaultBranch()}
+	}
+	name := strings.TrimPrefix(key, repoKeyPropertyPrefix)
+	switch v := repo.CustomProperties[name].(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, e := range v {
+			out = append(out, fmt.Sprint(e))
+		}
+		return out
+	case nil:
+		return nil
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// repoVisibility returns public, private or internal. Older GitHub Enterprise
+// Server versions only report whether a repo is private.
+func repoVisibility(repo *github.Repository) string {
+	if v := repo.GetVisibility(); v != "" {
+		return v
+	}
+	if repo.GetPrivate() {
+		return "private"
+	}
+	return "public"
+}
+
+// loadCustomProperties sets the custom properties of repo. Repos without
+// custom properties, like personal repos, get an empty set.
+func loadCustomProperties(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	values, _, err := client.Repositories.GetAllCustomPropertyValues(ctx, repo.GetOwner().GetLogin(), repo.GetName())
+	if e, ok := err.(*github.ErrorResponse); ok && e.Response.StatusCode == http.StatusNotFound {
+		values, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	repo.CustomProperties = map[string]any{}
+	for _, v := range values {
+		repo.CustomProperties[v.PropertyName] = v.Value
+	}
+	return nil
+}
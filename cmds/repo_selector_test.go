@@ -0,0 +1,154 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func selectRepoNames(t *testing.T, exprs, defaults []string, repos []*github.Repository) []string {
+	t.Helper()
+	defer func(e []string) { repoSelectExprs = e }(repoSelectExprs)
+	repoSelectExprs = exprs
+
+	sel, err := newRepoSelector(defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selected, err := sel.Filter(context.Background(), nil, repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, repo := range selected {
+		names = append(names, repo.GetFullName())
+	}
+	return names
+}
+
+func TestRepoSelectorMatches(t *testing.T) {
+	repo := func(fullName string, fn func(r *github.Repository)) *github.Repository {
+		owner, name, _ := strings.Cut(fullName, "/")
+		r := &github.Repository{
+			Owner:            &github.User{Login: github.Ptr(owner), Type: github.Ptr("Organization")},
+			Name:             github.Ptr(name),
+			FullName:         github.Ptr(fullName),
+			DefaultBranch:    github.Ptr("master"),
+			PushedAt:         &github.Timestamp{Time: time.Now()},
+			CustomProperties: map[string]any{},
+		}
+		fn(r)
+		return r
+	}
+	repos := []*github.Repository{
+		repo("kubedb/mysql", func(r *github.Repository) {
+			r.Language = github.Ptr("Go")
+			r.Topics = []string{"database", "kubernetes"}
+			r.CustomProperties["team"] = "db"
+		}),
+		repo("kubedb/mysql-fork", func(r *github.Repository) { r.Fork = github.Ptr(true) }),
+		repo("kubedb/old", func(r *github.Repository) {
+			r.Archived = github.Ptr(true)
+			r.PushedAt = &github.Timestamp{Time: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}
+		}),
+		repo("stashed/ui", func(r *github.Repository) {
+			r.Private = github.Ptr(true)
+			r.Language = github.Ptr("TypeScript")
+			r.DefaultBranch = github.Ptr("main")
+			r.CustomProperties["team"] = []any{"fe", "ux"}
+		}),
+		repo("tamal/notes", func(r *github.Repository) { r.Owner.Type = github.Ptr("User") }),
+	}
+
+	cases := []struct {
+		exprs    []string
+		defaults []string
+		want     []string
+	}{
+		{nil, nil, []string{"kubedb/mysql", "kubedb/mysql-fork", "kubedb/old", "stashed/ui", "tamal/notes"}},
+		{nil, defaultRepoTerms(false, "owner-type=organization"), []string{"kubedb/mysql", "stashed/ui"}},
+		{nil, defaultRepoTerms(true), []string{"kubedb/mysql", "kubedb/mysql-fork", "stashed/ui", "tamal/notes"}},
+		// a term replaces the default for its key
+		{[]string{"archived=true"}, defaultRepoTerms(false), []string{"kubedb/old"}},
+		{[]string{"org=KubeDB name~mysql*"}, nil, []string{"kubedb/mysql", "kubedb/mysql-fork"}},
+		{[]string{"org=kubedb", "name!~re:-fork$"}, nil, []string{"kubedb/mysql", "kubedb/old"}},
+		// regular expressions are case-insensitive like globs
+		{[]string{"name~re:^MySQL$", "language~GO"}, nil, []string{"kubedb/mysql"}},
+		{[]string{"repo=kubedb/mysql,stashed/ui"}, nil, []string{"kubedb/mysql", "stashed/ui"}},
+		{[]string{"visibility=private"}, nil, []string{"stashed/ui"}},
+		{[]string{"visibility!=private owner-type=organization fork=false"}, nil, []string{"kubedb/mysql", "kubedb/old"}},
+		{[]string{"topic=database"}, nil, []string{"kubedb/mysql"}},
+		{[]string{"language=go,typescript"}, nil, []string{"kubedb/mysql", "stashed/ui"}},
+		{[]string{"default-branch=main"}, nil, []string{"stashed/ui"}},
+		{[]string{"pushed-since=2020-01-01", "org=kubedb"}, nil, []string{"kubedb/mysql", "kubedb/mysql-fork"}},
+		{[]string{"property.team=db"}, nil, []string{"kubedb/mysql"}},
+		{[]string{"property.team~f*"}, nil, []string{"stashed/ui"}},
+		{[]string{"property.team!=db", "org=kubedb"}, nil, []string{"kubedb/mysql-fork", "kubedb/old"}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, selectRepoNames(t, c.exprs, c.defaults, repos), "%q", c.exprs)
+	}
+}
+
+func TestParseRepoTermsInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"org",
+		"org=",
+		"color=red",
+		"property.=x",
+		"visibility=secret",
+		"fork=yes",
+		"pushed-since~2020",
+		"pushed-since=last-week",
+		"name~re:(",
+		"name~[",
+		"org=a,,b",
+	} {
+		_, err := parseRepoTerms([]string{expr})
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestRepoSelectorLoadsCustomProperties(t *testing.T) {
+	srv, client := useFakeGitHub(t)
+	srv.AddOrg("kubedb")
+	srv.AddRepo("kubedb", "mysql", func(r *github.Repository) {
+		r.CustomProperties = map[string]any{"team": "db"}
+	})
+	srv.AddRepo("kubedb", "redis")
+
+	defer func(e []string) { repoSelectExprs = e }(repoSelectExprs)
+	repoSelectExprs = []string{"property.team=db"}
+	sel, err := newRepoSelector(nil)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	for _, name := range []string{"mysql", "redis"} {
+		repo := srv.Repo("kubedb", name).Repository()
+		repo.CustomProperties = nil // not part of the list response
+		ok, err := sel.Matches(ctx, client, repo)
+		assert.NoError(t, err)
+		assert.Equal(t, name == "mysql", ok, name)
+	}
+	assert.Contains(t, srv.Requests(), "GET /repos/kubedb/mysql/properties/values")
+}
@@ -18,11 +18,17 @@ package cmds
 
 import (
 	"context"
+	"sync"
 
 	"github.com/google/go-github/v84/github"
 )
 
+// freeOrgsMu guards freeOrgs, which is shared by repos processed concurrently.
+var freeOrgsMu sync.Mutex
+
 func cacheOrgFreePlan(org string, isFree bool) {
+	freeOrgsMu.Lock()
+	defer freeOrgsMu.Unlock()
 	freeOrgs[org] = isFree
 }
 
@@ -49,7 +55,10 @@ func repoSupportsProtection(ctx context.Context, client *github.Client, repo *gi
 }
 
 func orgUsesFreePlan(ctx context.Context, client *github.Client, org string) (bool, error) {
-	if isFree, ok := freeOrgs[org]; ok {
+	freeOrgsMu.Lock()
+	isFree, ok := freeOrgs[org]
+	freeOrgsMu.Unlock()
+	if ok {
 		return isFree, nil
 	}
 
@@ -58,7 +67,7 @@ func orgUsesFreePlan(ctx context.Context, client *github.Client, org string) (bo
 		return false, err
 	}
 
-	isFree := orgInfo.GetPlan().GetName() == "free"
+	isFree = orgInfo.GetPlan().GetName() == "free"
 	cacheOrgFreePlan(org, isFree)
 	return isFree, nil
 }
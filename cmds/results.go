@@ -0,0 +1,157 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/google/go-github/v84/github"
+)
+
+const (
+	outcomeOK      = "ok"
+	outcomeSkipped = "skipped"
+	outcomeFailed  = "failed"
+)
+
+var (
+	// resultsJSON is the file where fleet commands write the result of
+	// every repo.
+	resultsJSON string
+	// maxFailures is the number of failed repos a fleet command tolerates
+	// before it exits with an error.
+	maxFailures int
+)
+
+// RepoResult is the outcome of a repo processed by runFleet.
+type RepoResult struct {
+	Repo    string `json:"repo"`
+	Outcome string `json:"outcome"`
+	// Reason is why a repo was skipped.
+	Reason string `json:"reason,omitempty"`
+	// StatusCode is the HTTP status of a failed GitHub API request.
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// skippedError is returned by the function run by runFleet for repos it
+// does not process.
+type skippedError struct {
+	reason string
+}
+
+func (e *skippedError) Error() string {
+	return "skipped: " + e.reason
+}
+
+// skipRepo tells runFleet that a repo was skipped and why.
+func skipRepo(reason string) error {
+	return &skippedError{reason: reason}
+}
+
+func newRepoResult(repo *github.Repository, err error) RepoResult {
+	r := RepoResult{Repo: repo.GetFullName(), Outcome: outcomeOK}
+	var skipped *skippedError
+	if errors.As(err, &skipped) {
+		r.Outcome, r.Reason = outcomeSkipped, skipped.reason
+		return r
+	}
+	if err == nil {
+		return r
+	}
+	r.Outcome, r.Error = outcomeFailed, err.Error()
+
+	// keep err.Error(), which includes the request URL and the Errors of
+	// an ErrorResponse, and only pick the status code
+	var errResp *github.ErrorResponse
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	switch {
+	case errors.As(err, &errResp) && errResp.Response != nil:
+		r.StatusCode = errResp.Response.StatusCode
+	case errors.As(err, &rateErr) && rateErr.Response != nil:
+		r.StatusCode = rateErr.Response.StatusCode
+	case errors.As(err, &abuseErr) && abuseErr.Response != nil:
+		r.StatusCode = abuseErr.Response.StatusCode
+	}
+	return r
+}
+
+// fleetResults collects the results of a fleet command.
+type fleetResults struct {
+	results []RepoResult
+	counts  map[string]int
+}
+
+func (f *fleetResults) add(r RepoResult) {
+	if f.counts == nil {
+		f.counts = map[string]int{}
+	}
+	f.results = append(f.results, r)
+	f.counts[r.Outcome]++
+}
+
+// printSummary prints the skipped and failed repos and the number of repos
+// with each outcome.
+func (f *fleetResults) printSummary(w io.Writer) error {
+	if f.counts[outcomeSkipped]+f.counts[outcomeFailed] > 0 {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "REPO\tRESULT\tSTATUS\tDETAIL")
+		for _, r := range f.results {
+			switch r.Outcome {
+			case outcomeSkipped:
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t\t%s\n", r.Repo, r.Outcome, r.Reason)
+			case outcomeFailed:
+				status := ""
+				if r.StatusCode != 0 {
+					status = fmt.Sprint(r.StatusCode)
+				}
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Repo, r.Outcome, status, r.Error)
+			}
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d succeeded, %d skipped, %d failed\n", f.counts[outcomeOK], f.counts[outcomeSkipped], f.counts[outcomeFailed])
+	return err
+}
+
+func (f *fleetResults) writeJSON(filename string) error {
+	results := f.results
+	if results == nil {
+		results = []RepoResult{}
+	}
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0o644)
+}
+
+// err returns an error if more repos failed than --max-failures allows.
+func (f *fleetResults) err() error {
+	if n := f.counts[outcomeFailed]; n > maxFailures {
+		return fmt.Errorf("%d of %d repositories failed, more than --max-failures=%d", n, len(f.results), maxFailures)
+	}
+	return nil
+}
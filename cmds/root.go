@@ -23,30 +23,67 @@ import (
 	v "gomodules.xyz/x/version"
 )
 
+func init() {
+	// Commands print their flags in their own PersistentPreRun, which cobra
+	// runs instead of the one of the root command. Run the hooks of all
+	// parents too, so that the preflight checks of the root command are not
+	// skipped. This is a process wide setting of cobra, so it is set once
+	// here rather than every time a root command is built.
+	cobra.EnableTraverseRunHooks = true
+}
+
 func NewRootCmd(version string) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:               "gh-tools [command]",
 		Short:             `GitHub tools by AppsCode`,
 		DisableAutoGenTag: true,
+		PersistentPreRun: func(c *cobra.Command, args []string) {
+			runPreflight(c)
+		},
 	}
+	cmd.PersistentFlags().IntVar(&concurrency, "concurrency", concurrency, "Number of repositories processed in parallel by commands that walk many repositories")
+	cmd.PersistentFlags().StringVar(&checkpointFile, "checkpoint", checkpointFile, "If set, commands that walk many repositories record every finished repository in this file, and a rerun skips the ones that succeeded; failed and skipped repositories are retried")
+	cmd.PersistentFlags().IntVar(&maxFailures, "max-failures", maxFailures, "Number of failed repositories tolerated by commands that walk many repositories before they exit with an error")
+	cmd.PersistentFlags().StringVar(&resultsJSON, "results-json", resultsJSON, "If set, commands that walk many repositories write the result of every repository to this JSON file")
+	cmd.PersistentFlags().IntVar(&rateLimitHeadroom, "rate-limit-headroom", rateLimitHeadroom, "Number of API calls per rate limit window left unused for other tools sharing the token")
+	cmd.PersistentFlags().StringVar(&httpCacheDir, "cache-dir", httpCacheDir, "If set, cache GitHub API responses in this directory and revalidate them with ETags. Defaults to GH_TOOLS_CACHE_DIR.")
+	cmd.PersistentFlags().BoolVar(&noHTTPCache, "no-cache", noHTTPCache, "If true, do not use the on-disk cache of GitHub API responses, even if --cache-dir is set")
+	cmd.PersistentFlags().Int64Var(&githubAppID, "app-id", githubAppID, "If set, authenticate as this GitHub App instead of with GH_TOOLS_TOKEN. Defaults to GH_TOOLS_APP_ID.")
+	cmd.PersistentFlags().StringVar(&githubAppPrivateKeyFile, "app-private-key", githubAppPrivateKeyFile, "Path to the PEM private key of the GitHub App. Defaults to GH_TOOLS_APP_PRIVATE_KEY_FILE, or the key in GH_TOOLS_APP_PRIVATE_KEY.")
+	cmd.PersistentFlags().StringVar(&githubHost, "host", githubHost, "GitHub Enterprise Server host to use instead of github.com. Defaults to the host of a profile selected with --profile, else GH_TOOLS_HOST, else the host of currentProfile in the config file.")
+	cmd.PersistentFlags().StringVar(&configFile, "config", configFile, "Path to the gh-tools config file with named profiles. Defaults to GH_TOOLS_CONFIG, or $XDG_CONFIG_HOME/gh-tools/config.yaml.")
+	cmd.PersistentFlags().StringVar(&profileName, "profile", profileName, "Name of the profile in the config file to use for host, credentials and orgs. Defaults to GH_TOOLS_PROFILE, or currentProfile in the config file.")
+	cmd.PersistentFlags().BoolVar(&skipPreflight, "skip-preflight", skipPreflight, "If true, do not check that the token has the scopes the command needs before it starts. Needed for fine-grained tokens and tokens of GitHub Apps, whose permissions can not be listed.")
+	cmd.PersistentFlags().BoolVar(&globalDryRun, "dry-run", globalDryRun, "If true, log the method, URL and body of every request that would change GitHub instead of sending it")
+	cmd.PersistentFlags().StringVar(&journalFile, "journal", journalFile, "If set, append the state before every destructive request to this JSONL file, so that it can be reverted with gh-tools undo")
+	cmd.PersistentFlags().StringVar(&recordCassette, "record", recordCassette, "If set, record GitHub API requests and responses to this cassette file, with credentials removed")
+	cmd.PersistentFlags().StringVar(&replayCassette, "replay", replayCassette, "If set, serve GitHub API responses from this cassette file instead of calling GitHub. No token is needed.")
+	cmd.MarkFlagsMutuallyExclusive("record", "replay")
 	cmd.PersistentFlags().AddGoFlagSet(flag.CommandLine)
 	// ref: https://github.com/kubernetes/kubernetes/issues/17162#issuecomment-225596212
 	_ = flag.CommandLine.Parse([]string{})
 
 	cmd.AddCommand(NewCmdAddLabels())
+	cmd.AddCommand(NewCmdAuditProtection())
 	cmd.AddCommand(NewCmdChangelog())
 	cmd.AddCommand(NewCmdCopyRelease())
 	cmd.AddCommand(NewCmdDeletePackage())
 	cmd.AddCommand(NewCmdDeleteRelease())
 	cmd.AddCommand(NewCmdDependabot())
+	cmd.AddCommand(NewCmdDiscoverChecks())
+	cmd.AddCommand(NewCmdDoctor())
+	cmd.AddCommand(NewCmdLabels())
 	cmd.AddCommand(NewCmdListOrgs())
 	cmd.AddCommand(NewCmdListRepos())
+	cmd.AddCommand(NewCmdOrgRuleset())
 	cmd.AddCommand(NewCmdProtect())
 	cmd.AddCommand(NewCmdProtectOrg())
 	cmd.AddCommand(NewCmdProtectRepo())
 	cmd.AddCommand(NewCmdRelease())
+	cmd.AddCommand(NewCmdRestoreProtection())
 	cmd.AddCommand(NewCmdStarReport())
 	cmd.AddCommand(NewCmdStopWatch())
+	cmd.AddCommand(NewCmdUndo())
 	cmd.AddCommand(NewCmdUnprotect())
 	cmd.AddCommand(NewCmdUnprotectOrg())
 	cmd.AddCommand(NewCmdUnprotectRepo())
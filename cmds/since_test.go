@@ -0,0 +1,47 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	since, err := parseSince("", now)
+	assert.NoError(t, err)
+	assert.True(t, since.IsZero())
+
+	since, err = parseSince("2h", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-2*time.Hour), since)
+
+	since, err = parseSince("2024-04-30T10:00:00Z", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 4, 30, 10, 0, 0, 0, time.UTC), since)
+
+	since, err = parseSince("2024-04-30", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC), since)
+
+	_, err = parseSince("yesterday", now)
+	assert.Error(t, err)
+}
@@ -46,19 +46,23 @@ func NewCmdStarReport() *cobra.Command {
 		},
 	}
 	cmd.Flags().StringVar(&dirStarReport, "report-dir", dirStarReport, "Path to directory where star reports are stored")
+	addRepoSelectorFlag(cmd)
 	return cmd
 }
 
 func runStarReport() {
+	sel, err := newRepoSelector(defaultRepoTerms(false))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	ctx := context.Background()
 	client := newGitHubClient(ctx)
 
 	// Get the current user
-	user, _, err := client.Users.Get(ctx, "")
-	if err != nil {
+	if err := logCurrentUser(ctx, client); err != nil {
 		log.Fatal(err)
 	}
-	log.Println("user: ", user.GetLogin())
 
 	{
 		opt := &github.ListOptions{PerPage: 50}
@@ -77,55 +81,64 @@ func runStarReport() {
 			Affiliation: "owner,organization_member",
 			ListOptions: github.ListOptions{PerPage: 50},
 		}
-		repos, err := ListRepos(ctx, client, opt, false)
+		repos, err := ListRepos(ctx, client, opt, sel)
 		if err != nil {
 			log.Fatal(err)
 		}
 		log.Printf("Found %d repositories", len(repos))
-		for _, repo := range repos {
+		warnRateBudget(ctx, client, len(repos), 3)
+		err = runFleet(ctx, repos, func(ctx context.Context, repo *github.Repository) error {
 			if repo.GetOwner().GetType() == OwnerTypeUser {
-				fmt.Printf("[ ] %s --- SKIPPED\n", repo.GetFullName())
-				continue
+				printf(ctx, "[ ] %s --- SKIPPED\n", repo.GetFullName())
+				return skipRepo("personal repo")
 			}
-
 			if repo.GetPermissions().GetAdmin() {
-				dir := filepath.Join(dirStarReport, repo.Owner.GetLogin(), repo.GetName())
-				err = os.MkdirAll(dir, 0o755)
+				return writeStarReport(ctx, client, repo)
+			}
+			return skipRepo("no admin permission")
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func writeStarReport(ctx context.Context, client *github.Client, repo *github.Repository) error {
+	dir := filepath.Join(dirStarReport, repo.Owner.GetLogin(), repo.GetName())
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+	printf(ctx, "[x] %s >>> %s\n", repo.GetFullName(), dir)
+
+	{
+		o2 := &github.ListOptions{PerPage: 50}
+		stargazers, err := ListStargazers(ctx, client, repo, o2)
+		if err == nil {
+			data, err := json.MarshalIndent(stargazers, "", "  ")
+			if err == nil {
+				err = os.WriteFile(filepath.Join(dir, "stargazers.json"), data, 0o644)
 				if err != nil {
-					log.Fatal(err)
-				}
-				fmt.Printf("[x] %s >>> %s\n", repo.GetFullName(), dir)
-
-				{
-					o2 := &github.ListOptions{PerPage: 50}
-					stargazers, err := ListStargazers(ctx, client, repo, o2)
-					if err == nil {
-						data, err := json.MarshalIndent(stargazers, "", "  ")
-						if err == nil {
-							err = os.WriteFile(filepath.Join(dir, "stargazers.json"), data, 0o644)
-							if err != nil {
-								log.Println(err)
-							}
-						}
-					}
+					logf(ctx, "%v", err)
 				}
+			}
+		}
+	}
 
-				{
-					o2 := &github.ListOptions{PerPage: 50}
-					watchers, err := ListWatchers(ctx, client, repo, o2)
-					if err == nil {
-						data, err := json.MarshalIndent(watchers, "", "  ")
-						if err == nil {
-							err = os.WriteFile(filepath.Join(dir, "watchers.json"), data, 0o644)
-							if err != nil {
-								log.Println(err)
-							}
-						}
-					}
+	{
+		o2 := &github.ListOptions{PerPage: 50}
+		watchers, err := ListWatchers(ctx, client, repo, o2)
+		if err == nil {
+			data, err := json.MarshalIndent(watchers, "", "  ")
+			if err == nil {
+				err = os.WriteFile(filepath.Join(dir, "watchers.json"), data, 0o644)
+				if err != nil {
+					logf(ctx, "%v", err)
 				}
 			}
 		}
 	}
+	return nil
 }
 
 func ListStargazers(ctx context.Context, client *github.Client, repo *github.Repository, opt *github.ListOptions) ([]*github.Stargazer, error) {
@@ -0,0 +1,272 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/spf13/cobra"
+	"gomodules.xyz/flags"
+)
+
+// errCannotUndo marks journal entries that undo skips.
+var errCannotUndo = errors.New("can not be undone")
+
+func NewCmdUndo() *cobra.Command {
+	var since string
+
+	cmd := &cobra.Command{
+		Use:               "undo",
+		Short:             "Undo the changes recorded in a --journal file, newest first",
+		Long:              "Undo the changes recorded in a --journal file, newest first.\n\nRequests that failed or did not complete are skipped. Undoing deleted org rulesets needs the admin:org scope.",
+		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
+		PersistentPreRun: func(c *cobra.Command, args []string) {
+			flags.PrintFlags(c.Flags())
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			runUndo(since)
+		},
+	}
+
+	cmd.Flags().StringVar(&since, "since", since, "Only undo changes made since this time (RFC3339) or within this duration (for example 2h)")
+
+	return cmd
+}
+
+func runUndo(since string) {
+	if journalFile == "" {
+		log.Fatalln("--journal is required")
+	}
+	from, err := parseSince(since, time.Now())
+	if err != nil {
+		log.Fatalf("invalid --since: %v", err)
+	}
+	entries, err := readJournal(journalFile, from)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	// the changes made by undo are not journaled, the journal is read only
+	journalFile = ""
+
+	ctx := context.Background()
+	client := newGitHubClient(ctx)
+	if !skipPreflight && slices.ContainsFunc(entries, func(e JournalEntry) bool { return e.Action == journalDeleteOrgRuleset && e.completed() }) {
+		// only org rulesets need more than the scopes of the command
+		if err := checkScopes(ctx, client, "undoing org ruleset deletes", []string{"admin:org"}); err != nil {
+			log.Fatalln("preflight:", err)
+		}
+	}
+
+	var undone, skipped, failed int
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		note, err := undoJournalEntry(ctx, client, e)
+		switch {
+		case errors.Is(err, errCannotUndo):
+			skipped++
+			fmt.Printf("[SKIP] %s %s: %v\n", e.Action, e.target(), err)
+		case err != nil:
+			failed++
+			fmt.Printf("[FAIL] %s %s: %v\n", e.Action, e.target(), err)
+		default:
+			undone++
+			fmt.Printf("[UNDO] %s %s%s\n", e.Action, e.target(), note)
+		}
+	}
+	log.Printf("undid %d, skipped %d and failed %d of %d journal entries", undone, skipped, failed, len(entries))
+	if failed > 0 {
+		log.Fatalf("failed to undo %d journal entries", failed)
+	}
+}
+
+// target describes what the entry changed.
+func (e JournalEntry) target() string {
+	p := e.Params
+	switch e.Action {
+	case journalDeletePackage:
+		return fmt.Sprintf("%s/%s/%s", p["org"], p["type"], p["name"])
+	case journalDeletePackageVersion:
+		return fmt.Sprintf("%s/%s/%s version %s", p["org"], p["type"], p["name"], p["id"])
+	case journalDeleteOrgRuleset:
+		return fmt.Sprintf("%s ruleset %s", p["org"], p["id"])
+	case journalRemoveProtection, journalRemoveAdminEnforce:
+		return fmt.Sprintf("%s/%s:%s", p["owner"], p["repo"], p["branch"])
+	case journalDeleteRuleset, journalDeleteRelease:
+		return fmt.Sprintf("%s/%s %s", p["owner"], p["repo"], p["id"])
+	case journalEditLabel, journalDeleteLabel:
+		return fmt.Sprintf("%s/%s label %q", p["owner"], p["repo"], p["name"])
+	default:
+		return fmt.Sprintf("%s/%s", p["owner"], p["repo"])
+	}
+}
+
+// undoJournalEntry makes the inverse change of e. It returns a note about
+// what could not be restored, if any.
+func undoJournalEntry(ctx context.Context, client *github.Client, e JournalEntry) (string, error) {
+	switch {
+	case e.Error != "":
+		return "", fmt.Errorf("request failed: %s: %w", e.Error, errCannotUndo)
+	case e.Status == 0:
+		return "", fmt.Errorf("request did not complete: %w", errCannotUndo)
+	case !e.completed():
+		return "", fmt.Errorf("request returned %d: %w", e.Status, errCannotUndo)
+	}
+	switch e.Action {
+	case journalDeletePackage, journalDeletePackageVersion:
+		return "", fmt.Errorf("%w: deleted packages can only be restored from the package settings on GitHub, within 30 days", errCannotUndo)
+	}
+	if len(e.Prior) == 0 {
+		return "", fmt.Errorf("%w: the state before the change was not recorded: %s", errCannotUndo, e.PriorError)
+	}
+
+	p := e.Params
+	owner, repo := p["owner"], p["repo"]
+	switch e.Action {
+	case journalRemoveProtection:
+		var prior github.Protection
+		if err := json.Unmarshal(e.Prior, &prior); err != nil {
+			return "", err
+		}
+		return "", restoreBranchProtection(ctx, client, owner, repo, p["branch"], &prior)
+
+	case journalRemoveAdminEnforce:
+		var prior github.AdminEnforcement
+		if err := json.Unmarshal(e.Prior, &prior); err != nil {
+			return "", err
+		}
+		if !prior.Enabled {
+			return " (was not enforced)", nil
+		}
+		_, _, err := client.Repositories.AddAdminEnforcement(ctx, owner, repo, p["branch"])
+		return "", err
+
+	case journalDeleteRuleset:
+		var prior github.RepositoryRuleset
+		if err := json.Unmarshal(e.Prior, &prior); err != nil {
+			return "", err
+		}
+		existing, err := listRepoRulesets(ctx, client, owner, repo)
+		if err != nil {
+			return "", err
+		}
+		if rulesetNamed(existing, prior.Name) {
+			return "", fmt.Errorf("%w: a ruleset named %q exists", errCannotUndo, prior.Name)
+		}
+		rs, _, err := client.Repositories.CreateRuleset(ctx, owner, repo, rulesetRequest(&prior))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(" (re-created as %d)", rs.GetID()), nil
+
+	case journalDeleteOrgRuleset:
+		var prior github.RepositoryRuleset
+		if err := json.Unmarshal(e.Prior, &prior); err != nil {
+			return "", err
+		}
+		existing, err := listOrgRulesets(ctx, client, p["org"])
+		if err != nil {
+			return "", err
+		}
+		if rulesetNamed(existing, prior.Name) {
+			return "", fmt.Errorf("%w: a ruleset named %q exists", errCannotUndo, prior.Name)
+		}
+		rs, _, err := client.Organizations.CreateRepositoryRuleset(ctx, p["org"], rulesetRequest(&prior))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(" (re-created as %d)", rs.GetID()), nil
+
+	case journalEditLabel:
+		var prior, edit github.Label
+		if err := json.Unmarshal(e.Prior, &prior); err != nil {
+			return "", err
+		}
+		current := p["name"]
+		if len(e.Body) > 0 && json.Unmarshal(e.Body, &edit) == nil && edit.GetName() != "" {
+			current = edit.GetName() // the label was renamed
+		}
+		_, _, err := client.Issues.EditLabel(ctx, owner, repo, current, &github.Label{
+			Name:        prior.Name,
+			Color:       prior.Color,
+			Description: prior.Description,
+		})
+		return "", err
+
+	case journalDeleteLabel:
+		var prior github.Label
+		if err := json.Unmarshal(e.Prior, &prior); err != nil {
+			return "", err
+		}
+		_, _, err := client.Issues.CreateLabel(ctx, owner, repo, &github.Label{
+			Name:        prior.Name,
+			Color:       prior.Color,
+			Description: prior.Description,
+		})
+		return "", err
+
+	case journalDeleteSubscription:
+		var prior github.Subscription
+		if err := json.Unmarshal(e.Prior, &prior); err != nil {
+			return "", err
+		}
+		_, _, err := client.Activity.SetRepositorySubscription(ctx, owner, repo, &github.Subscription{
+			Subscribed: prior.Subscribed,
+			Ignored:    prior.Ignored,
+		})
+		return "", err
+
+	case journalDeleteRelease:
+		var prior github.RepositoryRelease
+		if err := json.Unmarshal(e.Prior, &prior); err != nil {
+			return "", err
+		}
+		_, _, err := client.Repositories.CreateRelease(ctx, owner, repo, &github.RepositoryRelease{
+			TagName:         prior.TagName,
+			TargetCommitish: prior.TargetCommitish,
+			Name:            prior.Name,
+			Body:            prior.Body,
+			Draft:           prior.Draft,
+			Prerelease:      prior.Prerelease,
+		})
+		if err != nil {
+			return "", err
+		}
+		if n := len(prior.Assets); n > 0 {
+			return " (without its " + strconv.Itoa(n) + " assets, which can not be restored)", nil
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("%w: unknown action", errCannotUndo)
+}
+
+func rulesetNamed(rulesets []*github.RepositoryRuleset, name string) bool {
+	for _, rs := range rulesets {
+		if rs.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+	"gomodules.xyz/pointer"
+)
+
+func TestMatchJournalOperation(t *testing.T) {
+	cases := []struct {
+		method, url string
+		action      string
+		params      map[string]string
+	}{
+		{http.MethodDelete, "https://api.github.com/repos/kubedb/mysql/branches/release%2F1.0/protection", journalRemoveProtection, map[string]string{"owner": "kubedb", "repo": "mysql", "branch": "release/1.0"}},
+		{http.MethodDelete, "https://ghe.example.com/api/v3/repos/kubedb/mysql/labels/good%20first%20issue", journalDeleteLabel, map[string]string{"owner": "kubedb", "repo": "mysql", "name": "good first issue"}},
+		{http.MethodPatch, "https://api.github.com/repos/kubedb/mysql/labels/bug", journalEditLabel, map[string]string{"owner": "kubedb", "repo": "mysql", "name": "bug"}},
+		{http.MethodDelete, "https://api.github.com/orgs/kubedb/packages/container/mysql/versions/7", journalDeletePackageVersion, map[string]string{"org": "kubedb", "type": "container", "name": "mysql", "id": "7"}},
+		{http.MethodGet, "https://api.github.com/repos/kubedb/mysql/labels/bug", "", nil},
+		{http.MethodPost, "https://api.github.com/repos/kubedb/mysql/labels", "", nil},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.url)
+		assert.NoError(t, err)
+		action, params, ok := matchJournalOperation(c.method, u)
+		assert.Equal(t, c.action != "", ok, c.url)
+		assert.Equal(t, c.action, action, c.url)
+		assert.Equal(t, c.params, params, c.url)
+	}
+}
+
+func TestUndoJournal(t *testing.T) {
+	srv, _ := useFakeGitHub(t)
+	fake := srv.AddRepo("kubedb", "mysql")
+	fake.SetProtection("master", &github.Protection{
+		RequiredPullRequestReviews: &github.PullRequestReviewsEnforcement{RequiredApprovingReviewCount: 1},
+		EnforceAdmins:              &github.AdminEnforcement{Enabled: true},
+	})
+	fake.AddRuleset(github.RepositoryRuleset{Name: "default", Target: github.Ptr(github.RulesetTargetBranch), Enforcement: github.RulesetEnforcementActive})
+	fake.AddLabel("bug", "d73a4a", "Something isn't working")
+	fake.AddLabel("automerge", "ffffff", "")
+	srv.AddPackage("kubedb", "container", "mysql", "public")
+
+	oldJournal := journalFile
+	journalFile = filepath.Join(t.TempDir(), "journal.jsonl")
+	t.Cleanup(func() {
+		journalMu.Lock()
+		if journalWriter != nil {
+			_ = journalWriter.Close()
+			journalWriter = nil
+		}
+		journalMu.Unlock()
+		journalFile = oldJournal
+	})
+
+	client := github.NewClient(&http.Client{Transport: &journalTransport{base: http.DefaultTransport}})
+	client.BaseURL, client.UploadURL = srv.Client().BaseURL, srv.Client().UploadURL
+
+	ctx := context.Background()
+	_, err := client.Repositories.RemoveBranchProtection(ctx, "kubedb", "mysql", "master")
+	assert.NoError(t, err)
+	_, err = client.Repositories.DeleteRuleset(ctx, "kubedb", "mysql", fake.Rulesets()[0].GetID())
+	assert.NoError(t, err)
+	_, err = client.Issues.DeleteLabel(ctx, "kubedb", "mysql", "bug")
+	assert.NoError(t, err)
+	_, _, err = client.Issues.EditLabel(ctx, "kubedb", "mysql", "automerge", &github.Label{Name: pointer.StringP("merge"), Color: pointer.StringP("fef2c0")})
+	assert.NoError(t, err)
+	_, err = client.Organizations.DeletePackage(ctx, "kubedb", "container", "mysql")
+	assert.NoError(t, err)
+	// failed requests are journaled, but not undone
+	_, err = client.Repositories.RemoveBranchProtection(ctx, "kubedb", "mysql", "master")
+	assert.Error(t, err)
+	_, err = client.Issues.DeleteLabel(ctx, "kubedb", "mysql", "missing")
+	assert.Error(t, err)
+
+	assert.Nil(t, fake.Protection("master"))
+	assert.Empty(t, fake.Rulesets())
+	assert.Equal(t, []string{"merge=fef2c0"}, labelColors(fake.Labels()))
+
+	entries, err := readJournal(journalFile, time.Time{})
+	assert.NoError(t, err)
+	var (
+		actions  []string
+		statuses []int
+	)
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+		statuses = append(statuses, e.Status)
+	}
+	assert.Equal(t, []string{journalRemoveProtection, journalDeleteRuleset, journalDeleteLabel, journalEditLabel, journalDeletePackage, journalRemoveProtection, journalDeleteLabel}, actions)
+	assert.Equal(t, []int{http.StatusNoContent, http.StatusNoContent, http.StatusNoContent, http.StatusOK, http.StatusNoContent, http.StatusNotFound, http.StatusNotFound}, statuses)
+	for _, e := range entries[:5] {
+		assert.NotEmpty(t, e.Prior, e.Action)
+	}
+
+	// undo must not journal its own changes
+	journalFile = ""
+	for i := len(entries) - 1; i >= 0; i-- {
+		_, err := undoJournalEntry(ctx, srv.Client(), entries[i])
+		if entries[i].Action == journalDeletePackage || !entries[i].completed() {
+			assert.True(t, errors.Is(err, errCannotUndo), "deleted packages and failed requests can not be undone")
+			continue
+		}
+		assert.NoError(t, err, entries[i].Action)
+	}
+
+	p := fake.Protection("master")
+	if assert.NotNil(t, p) {
+		assert.Equal(t, 1, p.GetRequiredPullRequestReviews().RequiredApprovingReviewCount)
+		assert.True(t, p.GetEnforceAdmins().Enabled)
+	}
+	if rulesets := fake.Rulesets(); assert.Len(t, rulesets, 1) {
+		assert.Equal(t, "default", rulesets[0].Name)
+	}
+	assert.Equal(t, []string{"automerge=ffffff", "bug=d73a4a"}, labelColors(fake.Labels()))
+	assert.Empty(t, srv.Packages("kubedb"))
+
+	// a ruleset is not re-created twice
+	_, err = undoJournalEntry(ctx, srv.Client(), entries[1])
+	assert.True(t, errors.Is(err, errCannotUndo))
+}
+
+func TestReadJournalCompletions(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "journal.jsonl")
+	data := `{"id":"1","time":"2026-10-01T10:00:00Z","action":"delete-label","params":{"owner":"kubedb","repo":"mysql","name":"bug"}}
+{"id":"2","time":"2026-10-01T10:00:01Z","action":"delete-label","params":{"owner":"kubedb","repo":"mysql","name":"wip"}}
+{"id":"1","time":"2026-10-01T10:00:02Z","status":204}
+{"id":"3","time":"2026-10-01T10:00:03Z","action":"delete-label","params":{"owner":"kubedb","repo":"mysql","name":"help"}}
+{"id":"3","time":"2026-10-01T10:00:04Z","error":"connection reset"}
+`
+	if err := os.WriteFile(filename, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := readJournal(filename, time.Time{})
+	if !assert.NoError(t, err) || !assert.Len(t, entries, 3) {
+		return
+	}
+	assert.True(t, entries[0].completed())
+	assert.False(t, entries[1].completed(), "the request did not complete")
+	assert.Equal(t, "connection reset", entries[2].Error)
+
+	ctx := context.Background()
+	for _, e := range entries[1:] {
+		_, err := undoJournalEntry(ctx, nil, e)
+		assert.True(t, errors.Is(err, errCannotUndo), e.Params["name"])
+	}
+}
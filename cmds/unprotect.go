@@ -22,7 +22,7 @@ import (
 	"log"
 	"slices"
 	"strings"
-	"time"
+	"sync/atomic"
 
 	"github.com/google/go-github/v84/github"
 	"github.com/spf13/cobra"
@@ -39,17 +39,19 @@ func NewCmdUnprotect() *cobra.Command {
 		skipRepos       []string
 		localShards     int
 		localShardIndex int
+		backupDir       string
 	)
 
 	cmd := &cobra.Command{
 		Use:               "unprotect",
 		Short:             "Delete matching rulesets and branch protections from accessible repositories",
 		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			flags.PrintFlags(c.Flags())
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			runUnprotect(rules, deleteAllRules, bypass, includeFork, skipRepos, localShardIndex, localShards)
+			runUnprotect(rules, deleteAllRules, bypass, includeFork, skipRepos, localShardIndex, localShards, backupDir)
 		},
 	}
 
@@ -60,31 +62,35 @@ func NewCmdUnprotect() *cobra.Command {
 	cmd.Flags().StringSliceVar(&skipRepos, "skip", nil, "Skip owner/repository")
 	cmd.Flags().IntVar(&localShards, "shards", -1, "Total number of shards")
 	cmd.Flags().IntVar(&localShardIndex, "shard-index", -1, "Shard index to be processed")
+	cmd.Flags().StringVar(&backupDir, "backup-dir", "", "If set, save branch protections and rulesets of each repo to this directory before changing them. Existing backups are kept.")
+	addRepoSelectorFlag(cmd)
 
 	return cmd
 }
 
-func runUnprotect(rules []string, deleteAllRules bool, bypass bool, includeFork bool, skipRepos []string, localShardIndex, localShards int) {
+func runUnprotect(rules []string, deleteAllRules bool, bypass bool, includeFork bool, skipRepos []string, localShardIndex, localShards int, backupDir string) {
 	requestedRules := normalizeRules(rules)
 	if !deleteAllRules && len(requestedRules) == 0 {
 		log.Println("WARNING: no --rule names provided, nothing to delete")
 		return
 	}
+	sel, err := newRepoSelector(defaultRepoTerms(includeFork, "owner-type=organization"))
+	if err != nil {
+		log.Fatalln(err)
+	}
 
 	ctx := context.Background()
 	client := newGitHubClient(ctx)
 
-	user, _, err := client.Users.Get(ctx, "")
-	if err != nil {
+	if err := logCurrentUser(ctx, client); err != nil {
 		log.Fatalln(err)
 	}
-	log.Println("user:", user.GetLogin())
 
 	opt := &github.RepositoryListByAuthenticatedUserOptions{
 		Affiliation: "owner,organization_member",
 		ListOptions: github.ListOptions{PerPage: 50},
 	}
-	repos, err := ListRepos(ctx, client, opt, includeFork)
+	repos, err := ListRepos(ctx, client, opt, sel)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -92,58 +98,39 @@ func runUnprotect(rules []string, deleteAllRules bool, bypass bool, includeFork
 	repos = shardRepos(repos, localShardIndex, localShards)
 	skipSet := sets.NewString(skipRepos...)
 	log.Printf("Found %d repositories", len(repos))
+	warnRateBudget(ctx, client, len(repos), 5)
 
-	totalRulesetsDeleted := 0
-	totalBranchProtectionsDeleted := 0
-	for _, repo := range repos {
-		if repo.GetOwner().GetType() == OwnerTypeUser {
-			continue
-		}
+	var totalRulesetsDeleted, totalBranchProtectionsDeleted atomic.Int64
+	err = runFleet(ctx, repos, func(ctx context.Context, repo *github.Repository) error {
 		if !repo.GetPermissions().GetAdmin() {
-			continue
+			return skipRepo("no admin permission")
 		}
 		supported, reason, err := repoSupportsProtection(ctx, client, repo)
 		if err != nil {
-			log.Fatalln(err)
+			return err
 		}
 		if !supported {
-			log.Printf("Skipping %s (%s)", repo.GetFullName(), reason)
-			continue
+			return skipRepo(reason)
 		}
 		if skipSet.Has(repo.GetFullName()) {
-			continue
+			return skipRepo("in skip list")
 		}
-		if bypass {
-			branchProtectionsUpdated, err := relaxRepoBranchProtectionBypass(ctx, client, repo, requestedRules, deleteAllRules)
-			if err != nil {
-				log.Fatalln(err)
-			}
-			totalBranchProtectionsDeleted += branchProtectionsUpdated
-			time.Sleep(10 * time.Millisecond)
-			continue
-		}
-
-		rulesetsDeleted, err := deleteMatchingRepoRulesets(ctx, client, repo.GetOwner().GetLogin(), repo.GetName(), requestedRules, deleteAllRules)
-		if err != nil {
-			log.Fatalln(err)
-		}
-		totalRulesetsDeleted += rulesetsDeleted
-
-		branchProtectionsDeleted, err := deleteRepoBranchProtections(ctx, client, repo, requestedRules, deleteAllRules)
-		if err != nil {
-			log.Fatalln(err)
-		}
-		totalBranchProtectionsDeleted += branchProtectionsDeleted
-		time.Sleep(10 * time.Millisecond)
+		rulesetsDeleted, branchProtectionsDeleted, err := unprotectFleetRepo(ctx, client, repo, requestedRules, deleteAllRules, bypass, backupDir)
+		totalRulesetsDeleted.Add(int64(rulesetsDeleted))
+		totalBranchProtectionsDeleted.Add(int64(branchProtectionsDeleted))
+		return err
+	})
+	if err != nil {
+		log.Fatalln(err)
 	}
 	if bypass {
-		log.Printf("updated %d branch protection rule(s) to allow bypass", totalBranchProtectionsDeleted)
+		log.Printf("updated %d branch protection rule(s) to allow bypass", totalBranchProtectionsDeleted.Load())
 		return
 	}
-	log.Printf("deleted %d matching ruleset(s) and %d branch protection rule(s) in total", totalRulesetsDeleted, totalBranchProtectionsDeleted)
+	log.Printf("deleted %d matching ruleset(s) and %d branch protection rule(s) in total", totalRulesetsDeleted.Load(), totalBranchProtectionsDeleted.Load())
 }
 
-func runUnprotectRepo(owner, repo string, rules []string, deleteAllRules bool, bypass bool) {
+func runUnprotectRepo(owner, repo string, rules []string, deleteAllRules bool, bypass bool, backupDir string) {
 	requestedRules := normalizeRules(rules)
 	if !deleteAllRules && len(requestedRules) == 0 {
 		log.Println("WARNING: no --rule names provided, nothing to delete")
@@ -171,6 +158,12 @@ func runUnprotectRepo(owner, repo string, rules []string, deleteAllRules bool, b
 		return
 	}
 
+	if backupDir != "" {
+		if err := backupRepoProtection(ctx, client, r, backupDir); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
 	if bypass {
 		updated, err := relaxRepoBranchProtectionBypass(ctx, client, r, requestedRules, deleteAllRules)
 		if err != nil {
@@ -209,7 +202,7 @@ func runUnprotectRepo(owner, repo string, rules []string, deleteAllRules bool, b
 	log.Printf("deleted %d matching ruleset(s) and %d branch protection rule(s)", rulesetsDeleted, branchProtectionsDeleted)
 }
 
-func runUnprotectOrg(org string, includeForks bool, skipList []string, rules []string, deleteAllRules bool, bypass bool) {
+func runUnprotectOrg(org string, includeForks bool, skipList []string, rules []string, deleteAllRules bool, bypass bool, backupDir string) {
 	requestedRules := normalizeRules(rules)
 	if !deleteAllRules && len(requestedRules) == 0 {
 		log.Println("WARNING: no --rule names provided, nothing to delete")
@@ -218,15 +211,17 @@ func runUnprotectOrg(org string, includeForks bool, skipList []string, rules []s
 	if org == "" {
 		log.Fatal("--org flag is required")
 	}
+	sel, err := newRepoSelector(defaultRepoTerms(includeForks))
+	if err != nil {
+		log.Fatalln(err)
+	}
 
 	ctx := context.Background()
 	client := newGitHubClient(ctx)
 
-	user, _, err := client.Users.Get(ctx, "")
-	if err != nil {
+	if err := logCurrentUser(ctx, client); err != nil {
 		log.Fatalln(err)
 	}
-	log.Println("user:", user.GetLogin())
 
 	if _, err := orgUsesFreePlan(ctx, client, org); err != nil {
 		log.Fatalln(err)
@@ -235,61 +230,65 @@ func runUnprotectOrg(org string, includeForks bool, skipList []string, rules []s
 	opt := &github.RepositoryListByOrgOptions{
 		ListOptions: github.ListOptions{PerPage: 50},
 	}
-	repos, err := ListOrgRepos(ctx, client, org, opt, includeForks)
+	repos, err := ListOrgRepos(ctx, client, org, opt, sel)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
 	skipRepos := sets.NewString(skipList...)
 	log.Printf("Found %d repositories in org %s", len(repos), org)
+	warnRateBudget(ctx, client, len(repos), 5)
 
-	totalRulesetsDeleted := 0
-	totalBranchProtectionsDeleted := 0
-	for _, repo := range repos {
+	var totalRulesetsDeleted, totalBranchProtectionsDeleted atomic.Int64
+	err = runFleet(ctx, repos, func(ctx context.Context, repo *github.Repository) error {
 		if !repo.GetPermissions().GetAdmin() {
-			log.Printf("Skipping %s (no admin permission)", repo.GetFullName())
-			continue
+			return skipRepo("no admin permission")
 		}
 		supported, reason, err := repoSupportsProtection(ctx, client, repo)
 		if err != nil {
-			log.Fatalln(err)
+			return err
 		}
 		if !supported {
-			log.Printf("Skipping %s (%s)", repo.GetFullName(), reason)
-			continue
+			return skipRepo(reason)
 		}
 		if skipRepos.Has(repo.GetName()) {
-			log.Printf("Skipping %s (in skip list)", repo.GetFullName())
-			continue
-		}
-		if bypass {
-			branchProtectionsUpdated, err := relaxRepoBranchProtectionBypass(ctx, client, repo, requestedRules, deleteAllRules)
-			if err != nil {
-				log.Fatalln(err)
-			}
-			totalBranchProtectionsDeleted += branchProtectionsUpdated
-			time.Sleep(10 * time.Millisecond)
-			continue
-		}
-
-		rulesetsDeleted, err := deleteMatchingRepoRulesets(ctx, client, org, repo.GetName(), requestedRules, deleteAllRules)
-		if err != nil {
-			log.Fatalln(err)
+			return skipRepo("in skip list")
 		}
-		totalRulesetsDeleted += rulesetsDeleted
+		rulesetsDeleted, branchProtectionsDeleted, err := unprotectFleetRepo(ctx, client, repo, requestedRules, deleteAllRules, bypass, backupDir)
+		totalRulesetsDeleted.Add(int64(rulesetsDeleted))
+		totalBranchProtectionsDeleted.Add(int64(branchProtectionsDeleted))
+		return err
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if bypass {
+		log.Printf("updated %d branch protection rule(s) to allow bypass in org %s", totalBranchProtectionsDeleted.Load(), org)
+		return
+	}
+	log.Printf("deleted %d matching ruleset(s) and %d branch protection rule(s) in org %s", totalRulesetsDeleted.Load(), totalBranchProtectionsDeleted.Load(), org)
+}
 
-		branchProtectionsDeleted, err := deleteRepoBranchProtections(ctx, client, repo, requestedRules, deleteAllRules)
-		if err != nil {
-			log.Fatalln(err)
+// unprotectFleetRepo backs up and removes (or relaxes) the matching
+// protection of a repo processed by unprotect or unprotect-org. With bypass,
+// the number of updated branch protections is returned as deleted.
+func unprotectFleetRepo(ctx context.Context, client *github.Client, repo *github.Repository, requestedRules map[string]struct{}, deleteAllRules, bypass bool, backupDir string) (int, int, error) {
+	if backupDir != "" {
+		if err := backupRepoProtection(ctx, client, repo, backupDir); err != nil {
+			return 0, 0, err
 		}
-		totalBranchProtectionsDeleted += branchProtectionsDeleted
-		time.Sleep(10 * time.Millisecond)
 	}
 	if bypass {
-		log.Printf("updated %d branch protection rule(s) to allow bypass in org %s", totalBranchProtectionsDeleted, org)
-		return
+		updated, err := relaxRepoBranchProtectionBypass(ctx, client, repo, requestedRules, deleteAllRules)
+		return 0, updated, err
+	}
+
+	rulesetsDeleted, err := deleteMatchingRepoRulesets(ctx, client, repo.GetOwner().GetLogin(), repo.GetName(), requestedRules, deleteAllRules)
+	if err != nil {
+		return rulesetsDeleted, 0, err
 	}
-	log.Printf("deleted %d matching ruleset(s) and %d branch protection rule(s) in org %s", totalRulesetsDeleted, totalBranchProtectionsDeleted, org)
+	branchProtectionsDeleted, err := deleteRepoBranchProtections(ctx, client, repo, requestedRules, deleteAllRules)
+	return rulesetsDeleted, branchProtectionsDeleted, err
 }
 
 func listRepoRulesets(ctx context.Context, client *github.Client, owner, repo string) ([]*github.RepositoryRuleset, error) {
@@ -332,9 +331,9 @@ func deleteMatchingRepoRulesets(ctx context.Context, client *github.Client, owne
 		}
 
 		if deleteAllRules {
-			log.Printf("[DELETE] %s/%s ruleset %q (%d) [all-rules]", owner, repo, rs.Name, rs.GetID())
+			logf(ctx, "[DELETE] %s/%s ruleset %q (%d) [all-rules]", owner, repo, rs.Name, rs.GetID())
 		} else {
-			log.Printf("[DELETE] %s/%s ruleset %q (%d)", owner, repo, rs.Name, rs.GetID())
+			logf(ctx, "[DELETE] %s/%s ruleset %q (%d)", owner, repo, rs.Name, rs.GetID())
 		}
 		if _, err := client.Repositories.DeleteRuleset(ctx, owner, repo, rs.GetID()); err != nil {
 			return deleted, err
@@ -367,9 +366,9 @@ func deleteRepoBranchProtections(ctx context.Context, client *github.Client, rep
 			return deleted, err
 		}
 		if deleteAllRules {
-			log.Printf("[DELETE] %s/%s branch protection %q [all-rules]", repo.Owner.GetLogin(), repo.GetName(), name)
+			logf(ctx, "[DELETE] %s/%s branch protection %q [all-rules]", repo.Owner.GetLogin(), repo.GetName(), name)
 		} else {
-			log.Printf("[DELETE] %s/%s branch protection %q", repo.Owner.GetLogin(), repo.GetName(), name)
+			logf(ctx, "[DELETE] %s/%s branch protection %q", repo.Owner.GetLogin(), repo.GetName(), name)
 		}
 		deleted++
 	}
@@ -399,9 +398,9 @@ func relaxRepoBranchProtectionBypass(ctx context.Context, client *github.Client,
 			return updated, err
 		}
 		if deleteAllRules {
-			log.Printf("[BYPASS] %s/%s branch protection %q [all-rules]", repo.Owner.GetLogin(), repo.GetName(), name)
+			logf(ctx, "[BYPASS] %s/%s branch protection %q [all-rules]", repo.Owner.GetLogin(), repo.GetName(), name)
 		} else {
-			log.Printf("[BYPASS] %s/%s branch protection %q", repo.Owner.GetLogin(), repo.GetName(), name)
+			logf(ctx, "[BYPASS] %s/%s branch protection %q", repo.Owner.GetLogin(), repo.GetName(), name)
 		}
 		updated++
 	}
@@ -29,17 +29,19 @@ func NewCmdUnprotectOrg() *cobra.Command {
 		includeFork    bool
 		deleteAllRules bool
 		bypass         bool
+		backupDir      string
 	)
 
 	cmd := &cobra.Command{
 		Use:               "unprotect-org",
 		Short:             "Delete matching rulesets and branch protections from all repos in an organization",
 		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			flags.PrintFlags(c.Flags())
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			runUnprotectOrg(org, includeFork, orgSkipList, rules, deleteAllRules, bypass)
+			runUnprotectOrg(org, includeFork, orgSkipList, rules, deleteAllRules, bypass, backupDir)
 		},
 	}
 
@@ -49,6 +51,8 @@ func NewCmdUnprotectOrg() *cobra.Command {
 	cmd.Flags().StringSliceVar(&rules, "rule", nil, "Rule name to delete (ruleset name or branch name, repeatable)")
 	cmd.Flags().BoolVar(&deleteAllRules, "all-rules", false, "If true, delete all repository rulesets and branch protection rules")
 	cmd.Flags().BoolVar(&bypass, "bypass", false, "If true, do not delete rules; allow bypassing on matched branch protection rules")
+	cmd.Flags().StringVar(&backupDir, "backup-dir", "", "If set, save branch protections and rulesets of each repo to this directory before changing them. Existing backups are kept.")
+	addRepoSelectorFlag(cmd)
 	_ = cmd.MarkFlagRequired("org")
 
 	return cmd
@@ -28,17 +28,19 @@ func NewCmdUnprotectRepo() *cobra.Command {
 		rules          []string
 		deleteAllRules bool
 		bypass         bool
+		backupDir      string
 	)
 
 	cmd := &cobra.Command{
 		Use:               "unprotect-repo",
 		Short:             "Delete matching rulesets and branch protections from a repository",
 		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("repo"),
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			flags.PrintFlags(c.Flags())
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			runUnprotectRepo(owner, repo, rules, deleteAllRules, bypass)
+			runUnprotectRepo(owner, repo, rules, deleteAllRules, bypass, backupDir)
 		},
 	}
 
@@ -47,6 +49,7 @@ func NewCmdUnprotectRepo() *cobra.Command {
 	cmd.Flags().StringSliceVar(&rules, "rule", nil, "Rule name to delete (ruleset name or branch name, repeatable)")
 	cmd.Flags().BoolVar(&deleteAllRules, "all-rules", false, "If true, delete all repository rulesets and branch protection rules")
 	cmd.Flags().BoolVar(&bypass, "bypass", false, "If true, do not delete rules; allow bypassing on matched branch protection rules")
+	cmd.Flags().StringVar(&backupDir, "backup-dir", "", "If set, save branch protections and rulesets of each repo to this directory before changing them. Existing backups are kept.")
 	_ = cmd.MarkFlagRequired("owner")
 	_ = cmd.MarkFlagRequired("repo")
 
@@ -0,0 +1,64 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteMatchingRepoRulesets(t *testing.T) {
+	srv, client := useFakeGitHub(t)
+	fake := srv.AddRepo("kubedb", "mysql")
+	for _, name := range []string{"gh-tools", "release", "manual"} {
+		fake.AddRuleset(github.RepositoryRuleset{Name: name, Target: github.Ptr(github.RulesetTargetBranch)})
+	}
+
+	ctx := context.Background()
+	deleted, err := deleteMatchingRepoRulesets(ctx, client, "kubedb", "mysql", normalizeRules([]string{"release", "missing"}), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	var names []string
+	for _, rs := range fake.Rulesets() {
+		names = append(names, rs.Name)
+	}
+	assert.Equal(t, []string{"gh-tools", "manual"}, names)
+
+	deleted, err = deleteMatchingRepoRulesets(ctx, client, "kubedb", "mysql", nil, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	assert.Empty(t, fake.Rulesets())
+}
+
+func TestDeleteRepoBranchProtections(t *testing.T) {
+	srv, client := useFakeGitHub(t)
+	fake := srv.AddRepo("kubedb", "mysql").AddBranch("release-1.0", "feature-x")
+	for _, branch := range []string{"master", "release-1.0"} {
+		fake.SetProtection(branch, &github.Protection{EnforceAdmins: &github.AdminEnforcement{Enabled: true}})
+	}
+
+	ctx := context.Background()
+	deleted, err := deleteRepoBranchProtections(ctx, client, fake.Repository(), normalizeRules([]string{"release-1.0", "feature-x"}), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted, "unprotected branches are skipped")
+	assert.Nil(t, fake.Protection("release-1.0"))
+	assert.NotNil(t, fake.Protection("master"))
+}
@@ -36,6 +36,7 @@ func NewCmdStopWatch() *cobra.Command {
 		Use:               "stop-watching",
 		Short:             "Stop watching repos of a org",
 		DisableAutoGenTag: true,
+		Annotations:       requiredScopes("notifications"),
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			flags.PrintFlags(c.Flags())
 		},
@@ -56,11 +57,9 @@ func runStopWatch() {
 	client := newGitHubClient(ctx)
 
 	// Get the current user
-	user, _, err := client.Users.Get(ctx, "")
-	if err != nil {
+	if err := logCurrentUser(ctx, client); err != nil {
 		log.Fatal(err)
 	}
-	log.Println("user: ", user.GetLogin())
 
 	{
 		opt := &github.ListOptions{PerPage: 50}
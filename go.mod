@@ -13,6 +13,7 @@ require (
 	gomodules.xyz/pointer v0.1.0
 	gomodules.xyz/sets v0.2.1
 	gomodules.xyz/x v0.0.17
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -26,6 +27,5 @@ require (
 	github.com/spf13/pflag v1.0.5 // indirect
 	gomodules.xyz/clock v0.0.0-20200817085942-06523dba733f // indirect
 	gomodules.xyz/wait v0.2.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 	k8s.io/klog/v2 v2.110.1 // indirect
 )
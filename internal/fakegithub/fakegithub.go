@@ -0,0 +1,498 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fakegithub provides an in-memory GitHub REST API server for tests.
+// It models the orgs, repos, branches, branch protections, repo and org
+// rulesets, labels, releases, release assets and packages used by gh-tools,
+// paginates list responses and returns rate limit headers like api.github.com.
+package fakegithub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+)
+
+// DefaultLogin is the login of the authenticated user.
+const DefaultLogin = "octocat"
+
+// Server is a fake GitHub API served by an httptest.Server. The zero value is
+// not usable, use NewServer.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	login       string
+	nextID      int64
+	orgs        map[string]*github.Organization
+	orgRoles    map[string]string
+	orgRulesets map[string][]*github.RepositoryRuleset
+	repos       map[string]*Repo
+	apps        map[string]*github.App
+	packages    map[string][]*pkg
+	requests    []string
+	rateLimit   int
+	remaining   int
+	reset       time.Time
+}
+
+// Repo is a repository of the fake server.
+type Repo struct {
+	s        *Server
+	repo     *github.Repository
+	branches map[string]*branch
+	rulesets []*github.RepositoryRuleset
+	labels   []*github.Label
+	releases []*github.RepositoryRelease
+	assets   map[int64][]byte
+}
+
+type branch struct {
+	name       string
+	sha        string
+	protection *github.Protection
+}
+
+type pkg struct {
+	pkg      *github.Package
+	versions []*github.PackageVersion
+}
+
+// NewServer starts a fake GitHub API. Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		login:       DefaultLogin,
+		orgs:        map[string]*github.Organization{},
+		orgRoles:    map[string]string{},
+		orgRulesets: map[string][]*github.RepositoryRuleset{},
+		repos:       map[string]*Repo{},
+		apps:        map[string]*github.App{},
+		packages:    map[string][]*pkg{},
+		rateLimit:   5000,
+		remaining:   5000,
+		reset:       time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+	s.Server = httptest.NewServer(s.routes())
+	return s
+}
+
+// Client returns a client for the fake server.
+func (s *Server) Client() *github.Client {
+	client := github.NewClient(nil)
+	client.BaseURL = mustParseURL(s.URL + "/")
+	client.UploadURL = mustParseURL(s.URL + "/uploads/")
+	return client
+}
+
+func mustParseURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// Requests returns the "METHOD /path" of every request served so far.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// SetRateLimit sets the core rate limit and the number of calls left. Once
+// no call is left, requests fail with 403 like api.github.com.
+func (s *Server) SetRateLimit(limit, remaining int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimit, s.remaining = limit, remaining
+}
+
+// AddOrg adds an org on the free plan that the authenticated user is an
+// admin of. fn can change the org before it is added.
+func (s *Server) AddOrg(login string, fn ...func(org *github.Organization)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	org := &github.Organization{
+		ID:    github.Ptr(s.id()),
+		Login: github.Ptr(login),
+		Plan:  &github.Plan{Name: github.Ptr("free")},
+	}
+	for _, f := range fn {
+		f(org)
+	}
+	s.orgs[strings.ToLower(login)] = org
+	s.orgRoles[strings.ToLower(login)] = "admin"
+}
+
+// SetOrgRole sets the role of the authenticated user in an org, admin or
+// member.
+func (s *Server) SetOrgRole(login, role string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orgRoles[strings.ToLower(login)] = role
+}
+
+// AddOrgRuleset adds a ruleset to an org that was added and returns its id.
+func (s *Server) AddOrgRuleset(org string, rs github.RepositoryRuleset) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addOrgRuleset(strings.ToLower(org), &rs).GetID()
+}
+
+func (s *Server) addOrgRuleset(org string, rs *github.RepositoryRuleset) *github.RepositoryRuleset {
+	rs = clone(rs)
+	rs.ID = github.Ptr(s.id())
+	rs.Source = s.orgs[org].GetLogin()
+	rs.SourceType = github.Ptr(github.RulesetSourceTypeOrganization)
+	s.orgRulesets[org] = append(s.orgRulesets[org], rs)
+	return rs
+}
+
+// OrgRulesets returns the rulesets of an org.
+func (s *Server) OrgRulesets(org string) []*github.RepositoryRuleset {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return cloneAll(s.orgRulesets[strings.ToLower(org)])
+}
+
+// AddApp adds a GitHub App that can be looked up by slug.
+func (s *Server) AddApp(slug string, id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apps[slug] = &github.App{ID: github.Ptr(id), Slug: github.Ptr(slug), Name: github.Ptr(slug)}
+}
+
+// AddRepo adds the repo owner/name with a master branch. The repo is owned by
+// an org if the org was added, else by a user. The authenticated user is an
+// admin of the repo. Use fn to change other fields of the repo.
+func (s *Server) AddRepo(owner, name string, fn ...func(repo *github.Repository)) *Repo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ownerType := "User"
+	if _, ok := s.orgs[strings.ToLower(owner)]; ok {
+		ownerType = "Organization"
+	}
+	repo := &github.Repository{
+		ID:            github.Ptr(s.id()),
+		Name:          github.Ptr(name),
+		FullName:      github.Ptr(owner + "/" + name),
+		Owner:         &github.User{Login: github.Ptr(owner), Type: github.Ptr(ownerType)},
+		DefaultBranch: github.Ptr("master"),
+		Private:       github.Ptr(false),
+		Fork:          github.Ptr(false),
+		Archived:      github.Ptr(false),
+		HTMLURL:       github.Ptr(fmt.Sprintf("%s/%s/%s", s.URL, owner, name)),
+		CloneURL:      github.Ptr(fmt.Sprintf("%s/%s/%s.git", s.URL, owner, name)),
+		SSHURL:        github.Ptr(fmt.Sprintf("git@%s:%s/%s.git", strings.TrimPrefix(s.URL, "http://"), owner, name)),
+		Permissions:   &github.RepositoryPermissions{Admin: github.Ptr(true), Push: github.Ptr(true), Pull: github.Ptr(true)},
+	}
+	for _, f := range fn {
+		f(repo)
+	}
+	r := &Repo{s: s, repo: repo, branches: map[string]*branch{}, assets: map[int64][]byte{}}
+	r.addBranch(repo.GetDefaultBranch())
+	s.repos[repoKey(owner, name)] = r
+	return r
+}
+
+// Repo returns the repo owner/name, or nil if it does not exist.
+func (s *Server) Repo(owner, name string) *Repo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.repos[repoKey(owner, name)]
+}
+
+// AddPackage adds a package of an org with the given versions.
+func (s *Server) AddPackage(org, packageType, name, visibility string, versions ...*github.PackageVersion) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := &pkg{
+		pkg: &github.Package{
+			ID:          github.Ptr(s.id()),
+			Name:        github.Ptr(name),
+			PackageType: github.Ptr(packageType),
+			Visibility:  github.Ptr(visibility),
+			Owner:       &github.User{Login: github.Ptr(org)},
+		},
+	}
+	for _, v := range versions {
+		v = clone(v)
+		if v.ID == nil {
+			v.ID = github.Ptr(s.id())
+		}
+		p.versions = append(p.versions, v)
+	}
+	key := strings.ToLower(org)
+	s.packages[key] = append(s.packages[key], p)
+}
+
+// Packages returns the packages of an org.
+func (s *Server) Packages(org string) []*github.Package {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*github.Package
+	for _, p := range s.packages[strings.ToLower(org)] {
+		out = append(out, clone(p.pkg))
+	}
+	return out
+}
+
+// PackageVersions returns the versions of a package of an org.
+func (s *Server) PackageVersions(org, packageType, name string) []*github.PackageVersion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.findPackage(org, packageType, name)
+	if p == nil {
+		return nil
+	}
+	return cloneAll(p.versions)
+}
+
+// Repository returns the repository as listed by the API.
+func (r *Repo) Repository() *github.Repository {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return clone(r.repo)
+}
+
+// AddBranch adds branches to the repo.
+func (r *Repo) AddBranch(names ...string) *Repo {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, name := range names {
+		r.addBranch(name)
+	}
+	return r
+}
+
+func (r *Repo) addBranch(name string) {
+	if _, ok := r.branches[name]; !ok {
+		r.branches[name] = &branch{name: name, sha: fmt.Sprintf("%040x", r.s.id())}
+	}
+}
+
+// Branches returns the names of the branches of the repo, sorted.
+func (r *Repo) Branches() []string {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return r.branchNames()
+}
+
+// Empty removes all branches, like a repo without commits.
+func (r *Repo) Empty() *Repo {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	clear(r.branches)
+	return r
+}
+
+func (r *Repo) branchNames() []string {
+	out := make([]string, 0, len(r.branches))
+	for name := range r.branches {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// SetProtection sets the protection of a branch, nil removes it.
+func (r *Repo) SetProtection(name string, p *github.Protection) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.addBranch(name)
+	r.branches[name].protection = clone(p)
+}
+
+// Protection returns the protection of a branch, or nil if the branch is not
+// protected.
+func (r *Repo) Protection(name string) *github.Protection {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	b, ok := r.branches[name]
+	if !ok || b.protection == nil {
+		return nil
+	}
+	return clone(b.protection)
+}
+
+// AddRuleset adds a ruleset to the repo and returns its id.
+func (r *Repo) AddRuleset(rs github.RepositoryRuleset) int64 {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return r.addRuleset(&rs).GetID()
+}
+
+func (r *Repo) addRuleset(rs *github.RepositoryRuleset) *github.RepositoryRuleset {
+	rs = clone(rs)
+	rs.ID = github.Ptr(r.s.id())
+	rs.Source = r.repo.GetFullName()
+	rs.SourceType = github.Ptr(github.RulesetSourceTypeRepository)
+	r.rulesets = append(r.rulesets, rs)
+	return rs
+}
+
+// Rulesets returns the rulesets of the repo.
+func (r *Repo) Rulesets() []*github.RepositoryRuleset {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return cloneAll(r.rulesets)
+}
+
+// AddLabel adds a label to the repo.
+func (r *Repo) AddLabel(name, color, description string) *Repo {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.labels = append(r.labels, &github.Label{
+		ID:          github.Ptr(r.s.id()),
+		Name:        github.Ptr(name),
+		Color:       github.Ptr(color),
+		Description: github.Ptr(description),
+	})
+	return r
+}
+
+// Labels returns the labels of the repo.
+func (r *Repo) Labels() []*github.Label {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return cloneAll(r.labels)
+}
+
+// AddRelease adds a release for tag with assets, keyed by file name, and
+// returns its id.
+func (r *Repo) AddRelease(tag string, assets map[string][]byte) int64 {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	rel := r.addRelease(&github.RepositoryRelease{TagName: github.Ptr(tag), Name: github.Ptr(tag)})
+	names := make([]string, 0, len(assets))
+	for name := range assets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.addAsset(rel, name, "application/octet-stream", assets[name])
+	}
+	return rel.GetID()
+}
+
+func (r *Repo) addRelease(rel *github.RepositoryRelease) *github.RepositoryRelease {
+	rel = clone(rel)
+	id := r.s.id()
+	rel.ID = github.Ptr(id)
+	rel.Assets = []*github.ReleaseAsset{}
+	rel.UploadURL = github.Ptr(fmt.Sprintf("%s/uploads/repos/%s/releases/%d/assets{?name,label}", r.s.URL, r.repo.GetFullName(), id))
+	if rel.Name == nil {
+		rel.Name = rel.TagName
+	}
+	r.releases = append(r.releases, rel)
+	return rel
+}
+
+func (r *Repo) addAsset(rel *github.RepositoryRelease, name, contentType string, data []byte) *github.ReleaseAsset {
+	id := r.s.id()
+	asset := &github.ReleaseAsset{
+		ID:                 github.Ptr(id),
+		Name:               github.Ptr(name),
+		ContentType:        github.Ptr(contentType),
+		Size:               github.Ptr(len(data)),
+		State:              github.Ptr("uploaded"),
+		URL:                github.Ptr(fmt.Sprintf("%s/repos/%s/releases/assets/%d", r.s.URL, r.repo.GetFullName(), id)),
+		BrowserDownloadURL: github.Ptr(fmt.Sprintf("%s/%s/releases/download/%s/%s", r.s.URL, r.repo.GetFullName(), rel.GetTagName(), name)),
+	}
+	rel.Assets = append(rel.Assets, asset)
+	r.assets[id] = slices.Clone(data)
+	return asset
+}
+
+// Releases returns the releases of the repo, newest first.
+func (r *Repo) Releases() []*github.RepositoryRelease {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	out := cloneAll(r.releases)
+	slices.Reverse(out)
+	return out
+}
+
+// AssetData returns the content of a release asset.
+func (r *Repo) AssetData(tag, name string) ([]byte, bool) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, rel := range r.releases {
+		if rel.GetTagName() != tag {
+			continue
+		}
+		for _, a := range rel.Assets {
+			if a.GetName() == name {
+				return slices.Clone(r.assets[a.GetID()]), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) id() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *Server) findPackage(org, packageType, name string) *pkg {
+	for _, p := range s.packages[strings.ToLower(org)] {
+		if p.pkg.GetPackageType() == packageType && p.pkg.GetName() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func repoKey(owner, name string) string {
+	return strings.ToLower(owner + "/" + name)
+}
+
+// clone returns a deep copy of v, so that callers can not change the state
+// of the server without the lock.
+func clone[T any](v *T) *T {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	out := new(T)
+	if err := json.Unmarshal(data, out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func cloneAll[T any](in []*T) []*T {
+	out := make([]*T, 0, len(in))
+	for _, v := range in {
+		out = append(out, clone(v))
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakegithub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagination(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	repo := s.AddRepo("kubedb", "mysql")
+	for i := range 4 {
+		repo.AddBranch(fmt.Sprintf("release-%d", i))
+	}
+
+	ctx := context.Background()
+	client := s.Client()
+	opt := &github.BranchListOptions{ListOptions: github.ListOptions{PerPage: 2}}
+	var names []string
+	pages := 0
+	for {
+		branches, resp, err := client.Repositories.ListBranches(ctx, "kubedb", "mysql", opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, b := range branches {
+			names = append(names, b.GetName())
+		}
+		if resp.NextPage == 0 {
+			assert.Equal(t, 0, resp.LastPage)
+			break
+		}
+		assert.Equal(t, 3, resp.LastPage)
+		opt.Page = resp.NextPage
+	}
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, repo.Branches(), names)
+}
+
+func TestRateLimit(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddRepo("kubedb", "mysql")
+	s.SetRateLimit(10, 2)
+
+	ctx := context.Background()
+	client := s.Client()
+	_, resp, err := client.Repositories.Get(ctx, "kubedb", "mysql")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, resp.Rate.Limit)
+	assert.Equal(t, 1, resp.Rate.Remaining)
+
+	_, _, err = client.Repositories.Get(ctx, "kubedb", "mysql")
+	assert.NoError(t, err)
+
+	_, _, err = client.Repositories.Get(ctx, "kubedb", "mysql")
+	var rle *github.RateLimitError
+	assert.True(t, errors.As(err, &rle), "got %v", err)
+
+	limits, _, err := client.RateLimit.Get(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, limits.GetCore().Remaining)
+}
+
+func TestBranchProtection(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	repo := s.AddRepo("kubedb", "mysql")
+
+	ctx := context.Background()
+	client := s.Client()
+	_, _, err := client.Repositories.GetBranchProtection(ctx, "kubedb", "mysql", "master")
+	assert.ErrorIs(t, err, github.ErrBranchNotProtected)
+
+	checks := []*github.RequiredStatusCheck{{Context: "Build"}}
+	_, _, err = client.Repositories.UpdateBranchProtection(ctx, "kubedb", "mysql", "master", &github.ProtectionRequest{
+		RequiredStatusChecks: &github.RequiredStatusChecks{Strict: true, Checks: &checks},
+		EnforceAdmins:        true,
+		Restrictions:         &github.BranchRestrictionsRequest{Users: []string{}, Teams: []string{}, Apps: []string{"kodiakhq"}},
+	})
+	assert.NoError(t, err)
+
+	p := repo.Protection("master")
+	if assert.NotNil(t, p) {
+		assert.Equal(t, []string{"Build"}, *p.RequiredStatusChecks.Contexts)
+		assert.True(t, p.EnforceAdmins.Enabled)
+		assert.Equal(t, "kodiakhq", p.Restrictions.Apps[0].GetSlug())
+	}
+
+	_, err = client.Repositories.RemoveBranchProtection(ctx, "kubedb", "mysql", "master")
+	assert.NoError(t, err)
+	assert.Nil(t, repo.Protection("master"))
+}
@@ -0,0 +1,949 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakegithub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v84/github"
+)
+
+const defaultPerPage = 30
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /rate_limit", s.getRateLimit)
+	mux.HandleFunc("GET /user", s.getUser)
+	mux.HandleFunc("GET /user/orgs", s.listOrgs)
+	mux.HandleFunc("GET /user/memberships/orgs/{org}", s.getOrgMembership)
+	mux.HandleFunc("GET /orgs/{org}", s.getOrg)
+	mux.HandleFunc("GET /orgs/{org}/rulesets", s.withOrg(s.listOrgRulesets))
+	mux.HandleFunc("POST /orgs/{org}/rulesets", s.withOrg(s.createOrgRuleset))
+	mux.HandleFunc("GET /orgs/{org}/rulesets/{id}", s.withOrg(s.getOrgRuleset))
+	mux.HandleFunc("PUT /orgs/{org}/rulesets/{id}", s.withOrg(s.updateOrgRuleset))
+	mux.HandleFunc("DELETE /orgs/{org}/rulesets/{id}", s.withOrg(s.deleteOrgRuleset))
+	mux.HandleFunc("GET /user/repos", s.listUserRepos)
+	mux.HandleFunc("GET /orgs/{org}/repos", s.listOrgRepos)
+	mux.HandleFunc("GET /apps/{slug}", s.getApp)
+
+	mux.HandleFunc("GET /repos/{owner}/{repo}", s.withRepo(s.getRepo))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/properties/values", s.withRepo(s.getPropertyValues))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/branches", s.withRepo(s.listBranches))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/commits", s.withRepo(s.listCommits))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/commits/{ref}/check-runs", s.withRepo(s.listCheckRuns))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/commits/{ref}/status", s.withRepo(s.getCombinedStatus))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/branches/{branch}/protection", s.withRepo(s.getProtection))
+	mux.HandleFunc("PUT /repos/{owner}/{repo}/branches/{branch}/protection", s.withRepo(s.updateProtection))
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/branches/{branch}/protection", s.withRepo(s.deleteProtection))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/branches/{branch}/protection/enforce_admins", s.withRepo(s.getAdminEnforcement))
+	mux.HandleFunc("POST /repos/{owner}/{repo}/branches/{branch}/protection/enforce_admins", s.withRepo(s.addAdminEnforcement))
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/branches/{branch}/protection/enforce_admins", s.withRepo(s.deleteAdminEnforcement))
+	mux.HandleFunc("POST /repos/{owner}/{repo}/branches/{branch}/protection/required_signatures", s.withRepo(s.requireSignatures))
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/branches/{branch}/protection/required_signatures", s.withRepo(s.optionalSignatures))
+
+	mux.HandleFunc("GET /repos/{owner}/{repo}/rulesets", s.withRepo(s.listRulesets))
+	mux.HandleFunc("POST /repos/{owner}/{repo}/rulesets", s.withRepo(s.createRuleset))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/rulesets/{id}", s.withRepo(s.getRuleset))
+	mux.HandleFunc("PUT /repos/{owner}/{repo}/rulesets/{id}", s.withRepo(s.updateRuleset))
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/rulesets/{id}", s.withRepo(s.deleteRuleset))
+
+	mux.HandleFunc("GET /repos/{owner}/{repo}/labels", s.withRepo(s.listLabels))
+	mux.HandleFunc("POST /repos/{owner}/{repo}/labels", s.withRepo(s.createLabel))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/labels/{name}", s.withRepo(s.getLabel))
+	mux.HandleFunc("PATCH /repos/{owner}/{repo}/labels/{name}", s.withRepo(s.editLabel))
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/labels/{name}", s.withRepo(s.deleteLabel))
+
+	mux.HandleFunc("GET /repos/{owner}/{repo}/releases", s.withRepo(s.listReleases))
+	mux.HandleFunc("POST /repos/{owner}/{repo}/releases", s.withRepo(s.createRelease))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/releases/tags/{tag}", s.withRepo(s.getReleaseByTag))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/releases/{id}", s.withRepo(s.getRelease))
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/releases/{id}", s.withRepo(s.deleteRelease))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/releases/assets/{id}", s.withRepo(s.getAsset))
+	mux.HandleFunc("POST /uploads/repos/{owner}/{repo}/releases/{id}/assets", s.withRepo(s.uploadAsset))
+
+	mux.HandleFunc("GET /orgs/{org}/packages", s.listPackages)
+	mux.HandleFunc("GET /orgs/{org}/packages/{type}/{name}", s.getPackage)
+	mux.HandleFunc("DELETE /orgs/{org}/packages/{type}/{name}", s.deletePackage)
+	mux.HandleFunc("GET /orgs/{org}/packages/{type}/{name}/versions", s.listPackageVersions)
+	mux.HandleFunc("DELETE /orgs/{org}/packages/{type}/{name}/versions/{id}", s.deletePackageVersion)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		if r.URL.Path != "/rate_limit" && s.remaining > 0 {
+			s.remaining--
+		} else if r.URL.Path != "/rate_limit" {
+			s.writeRateLimitHeaders(w)
+			writeError(w, http.StatusForbidden, "API rate limit exceeded for user "+s.login)
+			return
+		}
+		s.writeRateLimitHeaders(w)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) writeRateLimitHeaders(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(s.rateLimit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(s.remaining))
+	h.Set("X-RateLimit-Used", strconv.Itoa(s.rateLimit-s.remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(s.reset.Unix(), 10))
+	h.Set("X-RateLimit-Resource", "core")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{
+		"message":           message,
+		"documentation_url": "https://docs.github.com/rest",
+	})
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return false
+	}
+	return true
+}
+
+// paginate writes the page of items selected by the page and per_page query
+// parameters along with a Link header, like the GitHub API.
+func paginate[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	q := r.URL.Query()
+	perPage, _ := strconv.Atoi(q.Get("per_page"))
+	if perPage <= 0 {
+		perPage = defaultPerPage
+	}
+	perPage = min(perPage, 100)
+	page, _ := strconv.Atoi(q.Get("page"))
+	page = max(page, 1)
+	last := max((len(items)+perPage-1)/perPage, 1)
+
+	link := func(p int, rel string) string {
+		u := *r.URL
+		q := u.Query()
+		q.Set("page", strconv.Itoa(p))
+		q.Set("per_page", strconv.Itoa(perPage))
+		u.RawQuery = q.Encode()
+		return fmt.Sprintf(`<http://%s%s>; rel="%s"`, r.Host, u.RequestURI(), rel)
+	}
+	var links []string
+	if page < last {
+		links = append(links, link(page+1, "next"), link(last, "last"))
+	}
+	if page > 1 {
+		links = append(links, link(1, "first"), link(page-1, "prev"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+	out := items[start:end]
+	if out == nil {
+		out = []T{}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) getRateLimit(w http.ResponseWriter, _ *http.Request) {
+	rate := map[string]any{
+		"limit":     s.rateLimit,
+		"remaining": s.remaining,
+		"used":      s.rateLimit - s.remaining,
+		"reset":     s.reset.Unix(),
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"resources": map[string]any{"core": rate},
+		"rate":      rate,
+	})
+}
+
+func (s *Server) getUser(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, &github.User{Login: github.Ptr(s.login), Type: github.Ptr("User")})
+}
+
+func (s *Server) listOrgs(w http.ResponseWriter, r *http.Request) {
+	out := make([]*github.Organization, 0, len(s.orgs))
+	for _, org := range s.orgs {
+		out = append(out, org)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GetLogin() < out[j].GetLogin() })
+	paginate(w, r, out)
+}
+
+func (s *Server) getOrg(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.orgs[strings.ToLower(r.PathValue("org"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, org)
+}
+
+func (s *Server) getOrgMembership(w http.ResponseWriter, r *http.Request) {
+	key := strings.ToLower(r.PathValue("org"))
+	org, ok := s.orgs[key]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, &github.Membership{
+		State:        github.Ptr("active"),
+		Role:         github.Ptr(s.orgRoles[key]),
+		Organization: org,
+		User:         &github.User{Login: github.Ptr(s.login)},
+	})
+}
+
+func (s *Server) sortedRepos(keep func(repo *github.Repository) bool) []*github.Repository {
+	var out []*github.Repository
+	for _, r := range s.repos {
+		if keep(r.repo) {
+			out = append(out, r.repo)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GetFullName() < out[j].GetFullName() })
+	return out
+}
+
+func (s *Server) listUserRepos(w http.ResponseWriter, r *http.Request) {
+	paginate(w, r, s.sortedRepos(func(*github.Repository) bool { return true }))
+}
+
+func (s *Server) listOrgRepos(w http.ResponseWriter, r *http.Request) {
+	org := r.PathValue("org")
+	if _, ok := s.orgs[strings.ToLower(org)]; !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	typ := r.URL.Query().Get("type")
+	paginate(w, r, s.sortedRepos(func(repo *github.Repository) bool {
+		if !strings.EqualFold(repo.GetOwner().GetLogin(), org) {
+			return false
+		}
+		switch typ {
+		case "public":
+			return !repo.GetPrivate()
+		case "private":
+			return repo.GetPrivate()
+		case "forks":
+			return repo.GetFork()
+		case "sources":
+			return !repo.GetFork()
+		default:
+			return true
+		}
+	}))
+}
+
+func (s *Server) getApp(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.apps[r.PathValue("slug")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, app)
+}
+
+// withRepo looks up the repo of the request path.
+func (s *Server) withRepo(fn func(w http.ResponseWriter, r *http.Request, repo *Repo)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		repo, ok := s.repos[repoKey(r.PathValue("owner"), r.PathValue("repo"))]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		fn(w, r, repo)
+	}
+}
+
+// withOrg passes the lower case login of the org in the path to fn.
+func (s *Server) withOrg(fn func(w http.ResponseWriter, r *http.Request, org string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		org := strings.ToLower(r.PathValue("org"))
+		if _, ok := s.orgs[org]; !ok {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		fn(w, r, org)
+	}
+}
+
+func pathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *Server) getRepo(w http.ResponseWriter, _ *http.Request, repo *Repo) {
+	writeJSON(w, http.StatusOK, repo.repo)
+}
+
+func (s *Server) getPropertyValues(w http.ResponseWriter, _ *http.Request, repo *Repo) {
+	out := []*github.CustomPropertyValue{}
+	for _, name := range slices.Sorted(maps.Keys(repo.repo.CustomProperties)) {
+		out = append(out, &github.CustomPropertyValue{PropertyName: name, Value: repo.repo.CustomProperties[name]})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) listBranches(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	var out []*github.Branch
+	for _, name := range repo.branchNames() {
+		b := repo.branches[name]
+		out = append(out, &github.Branch{
+			Name:      github.Ptr(b.name),
+			Commit:    &github.RepositoryCommit{SHA: github.Ptr(b.sha)},
+			Protected: github.Ptr(b.protection != nil),
+		})
+	}
+	paginate(w, r, out)
+}
+
+// listCommits returns the head commit of the default branch. Like GitHub, it
+// fails with 409 Conflict for a repo without commits.
+func (s *Server) listCommits(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	b, ok := repo.branches[repo.repo.GetDefaultBranch()]
+	if !ok {
+		writeError(w, http.StatusConflict, "Git Repository is empty.")
+		return
+	}
+	paginate(w, r, []*github.RepositoryCommit{{SHA: github.Ptr(b.sha)}})
+}
+
+func (s *Server) listCheckRuns(w http.ResponseWriter, _ *http.Request, _ *Repo) {
+	writeJSON(w, http.StatusOK, &github.ListCheckRunsResults{Total: github.Ptr(0), CheckRuns: []*github.CheckRun{}})
+}
+
+func (s *Server) getCombinedStatus(w http.ResponseWriter, r *http.Request, _ *Repo) {
+	writeJSON(w, http.StatusOK, &github.CombinedStatus{State: github.Ptr("pending"), SHA: github.Ptr(r.PathValue("ref")), Statuses: []*github.RepoStatus{}})
+}
+
+func (s *Server) branch(w http.ResponseWriter, r *http.Request, repo *Repo) (*branch, bool) {
+	b, ok := repo.branches[r.PathValue("branch")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Branch not found")
+	}
+	return b, ok
+}
+
+func (s *Server) getProtection(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	b, ok := s.branch(w, r, repo)
+	if !ok {
+		return
+	}
+	if b.protection == nil {
+		writeError(w, http.StatusNotFound, "Branch not protected")
+		return
+	}
+	writeJSON(w, http.StatusOK, b.protection)
+}
+
+func (s *Server) updateProtection(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	b, ok := s.branch(w, r, repo)
+	if !ok {
+		return
+	}
+	var req github.ProtectionRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	p := protectionFromRequest(&req)
+	if b.protection != nil {
+		// signatures are managed by their own endpoint
+		p.RequiredSignatures = b.protection.RequiredSignatures
+	}
+	b.protection = p
+	writeJSON(w, http.StatusOK, b.protection)
+}
+
+func (s *Server) deleteProtection(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	b, ok := s.branch(w, r, repo)
+	if !ok {
+		return
+	}
+	if b.protection == nil {
+		writeError(w, http.StatusNotFound, "Branch not protected")
+		return
+	}
+	b.protection = nil
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getAdminEnforcement(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	b, ok := s.branch(w, r, repo)
+	if !ok {
+		return
+	}
+	if b.protection == nil {
+		writeError(w, http.StatusNotFound, "Branch not protected")
+		return
+	}
+	writeJSON(w, http.StatusOK, b.protection.GetEnforceAdmins())
+}
+
+func (s *Server) addAdminEnforcement(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	b, ok := s.branch(w, r, repo)
+	if !ok {
+		return
+	}
+	if b.protection == nil {
+		writeError(w, http.StatusNotFound, "Branch not protected")
+		return
+	}
+	b.protection.EnforceAdmins = &github.AdminEnforcement{Enabled: true}
+	writeJSON(w, http.StatusOK, b.protection.EnforceAdmins)
+}
+
+func (s *Server) requireSignatures(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	s.setRequiredSignatures(w, r, repo, true)
+}
+
+func (s *Server) optionalSignatures(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	s.setRequiredSignatures(w, r, repo, false)
+}
+
+func (s *Server) setRequiredSignatures(w http.ResponseWriter, r *http.Request, repo *Repo, enabled bool) {
+	b, ok := s.branch(w, r, repo)
+	if !ok {
+		return
+	}
+	if b.protection == nil {
+		writeError(w, http.StatusNotFound, "Branch not protected")
+		return
+	}
+	b.protection.RequiredSignatures = &github.SignaturesProtectedBranch{Enabled: github.Ptr(enabled)}
+	if !enabled {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, b.protection.RequiredSignatures)
+}
+
+func (s *Server) deleteAdminEnforcement(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	b, ok := s.branch(w, r, repo)
+	if !ok {
+		return
+	}
+	if b.protection == nil {
+		writeError(w, http.StatusNotFound, "Branch not protected")
+		return
+	}
+	b.protection.EnforceAdmins = &github.AdminEnforcement{Enabled: false}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// protectionFromRequest returns the protection GitHub reports after req is
+// applied.
+func protectionFromRequest(req *github.ProtectionRequest) *github.Protection {
+	p := &github.Protection{
+		EnforceAdmins:                  &github.AdminEnforcement{Enabled: req.EnforceAdmins},
+		RequireLinearHistory:           &github.RequireLinearHistory{Enabled: req.GetRequireLinearHistory()},
+		AllowForcePushes:               &github.AllowForcePushes{Enabled: req.GetAllowForcePushes()},
+		AllowDeletions:                 &github.AllowDeletions{Enabled: req.GetAllowDeletions()},
+		RequiredConversationResolution: &github.RequiredConversationResolution{Enabled: req.GetRequiredConversationResolution()},
+	}
+	if rsc := req.RequiredStatusChecks; rsc != nil {
+		var checks []*github.RequiredStatusCheck
+		var contexts []string
+		switch {
+		case rsc.Checks != nil:
+			for _, c := range *rsc.Checks {
+				checks = append(checks, &github.RequiredStatusCheck{Context: c.Context, AppID: c.AppID})
+				contexts = append(contexts, c.Context)
+			}
+		case rsc.Contexts != nil:
+			for _, c := range *rsc.Contexts {
+				checks = append(checks, &github.RequiredStatusCheck{Context: c})
+				contexts = append(contexts, c)
+			}
+		}
+		checks = nonNil(checks)
+		contexts = nonNil(contexts)
+		p.RequiredStatusChecks = &github.RequiredStatusChecks{Strict: rsc.Strict, Checks: &checks, Contexts: &contexts}
+	}
+	if prr := req.RequiredPullRequestReviews; prr != nil {
+		p.RequiredPullRequestReviews = &github.PullRequestReviewsEnforcement{
+			DismissStaleReviews:          prr.DismissStaleReviews,
+			RequireCodeOwnerReviews:      prr.RequireCodeOwnerReviews,
+			RequiredApprovingReviewCount: prr.RequiredApprovingReviewCount,
+			RequireLastPushApproval:      prr.GetRequireLastPushApproval(),
+		}
+		if dr := prr.DismissalRestrictionsRequest; dr != nil && (dr.Users != nil || dr.Teams != nil || dr.Apps != nil) {
+			p.RequiredPullRequestReviews.DismissalRestrictions = &github.DismissalRestrictions{
+				Users: users(dr.GetUsers()),
+				Teams: teams(dr.GetTeams()),
+				Apps:  apps(dr.GetApps()),
+			}
+		}
+		if ba := prr.BypassPullRequestAllowancesRequest; ba != nil {
+			p.RequiredPullRequestReviews.BypassPullRequestAllowances = &github.BypassPullRequestAllowances{
+				Users: users(ba.Users),
+				Teams: teams(ba.Teams),
+				Apps:  apps(ba.Apps),
+			}
+		}
+	}
+	if req.BlockCreations != nil {
+		p.BlockCreations = &github.BlockCreations{Enabled: req.BlockCreations}
+	}
+	if req.LockBranch != nil {
+		p.LockBranch = &github.LockBranch{Enabled: req.LockBranch}
+	}
+	if req.AllowForkSyncing != nil {
+		p.AllowForkSyncing = &github.AllowForkSyncing{Enabled: req.AllowForkSyncing}
+	}
+	if rr := req.Restrictions; rr != nil {
+		p.Restrictions = &github.BranchRestrictions{
+			Users: users(rr.Users),
+			Teams: teams(rr.Teams),
+			Apps:  apps(rr.Apps),
+		}
+	}
+	return p
+}
+
+func nonNil[T any](in []T) []T {
+	if in == nil {
+		return []T{}
+	}
+	return in
+}
+
+func users(logins []string) []*github.User {
+	out := []*github.User{}
+	for _, login := range logins {
+		out = append(out, &github.User{Login: github.Ptr(login)})
+	}
+	return out
+}
+
+func teams(slugs []string) []*github.Team {
+	out := []*github.Team{}
+	for _, slug := range slugs {
+		out = append(out, &github.Team{Slug: github.Ptr(slug), Name: github.Ptr(slug)})
+	}
+	return out
+}
+
+func apps(slugs []string) []*github.App {
+	out := []*github.App{}
+	for _, slug := range slugs {
+		out = append(out, &github.App{Slug: github.Ptr(slug), Name: github.Ptr(slug)})
+	}
+	return out
+}
+
+func (s *Server) listRulesets(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	paginate(w, r, repo.rulesets)
+}
+
+func (s *Server) createRuleset(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	createRuleset(w, r, repo.rulesets, repo.addRuleset)
+}
+
+func (s *Server) getRuleset(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	getRuleset(w, r, repo.rulesets)
+}
+
+func (s *Server) updateRuleset(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	updateRuleset(w, r, repo.rulesets)
+}
+
+func (s *Server) deleteRuleset(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	deleteRuleset(w, r, &repo.rulesets)
+}
+
+func (s *Server) listOrgRulesets(w http.ResponseWriter, r *http.Request, org string) {
+	paginate(w, r, s.orgRulesets[org])
+}
+
+func (s *Server) createOrgRuleset(w http.ResponseWriter, r *http.Request, org string) {
+	createRuleset(w, r, s.orgRulesets[org], func(rs *github.RepositoryRuleset) *github.RepositoryRuleset {
+		return s.addOrgRuleset(org, rs)
+	})
+}
+
+func (s *Server) getOrgRuleset(w http.ResponseWriter, r *http.Request, org string) {
+	getRuleset(w, r, s.orgRulesets[org])
+}
+
+func (s *Server) updateOrgRuleset(w http.ResponseWriter, r *http.Request, org string) {
+	updateRuleset(w, r, s.orgRulesets[org])
+}
+
+func (s *Server) deleteOrgRuleset(w http.ResponseWriter, r *http.Request, org string) {
+	rulesets := s.orgRulesets[org]
+	deleteRuleset(w, r, &rulesets)
+	s.orgRulesets[org] = rulesets
+}
+
+func findRuleset(w http.ResponseWriter, r *http.Request, rulesets []*github.RepositoryRuleset) (int, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return 0, false
+	}
+	i := slices.IndexFunc(rulesets, func(rs *github.RepositoryRuleset) bool { return rs.GetID() == id })
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return 0, false
+	}
+	return i, true
+}
+
+func createRuleset(w http.ResponseWriter, r *http.Request, rulesets []*github.RepositoryRuleset, add func(*github.RepositoryRuleset) *github.RepositoryRuleset) {
+	var rs github.RepositoryRuleset
+	if !readJSON(w, r, &rs) {
+		return
+	}
+	if rs.Name == "" {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+	for _, cur := range rulesets {
+		if cur.Name == rs.Name {
+			writeError(w, http.StatusUnprocessableEntity, "Name must be unique")
+			return
+		}
+	}
+	fillRulesetDefaults(&rs)
+	writeJSON(w, http.StatusCreated, add(&rs))
+}
+
+// fillRulesetDefaults stores a ruleset like GitHub does: optional parameters
+// are filled in with their defaults, and lists come back in an order of
+// their own.
+func fillRulesetDefaults(rs *github.RepositoryRuleset) {
+	if rs.Conditions != nil && rs.Conditions.RefName != nil && rs.Conditions.RefName.Exclude == nil {
+		rs.Conditions.RefName.Exclude = []string{}
+	}
+	for _, a := range rs.BypassActors {
+		if a.BypassMode == nil {
+			a.BypassMode = github.Ptr(github.BypassModeAlways)
+		}
+	}
+	slices.SortFunc(rs.BypassActors, func(a, b *github.BypassActor) int {
+		return strings.Compare(fmt.Sprint(a.GetActorType(), a.GetActorID()), fmt.Sprint(b.GetActorType(), b.GetActorID()))
+	})
+	if rs.Rules == nil {
+		return
+	}
+	if p := rs.Rules.PullRequest; p != nil {
+		if p.AllowedMergeMethods == nil {
+			p.AllowedMergeMethods = []github.PullRequestMergeMethod{github.PullRequestMergeMethodMerge, github.PullRequestMergeMethodSquash, github.PullRequestMergeMethodRebase}
+		}
+		slices.Sort(p.AllowedMergeMethods)
+	}
+	if p := rs.Rules.RequiredStatusChecks; p != nil {
+		if p.DoNotEnforceOnCreate == nil {
+			p.DoNotEnforceOnCreate = github.Ptr(false)
+		}
+		slices.SortFunc(p.RequiredStatusChecks, func(a, b *github.RuleStatusCheck) int {
+			return strings.Compare(a.Context, b.Context)
+		})
+	}
+}
+
+func getRuleset(w http.ResponseWriter, r *http.Request, rulesets []*github.RepositoryRuleset) {
+	if i, ok := findRuleset(w, r, rulesets); ok {
+		writeJSON(w, http.StatusOK, rulesets[i])
+	}
+}
+
+func updateRuleset(w http.ResponseWriter, r *http.Request, rulesets []*github.RepositoryRuleset) {
+	i, ok := findRuleset(w, r, rulesets)
+	if !ok {
+		return
+	}
+	var rs github.RepositoryRuleset
+	if !readJSON(w, r, &rs) {
+		return
+	}
+	cur := rulesets[i]
+	fillRulesetDefaults(&rs)
+	rs.ID, rs.Source, rs.SourceType = cur.ID, cur.Source, cur.SourceType
+	rulesets[i] = &rs
+	writeJSON(w, http.StatusOK, &rs)
+}
+
+func deleteRuleset(w http.ResponseWriter, r *http.Request, rulesets *[]*github.RepositoryRuleset) {
+	if i, ok := findRuleset(w, r, *rulesets); ok {
+		*rulesets = slices.Delete(*rulesets, i, i+1)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) listLabels(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	paginate(w, r, repo.labels)
+}
+
+func (s *Server) findLabel(repo *Repo, name string) int {
+	return slices.IndexFunc(repo.labels, func(l *github.Label) bool { return strings.EqualFold(l.GetName(), name) })
+}
+
+func (s *Server) createLabel(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	var l github.Label
+	if !readJSON(w, r, &l) {
+		return
+	}
+	if l.GetName() == "" || s.findLabel(repo, l.GetName()) >= 0 {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+	l.ID = github.Ptr(s.id())
+	repo.labels = append(repo.labels, &l)
+	writeJSON(w, http.StatusCreated, &l)
+}
+
+func (s *Server) editLabel(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	i := s.findLabel(repo, r.PathValue("name"))
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var l github.Label
+	if !readJSON(w, r, &l) {
+		return
+	}
+	cur := repo.labels[i]
+	if l.Name != nil {
+		// the API renames labels with new_name, but go-github sends name
+		cur.Name = l.Name
+	}
+	if l.Color != nil {
+		cur.Color = l.Color
+	}
+	if l.Description != nil {
+		cur.Description = l.Description
+	}
+	writeJSON(w, http.StatusOK, cur)
+}
+
+func (s *Server) getLabel(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	i := s.findLabel(repo, r.PathValue("name"))
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, repo.labels[i])
+}
+
+func (s *Server) deleteLabel(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	i := s.findLabel(repo, r.PathValue("name"))
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	repo.labels = slices.Delete(repo.labels, i, i+1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listReleases(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	out := slices.Clone(repo.releases)
+	slices.Reverse(out)
+	paginate(w, r, out)
+}
+
+func (s *Server) createRelease(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	var rel github.RepositoryRelease
+	if !readJSON(w, r, &rel) {
+		return
+	}
+	if rel.GetTagName() == "" {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+	for _, cur := range repo.releases {
+		if cur.GetTagName() == rel.GetTagName() {
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed: tag_name already_exists")
+			return
+		}
+	}
+	writeJSON(w, http.StatusCreated, repo.addRelease(&rel))
+}
+
+func (s *Server) getReleaseByTag(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	for _, rel := range repo.releases {
+		if rel.GetTagName() == r.PathValue("tag") {
+			writeJSON(w, http.StatusOK, rel)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) getRelease(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	for _, rel := range repo.releases {
+		if rel.GetID() == id {
+			writeJSON(w, http.StatusOK, rel)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) deleteRelease(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	i := slices.IndexFunc(repo.releases, func(rel *github.RepositoryRelease) bool { return rel.GetID() == id })
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	for _, a := range repo.releases[i].Assets {
+		delete(repo.assets, a.GetID())
+	}
+	repo.releases = slices.Delete(repo.releases, i, i+1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getAsset(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	for _, rel := range repo.releases {
+		for _, a := range rel.Assets {
+			if a.GetID() != id {
+				continue
+			}
+			if r.Header.Get("Accept") == "application/octet-stream" {
+				w.Header().Set("Content-Type", "application/octet-stream")
+				_, _ = w.Write(repo.assets[id])
+				return
+			}
+			writeJSON(w, http.StatusOK, a)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) uploadAsset(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	i := slices.IndexFunc(repo.releases, func(rel *github.RepositoryRelease) bool { return rel.GetID() == id })
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	name := r.URL.Query().Get("name")
+	rel := repo.releases[i]
+	if name == "" || slices.ContainsFunc(rel.Assets, func(a *github.ReleaseAsset) bool { return a.GetName() == name }) {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, repo.addAsset(rel, name, r.Header.Get("Content-Type"), data))
+}
+
+func (s *Server) listPackages(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var out []*github.Package
+	for _, p := range s.packages[strings.ToLower(r.PathValue("org"))] {
+		if t := q.Get("package_type"); t != "" && p.pkg.GetPackageType() != t {
+			continue
+		}
+		if v := q.Get("visibility"); v != "" && p.pkg.GetVisibility() != v {
+			continue
+		}
+		out = append(out, p.pkg)
+	}
+	paginate(w, r, out)
+}
+
+func (s *Server) getPackage(w http.ResponseWriter, r *http.Request) {
+	p := s.findPackage(r.PathValue("org"), r.PathValue("type"), r.PathValue("name"))
+	if p == nil {
+		writeError(w, http.StatusNotFound, "Package not found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, p.pkg)
+}
+
+func (s *Server) deletePackage(w http.ResponseWriter, r *http.Request) {
+	key := strings.ToLower(r.PathValue("org"))
+	p := s.findPackage(key, r.PathValue("type"), r.PathValue("name"))
+	if p == nil {
+		writeError(w, http.StatusNotFound, "Package not found.")
+		return
+	}
+	s.packages[key] = slices.DeleteFunc(s.packages[key], func(cur *pkg) bool { return cur == p })
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listPackageVersions(w http.ResponseWriter, r *http.Request) {
+	p := s.findPackage(r.PathValue("org"), r.PathValue("type"), r.PathValue("name"))
+	if p == nil {
+		writeError(w, http.StatusNotFound, "Package not found.")
+		return
+	}
+	paginate(w, r, p.versions)
+}
+
+func (s *Server) deletePackageVersion(w http.ResponseWriter, r *http.Request) {
+	p := s.findPackage(r.PathValue("org"), r.PathValue("type"), r.PathValue("name"))
+	if p == nil {
+		writeError(w, http.StatusNotFound, "Package not found.")
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	i := slices.IndexFunc(p.versions, func(v *github.PackageVersion) bool { return v.GetID() == id })
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	p.versions = slices.Delete(p.versions, i, i+1)
+	w.WriteHeader(http.StatusNoContent)
+}